@@ -7,7 +7,7 @@ export const createProduct = async (productData, token) => {
   try {
     const formattedData = {
       ...productData,
-      stock: String(productData.stock) // Convertir stock a string
+      stock: Number(productData.stock) // el stock es un entero en la API
     };
 
     const response = await axios.post(`${API_URL}`, formattedData, {
@@ -81,12 +81,11 @@ export const uploadProductImage = async (productId, imageFile, token) => {
   }
 };
 
-// Listar productos con paginación opcional
-export const listProducts = async (page = 0) => {
+// Listar productos con filtros opcionales (min_price, max_price, category, user_id, in_stock, created_after, sort)
+// y paginación con limit y cursor (el next o prev de la respuesta). Devuelve { items, total, next, prev, facets }
+export const listProducts = async (params = {}) => {
   try {
-    const response = await axios.get(`${API_URL}`, {
-      params: { page },
-    });
+    const response = await axios.get(`${API_URL}`, { params });
     return response.data;
   } catch (error) {
     console.error("Error fetching products:", error.response?.data || error.message);
@@ -63,9 +63,9 @@ export const AdminPage: React.FC = () => {
       if (!token) {
         throw new Error('No authentication token found');
       }
-      const data = await listProducts(0);
+      const data = await listProducts();
       // Ensure data is an array, default to empty array if null or undefined
-      setProducts(Array.isArray(data) ? data : []);
+      setProducts(Array.isArray(data?.items) ? data.items : []);
     } catch (error: any) {
       if (error?.response?.status === 401) {
         navigate('/login');
@@ -14,9 +14,9 @@ export const ProductsPage = () => {
       setLoading(true);
       setError(null);
       try {
-        const data = await listProducts(0, searchTerm);
+        const data = await listProducts();
         // Ensure data is an array, default to empty array if null or undefined
-        setProducts(Array.isArray(data) ? data : []);
+        setProducts(Array.isArray(data?.items) ? data.items : []);
       } catch (error: any) {
         console.error("Error fetching products:", error.message);
         setError(error.message || "Failed to fetch products");
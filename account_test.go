@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kevintovar01/Store/server"
+)
+
+func TestSignUpAndLogin(t *testing.T) {
+	ts := newTestServer(t)
+
+	token := signUp(t, ts, "ana@store.com", "secret")
+
+	var me struct {
+		Id    string `json:"id"`
+		Email string `json:"email"`
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/me", token, nil, &me); status != http.StatusOK {
+		t.Fatalf("me: status %d", status)
+	}
+	if me.Email != "ana@store.com" || me.Id == "" {
+		t.Fatalf("me: unexpected user %+v", me)
+	}
+
+	status := doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": "ana@store.com", "password": "wrong"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: expected 401, got %d", status)
+	}
+
+	status = doJSON(t, ts, http.MethodPost, "/signup", "", map[string]string{"email": "ana@store.com", "password": "other"}, nil)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("signup with duplicated email: expected 500, got %d", status)
+	}
+
+	if status := doJSON(t, ts, http.MethodGet, "/me", "invalid", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("me with invalid token: expected 401, got %d", status)
+	}
+}
+
+type testTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	ts := newTestServer(t)
+	signUp(t, ts, "ana@store.com", "secret")
+
+	var session testTokens
+	doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": "ana@store.com", "password": "secret"}, &session)
+	if session.RefreshToken == "" {
+		t.Fatal("login: missing refresh token")
+	}
+
+	var rotated testTokens
+	status := doJSON(t, ts, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken}, &rotated)
+	if status != http.StatusOK || rotated.Token == "" || rotated.RefreshToken == session.RefreshToken {
+		t.Fatalf("refresh: status %d, tokens %+v", status, rotated)
+	}
+
+	// reusar un refresh token ya rotado revoca toda la familia
+	status = doJSON(t, ts, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: expected 401, got %d", status)
+	}
+	status = doJSON(t, ts, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("refresh after reuse: expected 401, got %d", status)
+	}
+
+	var second testTokens
+	doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": "ana@store.com", "password": "secret"}, &second)
+	if status := doJSON(t, ts, http.MethodPost, "/logout", second.Token, map[string]string{"refresh_token": second.RefreshToken}, nil); status != http.StatusOK {
+		t.Fatalf("logout: status %d", status)
+	}
+
+	if status := doJSON(t, ts, http.MethodGet, "/me", second.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("me after logout: expected 401, got %d", status)
+	}
+	status = doJSON(t, ts, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": second.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: expected 401, got %d", status)
+	}
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastMailToken busca en el outbox el ultimo correo enviado a email con un enlace a path y devuelve su token.
+func lastMailToken(t *testing.T, outbox string, email string, path string) string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(outbox, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	token := ""
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mail := string(content)
+		if !strings.Contains(mail, "To: "+email+"\r\n") || !strings.Contains(mail, path+"?token=") {
+			continue
+		}
+		if match := mailTokenPattern.FindStringSubmatch(mail); match != nil {
+			token = match[1]
+		}
+	}
+	if token == "" {
+		t.Fatalf("no %s mail found for %s", path, email)
+	}
+	return token
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+	outbox := t.TempDir()
+	ts := newTestServer(t, func(config *server.Config) {
+		config.MailOutboxDir = outbox
+		config.RequireVerifiedEmail = true
+	})
+
+	merchant := signUpMerchant(t, ts, "admin@store.com", "secret")
+	productId := createProduct(t, ts, merchant, "Mouse", 20, 5)
+
+	var session testTokens
+	signUp(t, ts, "ana@store.com", "secret")
+	doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": "ana@store.com", "password": "secret"}, &session)
+	doJSON(t, ts, http.MethodPost, "/addItem/"+productId, session.Token, map[string]int{"quantity": 1}, nil)
+
+	// sin verificar el email no se puede hacer checkout
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", session.Token, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("checkout unverified: expected 403, got %d", status)
+	}
+
+	verifyToken := lastMailToken(t, outbox, "ana@store.com", "/verify-email")
+	if status := doJSON(t, ts, http.MethodGet, "/verify-email?token="+verifyToken, "", nil, nil); status != http.StatusOK {
+		t.Fatalf("verify email: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/verify-email?token="+verifyToken, "", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("reused verify token: expected 400, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", session.Token, nil, nil); status != http.StatusCreated {
+		t.Fatalf("checkout verified: expected 201, got %d", status)
+	}
+
+	// un email desconocido responde igual para no revelar que usuarios existen
+	if status := doJSON(t, ts, http.MethodPost, "/password/forgot", "", map[string]string{"email": "nobody@store.com"}, nil); status != http.StatusOK {
+		t.Fatalf("forgot unknown email: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/password/forgot", "", map[string]string{"email": "ana@store.com"}, nil); status != http.StatusOK {
+		t.Fatalf("forgot password: status %d", status)
+	}
+
+	resetToken := lastMailToken(t, outbox, "ana@store.com", "/reset-password")
+	reset := map[string]string{"token": resetToken, "password": "new-secret"}
+	if status := doJSON(t, ts, http.MethodPost, "/password/reset", "", reset, nil); status != http.StatusOK {
+		t.Fatalf("reset password: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/password/reset", "", reset, nil); status != http.StatusBadRequest {
+		t.Fatalf("reused reset token: expected 400, got %d", status)
+	}
+
+	if status := doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": "ana@store.com", "password": "secret"}, nil); status != http.StatusUnauthorized {
+		t.Fatalf("login with old password: expected 401, got %d", status)
+	}
+	login(t, ts, "ana@store.com", "new-secret")
+
+	// el reseteo cierra las sesiones abiertas
+	status := doJSON(t, ts, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("refresh after reset: expected 401, got %d", status)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/kevintovar01/Store/server"
+)
+
+func TestCalls(t *testing.T) {
+	ts := newTestServer(t, func(config *server.Config) {
+		config.CallRingTimeout = 300 * time.Millisecond
+	})
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+	bob := signUp(t, ts, "bob@store.com", "secret")
+	productId := createProduct(t, ts, merchant, "Mirror", 20, 5)
+
+	var conversation struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodPost, "/conversations", ana, map[string]string{"product_id": productId}, &conversation)
+	var anaUser struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", ana, nil, &anaUser)
+
+	anaConn, _ := dialWebSocket(t, ts, ana)
+	phone, _ := dialWebSocket(t, ts, merchant)
+	laptop, _ := dialWebSocket(t, ts, merchant)
+	bobConn, _ := dialWebSocket(t, ts, bob)
+
+	var call struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+	startCall := func(conn *gorillaws.Conn, ringing ...*gorillaws.Conn) string {
+		t.Helper()
+		sendWebSocket(t, conn, "call_start", map[string]string{"conversation_id": conversation.Id})
+		json.Unmarshal(expectWebSocket(t, "call_ringing", conn).Payload, &call)
+		expectWebSocket(t, "call_ring", ringing...)
+		return call.Id
+	}
+
+	// suenan todas las conexiones del vendedor y contesta la del laptop
+	callId := startCall(anaConn, phone, laptop)
+	sendWebSocket(t, anaConn, "call_signal", map[string]interface{}{"call_id": callId, "kind": "offer", "data": map[string]string{"sdp": "v=0"}})
+	expectWebSocket(t, "error", anaConn)
+	sendWebSocket(t, bobConn, "call_accept", map[string]string{"call_id": callId})
+	expectWebSocket(t, "error", bobConn)
+	sendWebSocket(t, laptop, "call_accept", map[string]string{"call_id": callId})
+	expectWebSocket(t, "call_accepted", anaConn, phone, laptop)
+
+	// la señalizacion va solo entre las dos conexiones de la llamada
+	sendWebSocket(t, anaConn, "call_signal", map[string]interface{}{"call_id": callId, "kind": "offer", "data": map[string]string{"sdp": "v=0"}})
+	var signal struct {
+		Kind string          `json:"kind"`
+		Data json.RawMessage `json:"data"`
+		From string          `json:"from"`
+	}
+	json.Unmarshal(expectWebSocket(t, "call_signal", laptop).Payload, &signal)
+	if signal.Kind != "offer" || signal.From != anaUser.Id || string(signal.Data) != `{"sdp":"v=0"}` {
+		t.Fatalf("unexpected signal %+v", signal)
+	}
+	expectPong(t, phone)
+	sendWebSocket(t, laptop, "call_signal", map[string]interface{}{"call_id": callId, "kind": "candidate", "data": map[string]string{"candidate": "c"}})
+	expectWebSocket(t, "call_signal", anaConn)
+	sendWebSocket(t, phone, "call_signal", map[string]interface{}{"call_id": callId, "kind": "answer", "data": nil})
+	expectWebSocket(t, "error", phone)
+
+	sendWebSocket(t, anaConn, "call_hangup", map[string]string{"call_id": callId})
+	expectWebSocket(t, "call_ended", anaConn, phone, laptop)
+
+	// el vendedor llama y ana rechaza
+	callId = startCall(phone, anaConn)
+	sendWebSocket(t, anaConn, "call_reject", map[string]string{"call_id": callId})
+	expectWebSocket(t, "call_rejected", phone, anaConn)
+
+	// nadie contesta
+	startCall(anaConn, phone, laptop)
+	expectWebSocket(t, "call_timeout", anaConn, phone, laptop)
+
+	// si la conexion que contesto se cierra la llamada termina
+	callId = startCall(anaConn, phone, laptop)
+	sendWebSocket(t, phone, "call_accept", map[string]string{"call_id": callId})
+	expectWebSocket(t, "call_accepted", anaConn, phone, laptop)
+	phone.Close()
+	expectWebSocket(t, "call_ended", anaConn, laptop)
+
+	var calls []struct {
+		Status string `json:"status"`
+	}
+	doJSON(t, ts, http.MethodGet, "/calls", merchant, nil, &calls)
+	var statuses []string
+	for _, call := range calls {
+		statuses = append(statuses, call.Status)
+	}
+	if strings.Join(statuses, ",") != "ended,missed,rejected,ended" {
+		t.Fatalf("unexpected call log %v", statuses)
+	}
+	doJSON(t, ts, http.MethodGet, "/calls", bob, nil, &calls)
+	if len(calls) != 0 {
+		t.Fatalf("bob should have no calls, got %d", len(calls))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCategories(t *testing.T) {
+	ts := newTestServer(t)
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+
+	type category struct {
+		Id       string `json:"id"`
+		Name     string `json:"name"`
+		Slug     string `json:"slug"`
+		ParentId string `json:"parent_id"`
+	}
+	createCategory := func(name string, parentId string) category {
+		t.Helper()
+		var created category
+		if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": name, "parent_id": parentId}, &created); status != http.StatusCreated {
+			t.Fatalf("create category %s: %d", name, status)
+		}
+		return created
+	}
+
+	// solo quien tiene category:manage crea categorias
+	if status := doJSON(t, ts, http.MethodPost, "/categories", merchant, map[string]string{"name": "Ropa"}, nil); status != http.StatusForbidden {
+		t.Fatalf("create category as merchant: expected 403, got %d", status)
+	}
+	clothes := createCategory("Ropa", "")
+	if clothes.Slug != "ropa" {
+		t.Fatalf("unexpected slug %+v", clothes)
+	}
+	shirts := createCategory("T-Shirts de Hombre", clothes.Id)
+	if shirts.Slug != "t-shirts-de-hombre" || shirts.ParentId != clothes.Id {
+		t.Fatalf("unexpected subcategory %+v", shirts)
+	}
+	polos := createCategory("Polos", shirts.Id)
+	shoes := createCategory("Zapatos", "")
+
+	if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": "ropa"}, nil); status != http.StatusConflict {
+		t.Fatalf("duplicated slug: expected 409, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": "Gorras", "parent_id": "missing"}, nil); status != http.StatusBadRequest {
+		t.Fatalf("missing parent: expected 400, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": "Gorras", "slug": "Gorras!"}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid slug: expected 400, got %d", status)
+	}
+	// una categoria no puede quedar dentro de su propia descendiente
+	if status := doJSON(t, ts, http.MethodPut, "/categories/ropa", admin, map[string]string{"name": "Ropa", "parent_id": polos.Id}, nil); status != http.StatusBadRequest {
+		t.Fatalf("category cycle: expected 400, got %d", status)
+	}
+
+	var categories []category
+	if status := doJSON(t, ts, http.MethodGet, "/categories", "", nil, &categories); status != http.StatusOK || len(categories) != 4 {
+		t.Fatalf("list categories: %d %+v", status, categories)
+	}
+
+	polo := createProduct(t, ts, merchant, "Polo", 15, 3)
+	shirt := createProduct(t, ts, merchant, "Camisa", 20, 3)
+	boots := createProduct(t, ts, merchant, "Botas", 50, 3)
+	createProduct(t, ts, merchant, "Mouse", 10, 3)
+
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+polo+"/categories", other, map[string][]string{"categories": {"polos"}}, nil); status != http.StatusForbidden {
+		t.Fatalf("categorize someone else's product: expected 403, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+polo+"/categories", merchant, map[string][]string{"categories": {"missing"}}, nil); status != http.StatusBadRequest {
+		t.Fatalf("unknown category: expected 400, got %d", status)
+	}
+	for productId, slugs := range map[string][]string{polo: {polos.Slug}, shirt: {shirts.Slug}, boots: {shoes.Slug, clothes.Slug}} {
+		if status := doJSON(t, ts, http.MethodPut, "/products/"+productId+"/categories", merchant, map[string][]string{"categories": slugs}, nil); status != http.StatusOK {
+			t.Fatalf("categorize product: %d", status)
+		}
+	}
+
+	var detail struct {
+		Categories []category `json:"categories"`
+	}
+	doJSON(t, ts, http.MethodGet, "/products/"+boots, merchant, nil, &detail)
+	if len(detail.Categories) != 2 || detail.Categories[0].Slug != "ropa" || detail.Categories[1].Slug != "zapatos" {
+		t.Fatalf("unexpected product categories %+v", detail.Categories)
+	}
+
+	// la categoria incluye los productos de sus descendientes
+	productNames := func(slug string) []string {
+		t.Helper()
+		var products []struct {
+			Name string `json:"name"`
+		}
+		if status := doJSON(t, ts, http.MethodGet, "/categories/"+slug+"/products", "", nil, &products); status != http.StatusOK {
+			t.Fatalf("list %s products: %d", slug, status)
+		}
+		names := []string{}
+		for _, product := range products {
+			names = append(names, product.Name)
+		}
+		return names
+	}
+	for slug, expected := range map[string]string{
+		"ropa":               "Polo,Camisa,Botas",
+		"t-shirts-de-hombre": "Polo,Camisa",
+		"polos":              "Polo",
+		"zapatos":            "Botas",
+	} {
+		if names := strings.Join(productNames(slug), ","); names != expected {
+			t.Fatalf("%s products: expected %s, got %s", slug, expected, names)
+		}
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/categories/missing/products", "", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("unknown category products: expected 404, got %d", status)
+	}
+
+	// mover polos debajo de zapatos cambia lo que incluye cada rama
+	if status := doJSON(t, ts, http.MethodPut, "/categories/polos", admin, map[string]string{"name": "Polos", "parent_id": shoes.Id}, nil); status != http.StatusOK {
+		t.Fatalf("move category: %d", status)
+	}
+	if names := strings.Join(productNames("zapatos"), ","); names != "Polo,Botas" {
+		t.Fatalf("zapatos products after the move: %s", names)
+	}
+
+	if status := doJSON(t, ts, http.MethodDelete, "/categories/zapatos", admin, nil, nil); status != http.StatusConflict {
+		t.Fatalf("delete a category with subcategories: expected 409, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodDelete, "/categories/polos", admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete category: %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/categories/polos", "", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted category: expected 404, got %d", status)
+	}
+	if names := strings.Join(productNames("zapatos"), ","); names != "Botas" {
+		t.Fatalf("zapatos products after the delete: %s", names)
+	}
+}
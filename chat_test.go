@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+func TestChat(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+	bob := signUp(t, ts, "bob@store.com", "secret")
+	productId := createProduct(t, ts, merchant, "Mouse", 20, 5)
+
+	var me struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", merchant, nil, &me)
+
+	if status := doJSON(t, ts, http.MethodPost, "/conversations", merchant, map[string]string{"product_id": productId}, nil); status != http.StatusBadRequest {
+		t.Fatalf("conversation about your own product: expected 400, got %d", status)
+	}
+
+	type conversation struct {
+		Id          string `json:"id"`
+		ProductName string `json:"product_name"`
+		MerchantId  string `json:"merchant_id"`
+		Unread      int    `json:"unread"`
+		LastMessage *struct {
+			Body string `json:"body"`
+		} `json:"last_message"`
+	}
+	var started, again conversation
+	if status := doJSON(t, ts, http.MethodPost, "/conversations", ana, map[string]string{"product_id": productId}, &started); status != http.StatusCreated {
+		t.Fatalf("start conversation: %d", status)
+	}
+	if started.MerchantId != me.Id || started.ProductName != "Mouse" {
+		t.Fatalf("unexpected conversation %+v", started)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/conversations", ana, map[string]string{"product_id": productId}, &again); status != http.StatusOK || again.Id != started.Id {
+		t.Fatalf("reopen conversation: %d %+v", status, again)
+	}
+
+	anaConn, _ := dialWebSocket(t, ts, ana)
+	merchantConn, _ := dialWebSocket(t, ts, merchant)
+	bobConn, _ := dialWebSocket(t, ts, bob)
+
+	// un mensaje por websocket llega a los dos participantes
+	if err := anaConn.WriteJSON(map[string]interface{}{"type": "chat_send", "payload": map[string]string{"conversation_id": started.Id, "body": "Is it wireless?"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*gorillaws.Conn{anaConn, merchantConn} {
+		message := readWebSocket(t, conn)
+		if message.Type != "chat_message" || message.Seq == 0 || !strings.Contains(string(message.Payload), "Is it wireless?") {
+			t.Fatalf("chat message: unexpected %+v", message)
+		}
+	}
+
+	// escribiendo le llega solo al otro y sin seq
+	if err := merchantConn.WriteJSON(map[string]interface{}{"type": "chat_typing", "payload": map[string]string{"conversation_id": started.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, anaConn); message.Type != "chat_typing" || message.Seq != 0 {
+		t.Fatalf("typing: unexpected %+v", message)
+	}
+	expectPong(t, merchantConn)
+
+	// quien no participa no ve la conversacion
+	if status := doJSON(t, ts, http.MethodGet, "/conversations/"+started.Id+"/messages", bob, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("messages of someone else: expected 404, got %d", status)
+	}
+	if err := bobConn.WriteJSON(map[string]interface{}{"type": "chat_send", "payload": map[string]string{"conversation_id": started.Id, "body": "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, bobConn); message.Type != "error" {
+		t.Fatalf("chat in someone else's conversation: expected error, got %+v", message)
+	}
+
+	var inbox []conversation
+	doJSON(t, ts, http.MethodGet, "/conversations", merchant, nil, &inbox)
+	if len(inbox) != 1 || inbox[0].Unread != 1 || inbox[0].LastMessage == nil || inbox[0].LastMessage.Body != "Is it wireless?" {
+		t.Fatalf("merchant inbox: unexpected %+v", inbox)
+	}
+
+	// el acuse de lectura llega a los dos y deja la conversacion sin pendientes
+	if status := doJSON(t, ts, http.MethodPost, "/conversations/"+started.Id+"/read", merchant, nil, nil); status != http.StatusOK {
+		t.Fatalf("read conversation: %d", status)
+	}
+	for _, conn := range []*gorillaws.Conn{anaConn, merchantConn} {
+		if message := readWebSocket(t, conn); message.Type != "chat_read" {
+			t.Fatalf("read receipt: unexpected %+v", message)
+		}
+	}
+	doJSON(t, ts, http.MethodGet, "/conversations", merchant, nil, &inbox)
+	if inbox[0].Unread != 0 {
+		t.Fatalf("expected no unread messages, got %d", inbox[0].Unread)
+	}
+
+	// tambien se puede enviar por http
+	if status := doJSON(t, ts, http.MethodPost, "/conversations/"+started.Id+"/messages", merchant, map[string]string{"body": "Yes, bluetooth"}, nil); status != http.StatusCreated {
+		t.Fatalf("send message: %d", status)
+	}
+	if message := readWebSocket(t, anaConn); message.Type != "chat_message" {
+		t.Fatalf("chat message: unexpected %+v", message)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/conversations/"+started.Id+"/messages", merchant, map[string]string{"body": "  "}, nil); status != http.StatusBadRequest {
+		t.Fatalf("empty message: expected 400, got %d", status)
+	}
+
+	var history []struct {
+		Body   string     `json:"body"`
+		ReadAt *time.Time `json:"read_at"`
+	}
+	doJSON(t, ts, http.MethodGet, "/conversations/"+started.Id+"/messages", ana, nil, &history)
+	if len(history) != 2 || history[0].Body != "Yes, bluetooth" || history[1].ReadAt == nil {
+		t.Fatalf("history: unexpected %+v", history)
+	}
+	doJSON(t, ts, http.MethodGet, "/conversations/"+started.Id+"/messages?page=1", ana, nil, &history)
+	if len(history) != 0 {
+		t.Fatalf("second page: expected no messages, got %d", len(history))
+	}
+}
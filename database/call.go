@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+)
+
+const callColumns = "id, conversation_id, caller_id, callee_id, caller_client, COALESCE(callee_client, ''), status, created_at, answered_at, ended_at, ring_deadline"
+
+func scanCall(row interface{ Scan(dest ...any) error }, call *models.Call) error {
+	return row.Scan(
+		&call.Id,
+		&call.ConversationId,
+		&call.CallerId,
+		&call.CalleeId,
+		&call.CallerClient,
+		&call.CalleeClient,
+		&call.Status,
+		&call.CreatedAt,
+		&call.AnsweredAt,
+		&call.EndedAt,
+		&call.RingDeadline)
+}
+
+func (repo *PostgresRepository) InsertCall(ctx context.Context, call *models.Call) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO calls (id, conversation_id, caller_id, callee_id, caller_client, status, ring_deadline) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at",
+		call.Id,
+		call.ConversationId,
+		call.CallerId,
+		call.CalleeId,
+		call.CallerClient,
+		call.Status,
+		call.RingDeadline).Scan(&call.CreatedAt)
+}
+
+func (repo *PostgresRepository) GetCallById(ctx context.Context, id string) (*models.Call, error) {
+	var call = models.Call{}
+	err := scanCall(repo.db.QueryRowContext(ctx, "SELECT "+callColumns+" FROM calls WHERE id = $1", id), &call)
+	if err == sql.ErrNoRows {
+		return &models.Call{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// UpdateCall guarda el nuevo estado de la llamada si seguia en fromStatus.
+func (repo *PostgresRepository) UpdateCall(ctx context.Context, call *models.Call, fromStatus string) error {
+	result, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE calls SET status = $1, callee_client = NULLIF($2, ''), answered_at = $3, ended_at = $4 WHERE id = $5 AND status = $6",
+		call.Status,
+		call.CalleeClient,
+		call.AnsweredAt,
+		call.EndedAt,
+		call.Id,
+		fromStatus)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrCallStatusConflict
+	}
+	return nil
+}
+
+func (repo *PostgresRepository) ListCalls(ctx context.Context, userId string) ([]*models.Call, error) {
+	return repo.listCalls(ctx, "caller_id = $1 OR callee_id = $1 ORDER BY created_at DESC", userId)
+}
+
+func (repo *PostgresRepository) ListRingingCalls(ctx context.Context) ([]*models.Call, error) {
+	return repo.listCalls(ctx, "status = $1", models.CallRinging)
+}
+
+// listCalls lee las llamadas que cumplen where (y su ORDER BY si lo tiene).
+func (repo *PostgresRepository) listCalls(ctx context.Context, where string, args ...interface{}) ([]*models.Call, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT "+callColumns+" FROM calls WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var calls []*models.Call
+	for rows.Next() {
+		var call = models.Call{}
+		if err = scanCall(rows, &call); err != nil {
+			return nil, err
+		}
+		calls = append(calls, &call)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return calls, nil
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func (repo *PostgresRepository) InsertCategory(ctx context.Context, category *models.Category) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO categories (id, name, slug, parent_id) VALUES ($1, $2, $3, NULLIF($4, '')) RETURNING created_at",
+		category.Id,
+		category.Name,
+		category.Slug,
+		category.ParentId).Scan(&category.CreatedAt)
+}
+
+func (repo *PostgresRepository) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	var category = models.Category{}
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT id, name, slug, COALESCE(parent_id, ''), created_at FROM categories WHERE slug = $1",
+		slug).Scan(&category.Id, &category.Name, &category.Slug, &category.ParentId, &category.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &models.Category{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (repo *PostgresRepository) UpdateCategory(ctx context.Context, category *models.Category) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE categories SET name = $1, slug = $2, parent_id = NULLIF($3, '') WHERE id = $4",
+		category.Name,
+		category.Slug,
+		category.ParentId,
+		category.Id)
+	return err
+}
+
+func (repo *PostgresRepository) DeleteCategory(ctx context.Context, id string) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
+	return err
+}
+
+func (repo *PostgresRepository) ListCategories(ctx context.Context) ([]*models.Category, error) {
+	return repo.queryCategories(ctx, "SELECT id, name, slug, COALESCE(parent_id, ''), created_at FROM categories ORDER BY name, id")
+}
+
+func (repo *PostgresRepository) ListProductCategories(ctx context.Context, productId string) ([]*models.Category, error) {
+	return repo.queryCategories(
+		ctx,
+		`SELECT c.id, c.name, c.slug, COALESCE(c.parent_id, ''), c.created_at
+		 FROM categories c
+		 JOIN product_categories pc ON pc.category_id = c.id
+		 WHERE pc.product_id = $1
+		 ORDER BY c.name, c.id`,
+		productId)
+}
+
+func (repo *PostgresRepository) queryCategories(ctx context.Context, query string, args ...interface{}) ([]*models.Category, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var categories []*models.Category
+	for rows.Next() {
+		var category = models.Category{}
+		if err = rows.Scan(&category.Id, &category.Name, &category.Slug, &category.ParentId, &category.CreatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// SetProductCategories reemplaza las categorias del producto.
+func (repo *PostgresRepository) SetProductCategories(ctx context.Context, productId string, categoryIds []string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		_, err := tx.db.ExecContext(ctx, "DELETE FROM product_categories WHERE product_id = $1", productId)
+		if err != nil {
+			return err
+		}
+		for _, categoryId := range categoryIds {
+			_, err = tx.db.ExecContext(
+				ctx,
+				"INSERT INTO product_categories (product_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+				productId,
+				categoryId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListCategoryProducts devuelve los productos de la categoria y de todas sus subcategorias;
+// el CTE recursivo baja por parent_id desde la categoria pedida.
+func (repo *PostgresRepository) ListCategoryProducts(ctx context.Context, categoryId string, page uint64) ([]*models.ProductList, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		 )
+		 SELECT
+			p.id,
+			p.name,
+			p.price,
+			p.stock,
+			p.user_id,
+			p.description,
+			p.created_at
+		 FROM products p
+		 WHERE p.id IN (SELECT pc.product_id FROM product_categories pc JOIN tree t ON t.id = pc.category_id)
+		 ORDER BY p.created_at, p.id
+		 LIMIT $2 OFFSET $3`,
+		categoryId, PAGINATION_SIZE, page*PAGINATION_SIZE,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var products []*models.ProductList
+	for rows.Next() {
+		var product = models.ProductList{}
+		if err = rows.Scan(
+			&product.Id,
+			&product.Name,
+			&product.Price,
+			&product.Stock,
+			&product.User_id,
+			&product.Description,
+			&product.CreatedAt); err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return products, repo.attachImages(ctx, products...)
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+// mensajes por pagina del historial de una conversacion
+const CHAT_PAGE_SIZE = 50
+
+func (repo *PostgresRepository) InsertConversation(ctx context.Context, conversation *models.Conversation) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO conversations (id, product_id, customer_id, merchant_id) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		conversation.Id,
+		conversation.ProductId,
+		conversation.CustomerId,
+		conversation.MerchantId).Scan(&conversation.CreatedAt)
+}
+
+func (repo *PostgresRepository) GetConversationById(ctx context.Context, id string) (*models.Conversation, error) {
+	return repo.getConversation(ctx, "c.id = $1", id)
+}
+
+func (repo *PostgresRepository) FindConversation(ctx context.Context, productId string, customerId string) (*models.Conversation, error) {
+	return repo.getConversation(ctx, "c.product_id = $1 AND c.customer_id = $2", productId, customerId)
+}
+
+func (repo *PostgresRepository) getConversation(ctx context.Context, where string, args ...interface{}) (*models.Conversation, error) {
+	var conversation = models.Conversation{}
+	err := repo.db.QueryRowContext(
+		ctx,
+		`SELECT c.id, c.product_id, p.name, c.customer_id, c.merchant_id, c.created_at
+		 FROM conversations c
+		 JOIN products p ON p.id = c.product_id
+		 WHERE `+where,
+		args...).Scan(
+		&conversation.Id,
+		&conversation.ProductId,
+		&conversation.ProductName,
+		&conversation.CustomerId,
+		&conversation.MerchantId,
+		&conversation.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &models.Conversation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// ListConversations devuelve las conversaciones del usuario (como cliente o vendedor) con su ultimo
+// mensaje y cuantos mensajes del otro no ha leido, la de actividad mas reciente primero.
+func (repo *PostgresRepository) ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT
+			c.id,
+			c.product_id,
+			p.name,
+			c.customer_id,
+			c.merchant_id,
+			c.created_at,
+			m.id,
+			m.sender_id,
+			m.body,
+			m.created_at,
+			m.read_at,
+			(SELECT COUNT(*) FROM chat_messages u
+			 WHERE u.conversation_id = c.id AND u.sender_id <> $1 AND u.read_at IS NULL)
+		 FROM conversations c
+		 JOIN products p ON p.id = c.product_id
+		 LEFT JOIN LATERAL (
+			SELECT id, sender_id, body, created_at, read_at FROM chat_messages
+			WHERE conversation_id = c.id
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		 ) m ON true
+		 WHERE c.customer_id = $1 OR c.merchant_id = $1
+		 ORDER BY COALESCE(m.created_at, c.created_at) DESC`,
+		userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var conversations []*models.Conversation
+	for rows.Next() {
+		var conversation = models.Conversation{}
+		var messageId, senderId, body sql.NullString
+		var createdAt sql.NullTime
+		var readAt *time.Time
+		err = rows.Scan(
+			&conversation.Id,
+			&conversation.ProductId,
+			&conversation.ProductName,
+			&conversation.CustomerId,
+			&conversation.MerchantId,
+			&conversation.CreatedAt,
+			&messageId,
+			&senderId,
+			&body,
+			&createdAt,
+			&readAt,
+			&conversation.Unread)
+		if err != nil {
+			return nil, err
+		}
+		if messageId.Valid {
+			conversation.LastMessage = &models.ChatMessage{
+				Id:             messageId.String,
+				ConversationId: conversation.Id,
+				SenderId:       senderId.String,
+				Body:           body.String,
+				CreatedAt:      createdAt.Time,
+				ReadAt:         readAt,
+			}
+		}
+		conversations = append(conversations, &conversation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conversations, nil
+}
+
+func (repo *PostgresRepository) InsertChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO chat_messages (id, conversation_id, sender_id, body) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		message.Id,
+		message.ConversationId,
+		message.SenderId,
+		message.Body).Scan(&message.CreatedAt)
+}
+
+// ListChatMessages devuelve una pagina del historial, la pagina 0 son los mensajes mas recientes.
+func (repo *PostgresRepository) ListChatMessages(ctx context.Context, conversationId string, page uint64) ([]*models.ChatMessage, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT id, conversation_id, sender_id, body, created_at, read_at
+		 FROM chat_messages
+		 WHERE conversation_id = $1
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $2 OFFSET $3`,
+		conversationId, CHAT_PAGE_SIZE, page*CHAT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var messages []*models.ChatMessage
+	for rows.Next() {
+		var message = models.ChatMessage{}
+		if err = rows.Scan(&message.Id, &message.ConversationId, &message.SenderId, &message.Body, &message.CreatedAt, &message.ReadAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkChatRead marca como leidos los mensajes que el lector recibio y devuelve cuantos marco.
+func (repo *PostgresRepository) MarkChatRead(ctx context.Context, conversationId string, readerId string, readAt time.Time) (int64, error) {
+	result, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE chat_messages SET read_at = $3 WHERE conversation_id = $1 AND sender_id <> $2 AND read_at IS NULL",
+		conversationId, readerId, readAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/lib/pq"
+)
+
+func (repo *PostgresRepository) InsertHubEvent(ctx context.Context, event *models.HubEvent) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO hub_events (topics, type, payload) VALUES (COALESCE($1::TEXT[], '{}'), $2, $3) RETURNING seq, created_at",
+		pq.Array(event.Topics),
+		event.Type,
+		string(event.Payload)).Scan(&event.Seq, &event.CreatedAt)
+}
+
+func (repo *PostgresRepository) ListHubEvents(ctx context.Context, since int64, limit int) ([]*models.HubEvent, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT seq, topics, type, payload, created_at FROM hub_events WHERE seq >= $1 ORDER BY seq LIMIT $2",
+		since,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var events []*models.HubEvent
+	for rows.Next() {
+		var event = models.HubEvent{}
+		var payload []byte
+		if err = rows.Scan(&event.Seq, pq.Array(&event.Topics), &event.Type, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (repo *PostgresRepository) TrimHubEvents(ctx context.Context, keep int) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM hub_events WHERE seq <= (SELECT MAX(seq) FROM hub_events) - $1", keep)
+	return err
+}
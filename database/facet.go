@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/lib/pq"
+)
+
+// productSortKey devuelve la columna por la que ordena cada sort y si va de mayor a menor;
+// el id desempata en el mismo sentido para que el orden sirva de cursor.
+func productSortKey(sort string) (string, bool) {
+	switch sort {
+	case models.ProductSortNewest:
+		return "p.created_at", true
+	case models.ProductSortPriceAsc:
+		return "p.price", false
+	case models.ProductSortPriceDesc:
+		return "p.price", true
+	case models.ProductSortName:
+		return "p.name", false
+	default:
+		return "p.created_at", false
+	}
+}
+
+// productCursor es la posicion del producto en el orden de sort.
+func productCursor(sort string, product *models.ProductList) models.Cursor {
+	cursor := models.Cursor{Sort: sort, Id: product.Id}
+	switch sort {
+	case models.ProductSortPriceAsc, models.ProductSortPriceDesc:
+		cursor.Key = strconv.FormatFloat(product.Price, 'f', -1, 64)
+	case models.ProductSortName:
+		cursor.Key = product.Name
+	default:
+		cursor.Key = product.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// productFilterSQL arma las condiciones del WHERE sobre la tabla products (alias p) y agrega sus parametros a args.
+func productFilterSQL(filter models.ProductFilter, args []interface{}) (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.MinPrice != nil {
+		conditions = append(conditions, "p.price >= "+param(*filter.MinPrice))
+	}
+	if filter.MaxPrice != nil {
+		conditions = append(conditions, "p.price <= "+param(*filter.MaxPrice))
+	}
+	if filter.CategoryId != "" {
+		conditions = append(conditions, `p.id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = `+param(filter.CategoryId)+`
+				UNION
+				SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT pc.product_id FROM product_categories pc JOIN tree t ON t.id = pc.category_id
+		)`)
+	}
+	if filter.UserId != "" {
+		conditions = append(conditions, "p.user_id = "+param(filter.UserId))
+	}
+	if filter.InStock {
+		// un producto con variantes tiene stock si alguna de sus variantes lo tiene
+		conditions = append(conditions, "(p.stock > 0 OR EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.stock > 0))")
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "p.created_at > "+param(*filter.CreatedAfter))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ProductFacets cuenta por categoria (sin el filtro de categoria) y por rango de precio (sin el filtro de precio).
+func (repo *PostgresRepository) ProductFacets(ctx context.Context, filter *models.ProductFilter) (*models.ProductFacets, error) {
+	facets := &models.ProductFacets{Categories: []models.CategoryFacet{}, Prices: models.NewPriceFacets()}
+
+	withoutCategory := *filter
+	withoutCategory.CategoryId = ""
+	where, args := productFilterSQL(withoutCategory, nil)
+	// cada categoria cuenta los productos de todo su subarbol
+	err := repo.scanFacets(
+		ctx,
+		`WITH RECURSIVE tree AS (
+			SELECT id AS root, id FROM categories
+			UNION
+			SELECT t.root, c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		 )
+		 SELECT c.id, c.slug, c.name, COUNT(DISTINCT p.id)
+		 FROM tree t
+		 JOIN categories c ON c.id = t.root
+		 JOIN product_categories pc ON pc.category_id = t.id
+		 JOIN products p ON p.id = pc.product_id
+		 WHERE `+where+`
+		 GROUP BY c.id, c.slug, c.name
+		 ORDER BY c.name, c.id`,
+		args,
+		func(scan func(dest ...interface{}) error) error {
+			var facet models.CategoryFacet
+			if err := scan(&facet.Id, &facet.Slug, &facet.Name, &facet.Count); err != nil {
+				return err
+			}
+			facets.Categories = append(facets.Categories, facet)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	withoutPrice := *filter
+	withoutPrice.MinPrice, withoutPrice.MaxPrice = nil, nil
+	where, args = productFilterSQL(withoutPrice, []interface{}{pq.Array(models.PriceBuckets)})
+	// width_bucket devuelve 0 debajo del primer limite, igual que models.PriceBucket
+	err = repo.scanFacets(
+		ctx,
+		`SELECT width_bucket(p.price::float8, $1::float8[]) AS bucket, COUNT(*)
+		 FROM products p
+		 WHERE `+where+`
+		 GROUP BY bucket`,
+		args,
+		func(scan func(dest ...interface{}) error) error {
+			var bucket, count int
+			if err := scan(&bucket, &count); err != nil {
+				return err
+			}
+			facets.Prices[bucket].Count = count
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+func (repo *PostgresRepository) scanFacets(ctx context.Context, query string, args []interface{}, row func(scan func(dest ...interface{}) error) error) error {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	for rows.Next() {
+		if err = row(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
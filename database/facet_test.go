@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+)
+
+func TestProductFacets(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo repository.Repository) {
+		ctx := context.Background()
+		merchant := newTestUser(t, repo)
+		clothes := newTestCategory(t, repo, "Ropa", nil)
+		polos := newTestCategory(t, repo, "Polos", clothes)
+
+		polo := newTestProduct(t, repo, merchant, models.Product{Name: "Polo", Price: 15, Stock: 5})
+		shirt := newTestProduct(t, repo, merchant, models.Product{Name: "Camisa", Price: 40})
+		newTestProduct(t, repo, merchant, models.Product{Name: "Zapato", Price: 120, Stock: 3})
+		newTestProduct(t, repo, merchant, models.Product{Name: "Gorra", Price: 30, Stock: 2})
+		for product, category := range map[string]string{polo.Id: polos.Id, shirt.Id: clothes.Id} {
+			if err := repo.SetProductCategories(ctx, product, []string{category}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		names := map[string]string{clothes.Id: "ropa", polos.Id: "polos"}
+
+		price := func(value float64) *float64 { return &value }
+		// cada faceta se cuenta con todos los filtros menos el suyo; la base puede ser compartida,
+		// asi que todos los casos filtran por el comerciante del test
+		for _, test := range []struct {
+			name       string
+			filter     models.ProductFilter
+			categories string
+			prices     string
+		}{
+			{"no filters", models.ProductFilter{}, "polos:1 ropa:2", "[1 2 0 1 0]"},
+			{"price range", models.ProductFilter{MinPrice: price(20), MaxPrice: price(50)}, "ropa:1", "[1 2 0 1 0]"},
+			{"category", models.ProductFilter{CategoryId: clothes.Id}, "polos:1 ropa:2", "[1 1 0 0 0]"},
+			{"in stock subcategory", models.ProductFilter{InStock: true, CategoryId: polos.Id}, "polos:1 ropa:1", "[1 0 0 0 0]"},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				filter := test.filter
+				filter.UserId = merchant.Id
+				facets, err := repo.ProductFacets(ctx, &filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var categories []string
+				for _, facet := range facets.Categories {
+					categories = append(categories, fmt.Sprintf("%s:%d", names[facet.Id], facet.Count))
+				}
+				if strings.Join(categories, " ") != test.categories {
+					t.Fatalf("categories: expected %s, got %v", test.categories, categories)
+				}
+
+				var counts []int
+				for _, bucket := range facets.Prices {
+					counts = append(counts, bucket.Count)
+				}
+				if fmt.Sprint(counts) != test.prices {
+					t.Fatalf("prices: expected %s, got %v", test.prices, counts)
+				}
+				if last := facets.Prices[len(facets.Prices)-1]; last.Max != nil || last.Min != models.PriceBuckets[len(models.PriceBuckets)-1] {
+					t.Fatalf("last price bucket: %+v", last)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/lib/pq"
+)
+
+// LinkProductToImage agrega la imagen al final del producto; la primera imagen queda como primaria.
+func (repo *PostgresRepository) LinkProductToImage(ctx context.Context, productID string, imageID string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		// bloquea el producto para que dos subidas a la vez no tomen la misma posicion
+		if _, err := tx.db.ExecContext(ctx, "SELECT id FROM products WHERE id = $1 FOR UPDATE", productID); err != nil {
+			return err
+		}
+		_, err := tx.db.ExecContext(
+			ctx,
+			`INSERT INTO product_images (product_id, image_id, position, is_primary)
+			 SELECT $1::varchar, $2::uuid, COUNT(*), COUNT(*) = 0 FROM product_images WHERE product_id = $1`,
+			productID,
+			imageID,
+		)
+		return err
+	})
+}
+
+func (repo *PostgresRepository) ListProductImages(ctx context.Context, productId string) ([]*models.ProductImage, error) {
+	images, err := repo.productImages(ctx, []string{productId})
+	if err != nil {
+		return nil, err
+	}
+	return images[productId], nil
+}
+
+// productImages trae en una consulta las imagenes ordenadas de varios productos.
+func (repo *PostgresRepository) productImages(ctx context.Context, productIds []string) (map[string][]*models.ProductImage, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT pi.product_id, i.id, i.url, pi.position, pi.is_primary
+		 FROM product_images pi
+		 JOIN images i ON i.id = pi.image_id
+		 WHERE pi.product_id = ANY($1)
+		 ORDER BY pi.product_id, pi.position`,
+		pq.Array(productIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	images := make(map[string][]*models.ProductImage, len(productIds))
+	for rows.Next() {
+		var productId string
+		var image = models.ProductImage{}
+		if err = rows.Scan(&productId, &image.Id, &image.Url, &image.Position, &image.Primary); err != nil {
+			return nil, err
+		}
+		images[productId] = append(images[productId], &image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// attachImages completa Images y Url (la primaria o la imagen por defecto) de los productos.
+func (repo *PostgresRepository) attachImages(ctx context.Context, products ...*models.ProductList) error {
+	ids := make([]string, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.Id)
+	}
+	images, err := repo.productImages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		setProductImages(product, images[product.Id])
+	}
+	return nil
+}
+
+// setProductImages es comun a postgres y memoria.
+func setProductImages(product *models.ProductList, images []*models.ProductImage) {
+	product.Url = defaultProductImage
+	product.Images = images
+	if product.Images == nil {
+		product.Images = []*models.ProductImage{}
+	}
+	for _, image := range product.Images {
+		if image.Primary {
+			product.Url = image.Url
+		}
+	}
+}
+
+// ReorderProductImages guarda el orden de imageIds, que deben ser todas las imagenes del producto.
+func (repo *PostgresRepository) ReorderProductImages(ctx context.Context, productId string, imageIds []string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		for position, imageId := range imageIds {
+			_, err := tx.db.ExecContext(
+				ctx,
+				"UPDATE product_images SET position = $1 WHERE product_id = $2 AND image_id = $3",
+				position,
+				productId,
+				imageId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (repo *PostgresRepository) SetPrimaryProductImage(ctx context.Context, productId string, imageId string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		// primero se apaga la actual por el indice unico de la primaria
+		_, err := tx.db.ExecContext(ctx, "UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary", productId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(
+			ctx,
+			"UPDATE product_images SET is_primary = TRUE WHERE product_id = $1 AND image_id = $2",
+			productId,
+			imageId)
+		return err
+	})
+}
+
+// UnlinkProductImage quita la imagen del producto, corre las posiciones siguientes y,
+// si era la primaria, la primera que queda pasa a serlo.
+func (repo *PostgresRepository) UnlinkProductImage(ctx context.Context, productId string, imageId string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		var position int
+		var primary bool
+		err := tx.db.QueryRowContext(
+			ctx,
+			"DELETE FROM product_images WHERE product_id = $1 AND image_id = $2 RETURNING position, is_primary",
+			productId,
+			imageId).Scan(&position, &primary)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(
+			ctx,
+			"UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2",
+			productId,
+			position)
+		if err != nil || !primary {
+			return err
+		}
+		_, err = tx.db.ExecContext(
+			ctx,
+			`UPDATE product_images SET is_primary = TRUE
+			 WHERE product_id = $1 AND position = (SELECT MIN(position) FROM product_images WHERE product_id = $1)`,
+			productId)
+		return err
+	})
+}
+
+// DeleteUnusedImage borra la imagen si ningun producto ni variante la usa y devuelve si la borro.
+func (repo *PostgresRepository) DeleteUnusedImage(ctx context.Context, imageId string) (bool, error) {
+	result, err := repo.db.ExecContext(
+		ctx,
+		`DELETE FROM images i WHERE i.id = $1
+		 AND NOT EXISTS (SELECT 1 FROM product_images WHERE image_id = i.id)
+		 AND NOT EXISTS (SELECT 1 FROM variant_images WHERE image_id = i.id)`,
+		imageId)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// CountImagesByUrl cuenta las imagenes que apuntan al mismo archivo; dos subidas con el mismo nombre el mismo dia lo comparten.
+func (repo *PostgresRepository) CountImagesByUrl(ctx context.Context, url string) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM images WHERE url = $1", url).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+)
+
+// las imagenes de un producto van en position 0..n-1 y solo una es la primaria
+func TestProductImageOrdering(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo repository.Repository) {
+		ctx := context.Background()
+		merchant := newTestUser(t, repo)
+		shirt := newTestProduct(t, repo, merchant, models.Product{Name: "Camiseta", Price: 20, Stock: 1})
+		hat := newTestProduct(t, repo, merchant, models.Product{Name: "Gorra", Price: 10, Stock: 1})
+
+		ids := map[string]string{}   // nombre -> id
+		names := map[string]string{} // id -> nombre
+		link := func(product *models.Product, name string) {
+			t.Helper()
+			id, err := repo.InsertImage(ctx, &models.Image{UserId: merchant.Id, Url: "/uploads/" + name, Name: name, Type: "image/jpeg", Size: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = repo.LinkProductToImage(ctx, product.Id, id); err != nil {
+				t.Fatal(err)
+			}
+			ids[name], names[id] = id, name
+		}
+		// expect revisa el orden y la primaria (marcada con *)
+		expect := func(step string, product *models.Product, expected string) {
+			t.Helper()
+			images, err := repo.ListProductImages(ctx, product.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for i, image := range images {
+				if image.Position != i {
+					t.Fatalf("%s: %s has position %d at index %d", step, names[image.Id], image.Position, i)
+				}
+				name := names[image.Id]
+				if image.Primary {
+					name += "*"
+				}
+				got = append(got, name)
+			}
+			if strings.Join(got, " ") != expected {
+				t.Fatalf("%s: expected %s, got %v", step, expected, got)
+			}
+		}
+
+		for _, name := range []string{"a", "b", "c"} {
+			link(shirt, name)
+		}
+		link(hat, "d")
+		expect("link", shirt, "a* b c")
+		expect("link to another product", hat, "d*")
+
+		for _, step := range []struct {
+			name     string
+			run      func() error
+			expected string
+		}{
+			{"reorder", func() error { return repo.ReorderProductImages(ctx, shirt.Id, []string{ids["c"], ids["a"], ids["b"]}) }, "c a* b"},
+			{"set primary", func() error { return repo.SetPrimaryProductImage(ctx, shirt.Id, ids["b"]) }, "c a b*"},
+			{"unlink from the middle", func() error { return repo.UnlinkProductImage(ctx, shirt.Id, ids["a"]) }, "c b*"},
+			{"unlink the primary", func() error { return repo.UnlinkProductImage(ctx, shirt.Id, ids["b"]) }, "c*"},
+			{"link after unlinking", func() error { link(shirt, "e"); return nil }, "c* e"},
+		} {
+			if err := step.run(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			expect(step.name, shirt, step.expected)
+		}
+		expect("other product untouched", hat, "d*")
+
+		if err := repo.UnlinkProductImage(ctx, shirt.Id, ids["d"]); err == nil {
+			t.Fatal("unlinked an image of another product")
+		}
+	})
+}
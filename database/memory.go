@@ -0,0 +1,1838 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	defaultProductImage = "/uploads/default/product.jpg"
+)
+
+// memoryState son las "tablas" del repositorio en memoria.
+// Se guardan valores (no punteros) para que nadie fuera del repositorio pueda modificarlas.
+type memoryState struct {
+	users         map[string]models.User
+	business      map[string]models.Bussinessman // por user_id
+	products      map[string]models.Product
+	images        map[string]models.Image
+	productImages []models.ImageLink
+	options       map[string]models.ProductOption
+	variants      map[string]models.Variant // sin Images, se arman con variantImages
+	variantImages map[string][]string       // variant_id -> image_ids en orden
+	categories    map[string]models.Category
+	productCats   map[string]map[string]bool // product_id -> category_ids
+	wishcars      map[string]models.Car
+	carItems      map[string]models.CarItem
+	roles         map[int]models.Role
+	nextRoleId    int
+	usersRoles    map[string]map[int]bool
+	permissions   map[int]models.Permission
+	rolePerms     map[int]map[int]bool // role_id -> permission_id
+	grantAudit    []models.GrantAudit
+	hubEvents     []models.HubEvent
+	conversations map[string]models.Conversation
+	chatMessages  map[string][]models.ChatMessage // por conversation_id, en orden de envio
+	calls         map[string]models.Call
+	nextHubSeq    int64
+	orders        map[string]models.Order // sin items, se guardan en orderItems
+	orderItems    map[string][]models.OrderItem
+	orderHistory  map[string][]models.OrderStatusChange
+	refreshTokens map[string]models.RefreshToken // por id
+	revokedTokens map[string]time.Time           // jti -> expiracion
+	userTokens    map[string]models.UserToken    // por id
+	lastSeen      map[string]time.Time           // por user_id
+}
+
+func newMemoryState() *memoryState {
+	state := &memoryState{
+		users:         make(map[string]models.User),
+		business:      make(map[string]models.Bussinessman),
+		products:      make(map[string]models.Product),
+		images:        make(map[string]models.Image),
+		options:       make(map[string]models.ProductOption),
+		variants:      make(map[string]models.Variant),
+		variantImages: make(map[string][]string),
+		categories:    make(map[string]models.Category),
+		productCats:   make(map[string]map[string]bool),
+		wishcars:      make(map[string]models.Car),
+		carItems:      make(map[string]models.CarItem),
+		roles:         make(map[int]models.Role),
+		nextRoleId:    1,
+		nextHubSeq:    1,
+		usersRoles:    make(map[string]map[int]bool),
+		permissions:   make(map[int]models.Permission),
+		rolePerms:     make(map[int]map[int]bool),
+		conversations: make(map[string]models.Conversation),
+		chatMessages:  make(map[string][]models.ChatMessage),
+		calls:         make(map[string]models.Call),
+		orders:        make(map[string]models.Order),
+		orderItems:    make(map[string][]models.OrderItem),
+		orderHistory:  make(map[string][]models.OrderStatusChange),
+		refreshTokens: make(map[string]models.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		userTokens:    make(map[string]models.UserToken),
+		lastSeen:      make(map[string]time.Time),
+	}
+
+	// igual que las migraciones: admin tiene todos los permisos y merchant los de la tienda
+	permissions := []string{
+		models.PermissionProductWrite,
+		models.PermissionOrderRead,
+		models.PermissionOrderUpdate,
+		models.PermissionOrderRefund,
+		models.PermissionRoleManage,
+		models.PermissionCategoryManage,
+	}
+	for i, name := range permissions {
+		state.permissions[i+1] = models.Permission{Id: i + 1, Name: name}
+	}
+
+	grants := map[string][]string{
+		"admin":    permissions,
+		"merchant": {models.PermissionProductWrite},
+	}
+	for _, name := range []string{"admin", "merchant"} {
+		roleId := state.nextRoleId
+		state.roles[roleId] = models.Role{Id: roleId, Name: name, CreatedAt: time.Now()}
+		state.rolePerms[roleId] = make(map[int]bool)
+		state.nextRoleId++
+		for _, permission := range grants[name] {
+			for id, p := range state.permissions {
+				if p.Name == permission {
+					state.rolePerms[roleId][id] = true
+				}
+			}
+		}
+	}
+
+	return state
+}
+
+// clone copia el estado completo, se usa para poder hacer rollback de una transaccion.
+func (s *memoryState) clone() memoryState {
+	c := *s
+	c.users = copyMap(s.users)
+	c.business = copyMap(s.business)
+	c.products = copyMap(s.products)
+	c.images = copyMap(s.images)
+	c.productImages = append([]models.ImageLink(nil), s.productImages...)
+	c.options = copyMap(s.options)
+	c.variants = copyMap(s.variants)
+	c.variantImages = make(map[string][]string, len(s.variantImages))
+	for variantId, images := range s.variantImages {
+		c.variantImages[variantId] = append([]string(nil), images...)
+	}
+	c.categories = copyMap(s.categories)
+	c.productCats = make(map[string]map[string]bool, len(s.productCats))
+	for productId, categories := range s.productCats {
+		c.productCats[productId] = copyMap(categories)
+	}
+	c.wishcars = copyMap(s.wishcars)
+	c.carItems = copyMap(s.carItems)
+	c.roles = copyMap(s.roles)
+	c.usersRoles = make(map[string]map[int]bool, len(s.usersRoles))
+	for userId, roles := range s.usersRoles {
+		c.usersRoles[userId] = copyMap(roles)
+	}
+	c.permissions = copyMap(s.permissions)
+	c.rolePerms = make(map[int]map[int]bool, len(s.rolePerms))
+	for roleId, permissions := range s.rolePerms {
+		c.rolePerms[roleId] = copyMap(permissions)
+	}
+	c.grantAudit = append([]models.GrantAudit(nil), s.grantAudit...)
+	c.hubEvents = append([]models.HubEvent(nil), s.hubEvents...)
+	c.conversations = copyMap(s.conversations)
+	c.calls = copyMap(s.calls)
+	c.chatMessages = make(map[string][]models.ChatMessage, len(s.chatMessages))
+	for conversationId, messages := range s.chatMessages {
+		c.chatMessages[conversationId] = append([]models.ChatMessage(nil), messages...)
+	}
+	c.orders = copyMap(s.orders)
+	c.orderItems = make(map[string][]models.OrderItem, len(s.orderItems))
+	for orderId, items := range s.orderItems {
+		c.orderItems[orderId] = append([]models.OrderItem(nil), items...)
+	}
+	c.orderHistory = make(map[string][]models.OrderStatusChange, len(s.orderHistory))
+	for orderId, history := range s.orderHistory {
+		c.orderHistory[orderId] = append([]models.OrderStatusChange(nil), history...)
+	}
+	c.refreshTokens = copyMap(s.refreshTokens)
+	c.revokedTokens = copyMap(s.revokedTokens)
+	c.userTokens = copyMap(s.userTokens)
+	c.lastSeen = copyMap(s.lastSeen)
+	return c
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// MemoryRepository implementa repository.Repository guardando todo en memoria.
+// Sirve para pruebas y demos locales sin Postgres; los datos se pierden al reiniciar.
+type MemoryRepository struct {
+	mu    *sync.Mutex
+	state *memoryState
+	inTx  bool // true cuando el repositorio ya tiene tomado el mutex dentro de WithTx
+}
+
+var _ repository.Repository = (*MemoryRepository)(nil)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		mu:    &sync.Mutex{},
+		state: newMemoryState(),
+	}
+}
+
+// lock toma el mutex, salvo dentro de una transaccion donde ya esta tomado.
+func (repo *MemoryRepository) lock() func() {
+	if repo.inTx {
+		return func() {}
+	}
+	repo.mu.Lock()
+	return repo.mu.Unlock
+}
+
+// WithTx mantiene el mutex durante toda la funcion, asi las transacciones son serializables,
+// y si fn falla restaura la copia del estado tomada al inicio.
+// Dentro de fn solo debe usarse el repositorio recibido, nunca las funciones del paquete repository.
+func (repo *MemoryRepository) WithTx(ctx context.Context, fn func(repository.Repository) error) (err error) {
+	if repo.inTx {
+		return fn(repo)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	snapshot := repo.state.clone()
+	defer func() {
+		if p := recover(); p != nil {
+			*repo.state = snapshot
+			panic(p)
+		}
+	}()
+
+	if err = fn(&MemoryRepository{mu: repo.mu, state: repo.state, inTx: true}); err != nil {
+		*repo.state = snapshot
+	}
+	return err
+}
+
+func (repo *MemoryRepository) Close() error {
+	return nil
+}
+
+// users
+
+func (repo *MemoryRepository) InsertUser(ctx context.Context, user *models.User) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[user.Id]; ok {
+		return fmt.Errorf("user %s already exists", user.Id)
+	}
+	for _, u := range repo.state.users {
+		if u.Email == user.Email {
+			return fmt.Errorf("email %s already exists", user.Email)
+		}
+	}
+	repo.state.users[user.Id] = *user
+	return nil
+}
+
+func (repo *MemoryRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	defer repo.lock()()
+	user := repo.state.users[id]
+	// igual que en postgres, la contraseña no se devuelve
+	return &models.User{Id: user.Id, Email: user.Email, EmailVerifiedAt: user.EmailVerifiedAt}, nil
+}
+
+func (repo *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer repo.lock()()
+	for _, user := range repo.state.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return &models.User{}, nil
+}
+
+func (repo *MemoryRepository) InsertUserBusiness(ctx context.Context, bussinessman *models.Bussinessman) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[bussinessman.UserId]; !ok {
+		return fmt.Errorf("user %s does not exist", bussinessman.UserId)
+	}
+	if _, ok := repo.state.business[bussinessman.UserId]; ok {
+		return fmt.Errorf("business for user %s already exists", bussinessman.UserId)
+	}
+	repo.state.business[bussinessman.UserId] = *bussinessman
+	return nil
+}
+
+// tokens
+
+func (repo *MemoryRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[token.UserId]; !ok {
+		return fmt.Errorf("user %s does not exist", token.UserId)
+	}
+	for _, t := range repo.state.refreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return errors.New("refresh token already exists")
+		}
+	}
+	token.Id = ksuid.New().String()
+	token.CreatedAt = time.Now()
+	repo.state.refreshTokens[token.Id] = *token
+	return nil
+}
+
+func (repo *MemoryRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	defer repo.lock()()
+	for _, token := range repo.state.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return &models.RefreshToken{}, nil
+}
+
+func (repo *MemoryRepository) RevokeRefreshToken(ctx context.Context, id string) error {
+	defer repo.lock()()
+	token, ok := repo.state.refreshTokens[id]
+	if !ok || token.RevokedAt != nil {
+		return repository.ErrRefreshTokenRevoked
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	repo.state.refreshTokens[id] = token
+	return nil
+}
+
+func (repo *MemoryRepository) RevokeRefreshFamily(ctx context.Context, familyId string) error {
+	defer repo.lock()()
+	now := time.Now()
+	for id, token := range repo.state.refreshTokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			repo.state.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	defer repo.lock()()
+	now := time.Now()
+	for id, expiration := range repo.state.revokedTokens {
+		if expiration.Before(now) {
+			delete(repo.state.revokedTokens, id)
+		}
+	}
+	if _, ok := repo.state.revokedTokens[jti]; !ok {
+		repo.state.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	defer repo.lock()()
+	_, ok := repo.state.revokedTokens[jti]
+	return ok, nil
+}
+
+func (repo *MemoryRepository) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	defer repo.lock()()
+	now := time.Now()
+	for id, token := range repo.state.refreshTokens {
+		if token.UserId == userId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			repo.state.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) InsertUserToken(ctx context.Context, token *models.UserToken) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[token.UserId]; !ok {
+		return fmt.Errorf("user %s does not exist", token.UserId)
+	}
+	token.Id = ksuid.New().String()
+	token.CreatedAt = time.Now()
+	repo.state.userTokens[token.Id] = *token
+	return nil
+}
+
+func (repo *MemoryRepository) UseUserToken(ctx context.Context, tokenHash string, purpose string) (*models.UserToken, error) {
+	defer repo.lock()()
+	now := time.Now()
+	for id, token := range repo.state.userTokens {
+		if token.TokenHash == tokenHash && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			repo.state.userTokens[id] = token
+			return &token, nil
+		}
+	}
+	return &models.UserToken{}, nil
+}
+
+func (repo *MemoryRepository) UpdatePassword(ctx context.Context, userId string, password string) error {
+	defer repo.lock()()
+	if user, ok := repo.state.users[userId]; ok {
+		user.Password = password
+		repo.state.users[userId] = user
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) SetEmailVerified(ctx context.Context, userId string) error {
+	defer repo.lock()()
+	if user, ok := repo.state.users[userId]; ok && user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		repo.state.users[userId] = user
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[userId]; ok {
+		repo.state.lastSeen[userId] = lastSeen
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) GetLastSeen(ctx context.Context, userId string) (*time.Time, error) {
+	defer repo.lock()()
+	lastSeen, ok := repo.state.lastSeen[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &lastSeen, nil
+}
+
+// products
+
+func (repo *MemoryRepository) InsertProduct(ctx context.Context, product *models.Product) error {
+	defer repo.lock()()
+	if _, ok := repo.state.products[product.Id]; ok {
+		return fmt.Errorf("product %s already exists", product.Id)
+	}
+	if _, ok := repo.state.users[product.User_id]; !ok {
+		return fmt.Errorf("user %s does not exist", product.User_id)
+	}
+	product.CreatedAt = time.Now()
+	repo.state.products[product.Id] = *product
+	return nil
+}
+
+func (repo *MemoryRepository) GetProductById(ctx context.Context, id string) (*models.ProductList, error) {
+	defer repo.lock()()
+	product, ok := repo.state.products[id]
+	if !ok {
+		return &models.ProductList{}, nil
+	}
+	return repo.toProductList(product), nil
+}
+
+func (repo *MemoryRepository) UpdateProduct(ctx context.Context, product *models.Product) error {
+	defer repo.lock()()
+	current, ok := repo.state.products[product.Id]
+	if !ok || current.User_id != product.User_id {
+		return nil
+	}
+	current.Name = product.Name
+	current.Description = product.Description
+	current.Price = product.Price
+	current.Stock = product.Stock
+	repo.state.products[product.Id] = current
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteProduct(ctx context.Context, id string, userId string) error {
+	defer repo.lock()()
+	product, ok := repo.state.products[id]
+	if !ok || product.User_id != userId {
+		return nil
+	}
+	delete(repo.state.products, id)
+
+	// ON DELETE CASCADE
+	for itemId, item := range repo.state.carItems {
+		if item.ProductId == id {
+			delete(repo.state.carItems, itemId)
+		}
+	}
+	links := repo.state.productImages[:0]
+	for _, link := range repo.state.productImages {
+		if link.ProductId != id {
+			links = append(links, link)
+		}
+	}
+	repo.state.productImages = links
+	delete(repo.state.productCats, id)
+	for optionId, option := range repo.state.options {
+		if option.ProductId == id {
+			delete(repo.state.options, optionId)
+		}
+	}
+	for variantId, variant := range repo.state.variants {
+		if variant.ProductId == id {
+			delete(repo.state.variants, variantId)
+			delete(repo.state.variantImages, variantId)
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) ListProduct(ctx context.Context, filter *models.ProductFilter, request models.PageRequest) (*models.Page[*models.ProductList], error) {
+	defer repo.lock()()
+	products := repo.filterProducts(*filter)
+	sortProducts(products, filter.Sort)
+
+	productList := make([]*models.ProductList, 0, len(products))
+	for _, product := range products {
+		productList = append(productList, repo.toProductList(product))
+	}
+	cursor := func(product *models.ProductList) models.Cursor { return productCursor(filter.Sort, product) }
+	return memoryPage(productList, request, cursor, compareProductCursor), nil
+}
+
+// filterProducts devuelve los productos que cumplen filter, como productFilterSQL.
+func (repo *MemoryRepository) filterProducts(filter models.ProductFilter) []models.Product {
+	var tree map[string]bool
+	if filter.CategoryId != "" {
+		tree = repo.categoryTree(filter.CategoryId)
+	}
+
+	var products []models.Product
+	for _, product := range repo.state.products {
+		switch {
+		case filter.MinPrice != nil && product.Price < *filter.MinPrice,
+			filter.MaxPrice != nil && product.Price > *filter.MaxPrice,
+			filter.UserId != "" && product.User_id != filter.UserId,
+			filter.InStock && product.Stock <= 0 && !repo.hasVariantStock(product.Id),
+			filter.CreatedAfter != nil && !product.CreatedAt.After(*filter.CreatedAfter),
+			tree != nil && !repo.inCategories(product.Id, tree):
+			continue
+		}
+		products = append(products, product)
+	}
+	return products
+}
+
+// hasVariantStock indica si alguna variante del producto tiene unidades.
+func (repo *MemoryRepository) hasVariantStock(productId string) bool {
+	for _, variant := range repo.state.variants {
+		if variant.ProductId == productId && variant.Stock > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortProducts ordena igual que productSortKey.
+func sortProducts(products []models.Product, order string) {
+	sort.Slice(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		var c int
+		switch order {
+		case models.ProductSortPriceAsc, models.ProductSortPriceDesc:
+			c = cmp.Compare(a.Price, b.Price)
+		case models.ProductSortName:
+			c = strings.Compare(a.Name, b.Name)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Id, b.Id)
+		}
+		if _, desc := productSortKey(order); desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareProductCursor compara el producto con la posicion del cursor en el orden de cursor.Sort.
+func compareProductCursor(product *models.ProductList, cursor models.Cursor) int {
+	var c int
+	switch cursor.Sort {
+	case models.ProductSortPriceAsc, models.ProductSortPriceDesc:
+		price, _ := strconv.ParseFloat(cursor.Key, 64)
+		c = cmp.Compare(product.Price, price)
+	case models.ProductSortName:
+		c = strings.Compare(product.Name, cursor.Key)
+	default:
+		createdAt, _ := time.Parse(time.RFC3339Nano, cursor.Key)
+		c = product.CreatedAt.Compare(createdAt)
+	}
+	if c == 0 {
+		c = strings.Compare(product.Id, cursor.Id)
+	}
+	if _, desc := productSortKey(cursor.Sort); desc {
+		return -c
+	}
+	return c
+}
+
+func (repo *MemoryRepository) ProductFacets(ctx context.Context, filter *models.ProductFilter) (*models.ProductFacets, error) {
+	defer repo.lock()()
+	facets := &models.ProductFacets{Categories: []models.CategoryFacet{}, Prices: models.NewPriceFacets()}
+
+	withoutCategory := *filter
+	withoutCategory.CategoryId = ""
+	products := repo.filterProducts(withoutCategory)
+	for _, category := range repo.sortedCategories(func(models.Category) bool { return true }) {
+		tree := repo.categoryTree(category.Id)
+		count := 0
+		for _, product := range products {
+			if repo.inCategories(product.Id, tree) {
+				count++
+			}
+		}
+		if count > 0 {
+			facets.Categories = append(facets.Categories, models.CategoryFacet{
+				Id: category.Id, Slug: category.Slug, Name: category.Name, Count: count,
+			})
+		}
+	}
+
+	withoutPrice := *filter
+	withoutPrice.MinPrice, withoutPrice.MaxPrice = nil, nil
+	for _, product := range repo.filterProducts(withoutPrice) {
+		facets.Prices[models.PriceBucket(product.Price)].Count++
+	}
+	return facets, nil
+}
+
+func (repo *MemoryRepository) toProductList(product models.Product) *models.ProductList {
+	productList := &models.ProductList{
+		Id:          product.Id,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Stock:       product.Stock,
+		User_id:     product.User_id,
+		CreatedAt:   product.CreatedAt,
+	}
+	setProductImages(productList, repo.productImageList(product.Id))
+	return productList
+}
+
+// productImageList arma las imagenes del producto ordenadas por position.
+func (repo *MemoryRepository) productImageList(productId string) []*models.ProductImage {
+	var images []*models.ProductImage
+	for _, link := range repo.state.productImages {
+		if link.ProductId == productId {
+			images = append(images, &models.ProductImage{
+				Id:       link.ImageId,
+				Url:      repo.state.images[link.ImageId].Url,
+				Position: link.Position,
+				Primary:  link.Primary,
+			})
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images
+}
+
+func (repo *MemoryRepository) InsertImage(ctx context.Context, image *models.Image) (string, error) {
+	defer repo.lock()()
+	if _, ok := repo.state.users[image.UserId]; !ok {
+		return "", fmt.Errorf("user %s does not exist", image.UserId)
+	}
+	id := ksuid.New().String()
+	image.CreatedAt = time.Now()
+	repo.state.images[id] = *image
+	return id, nil
+}
+
+func (repo *MemoryRepository) LinkProductToImage(ctx context.Context, productID string, imageID string) error {
+	defer repo.lock()()
+	if _, ok := repo.state.products[productID]; !ok {
+		return fmt.Errorf("product %s does not exist", productID)
+	}
+	if _, ok := repo.state.images[imageID]; !ok {
+		return fmt.Errorf("image %s does not exist", imageID)
+	}
+	count := 0
+	for _, link := range repo.state.productImages {
+		if link.ProductId == productID && link.ImageId == imageID {
+			return fmt.Errorf("image %s already linked to product %s", imageID, productID)
+		}
+		if link.ProductId == productID {
+			count++
+		}
+	}
+	repo.state.productImages = append(repo.state.productImages, models.ImageLink{
+		ProductId: productID,
+		ImageId:   imageID,
+		Position:  count,
+		Primary:   count == 0,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (repo *MemoryRepository) ListProductImages(ctx context.Context, productId string) ([]*models.ProductImage, error) {
+	defer repo.lock()()
+	return repo.productImageList(productId), nil
+}
+
+func (repo *MemoryRepository) ReorderProductImages(ctx context.Context, productId string, imageIds []string) error {
+	defer repo.lock()()
+	positions := make(map[string]int, len(imageIds))
+	for position, imageId := range imageIds {
+		positions[imageId] = position
+	}
+	for i, link := range repo.state.productImages {
+		if position, ok := positions[link.ImageId]; ok && link.ProductId == productId {
+			repo.state.productImages[i].Position = position
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) SetPrimaryProductImage(ctx context.Context, productId string, imageId string) error {
+	defer repo.lock()()
+	for i, link := range repo.state.productImages {
+		if link.ProductId == productId {
+			repo.state.productImages[i].Primary = link.ImageId == imageId
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) UnlinkProductImage(ctx context.Context, productId string, imageId string) error {
+	defer repo.lock()()
+	var removed *models.ImageLink
+	links := make([]models.ImageLink, 0, len(repo.state.productImages))
+	for _, link := range repo.state.productImages {
+		if link.ProductId == productId && link.ImageId == imageId {
+			link := link
+			removed = &link
+			continue
+		}
+		links = append(links, link)
+	}
+	if removed == nil {
+		return fmt.Errorf("image %s is not linked to product %s", imageId, productId)
+	}
+
+	first := -1
+	for i, link := range links {
+		if link.ProductId != productId {
+			continue
+		}
+		if link.Position > removed.Position {
+			links[i].Position--
+		}
+		if first == -1 || links[i].Position < links[first].Position {
+			first = i
+		}
+	}
+	if removed.Primary && first != -1 {
+		links[first].Primary = true
+	}
+	repo.state.productImages = links
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteUnusedImage(ctx context.Context, imageId string) (bool, error) {
+	defer repo.lock()()
+	if _, ok := repo.state.images[imageId]; !ok {
+		return false, nil
+	}
+	for _, link := range repo.state.productImages {
+		if link.ImageId == imageId {
+			return false, nil
+		}
+	}
+	for _, images := range repo.state.variantImages {
+		for _, id := range images {
+			if id == imageId {
+				return false, nil
+			}
+		}
+	}
+	delete(repo.state.images, imageId)
+	return true, nil
+}
+
+func (repo *MemoryRepository) CountImagesByUrl(ctx context.Context, url string) (int, error) {
+	defer repo.lock()()
+	count := 0
+	for _, image := range repo.state.images {
+		if image.Url == url {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetImageById recibe el id del producto, igual que la implementacion de postgres.
+func (repo *MemoryRepository) GetImageById(ctx context.Context, productId string) (*models.Image, error) {
+	defer repo.lock()()
+	for _, link := range repo.state.productImages {
+		if link.ProductId == productId {
+			image := repo.state.images[link.ImageId]
+			return &image, nil
+		}
+	}
+	return &models.Image{}, nil
+}
+
+// options and variants
+
+func (repo *MemoryRepository) InsertProductOption(ctx context.Context, option *models.ProductOption) error {
+	defer repo.lock()()
+	if _, ok := repo.state.products[option.ProductId]; !ok {
+		return fmt.Errorf("product %s does not exist", option.ProductId)
+	}
+	for _, existing := range repo.state.options {
+		if existing.ProductId == option.ProductId && existing.Name == option.Name {
+			return fmt.Errorf("option %s already exists", option.Name)
+		}
+	}
+	stored := *option
+	stored.Values = append([]string(nil), option.Values...)
+	repo.state.options[option.Id] = stored
+	return nil
+}
+
+func (repo *MemoryRepository) ListProductOptions(ctx context.Context, productId string) ([]*models.ProductOption, error) {
+	defer repo.lock()()
+	var options []*models.ProductOption
+	for _, option := range repo.state.options {
+		if option.ProductId == productId {
+			option := option
+			option.Values = append([]string(nil), option.Values...)
+			options = append(options, &option)
+		}
+	}
+	sort.Slice(options, func(i, j int) bool {
+		if options[i].Position == options[j].Position {
+			return options[i].Name < options[j].Name
+		}
+		return options[i].Position < options[j].Position
+	})
+	return options, nil
+}
+
+func (repo *MemoryRepository) InsertVariant(ctx context.Context, variant *models.Variant) error {
+	defer repo.lock()()
+	if _, ok := repo.state.products[variant.ProductId]; !ok {
+		return fmt.Errorf("product %s does not exist", variant.ProductId)
+	}
+	for _, existing := range repo.state.variants {
+		if existing.Sku == variant.Sku {
+			return fmt.Errorf("sku %s already exists", variant.Sku)
+		}
+	}
+	variant.CreatedAt = time.Now()
+	stored := *variant
+	stored.Options = copyMap(variant.Options)
+	stored.Images = nil
+	repo.state.variants[variant.Id] = stored
+	return nil
+}
+
+func (repo *MemoryRepository) GetVariantById(ctx context.Context, id string) (*models.Variant, error) {
+	defer repo.lock()()
+	variant, ok := repo.state.variants[id]
+	if !ok {
+		return &models.Variant{}, nil
+	}
+	return repo.withVariantImages(variant), nil
+}
+
+func (repo *MemoryRepository) GetVariantBySku(ctx context.Context, sku string) (*models.Variant, error) {
+	defer repo.lock()()
+	for _, variant := range repo.state.variants {
+		if variant.Sku == sku {
+			return repo.withVariantImages(variant), nil
+		}
+	}
+	return &models.Variant{}, nil
+}
+
+func (repo *MemoryRepository) ListVariants(ctx context.Context, productId string) ([]*models.Variant, error) {
+	defer repo.lock()()
+	var variants []*models.Variant
+	for _, variant := range repo.state.variants {
+		if variant.ProductId == productId {
+			variants = append(variants, repo.withVariantImages(variant))
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if variants[i].CreatedAt.Equal(variants[j].CreatedAt) {
+			return variants[i].Id < variants[j].Id
+		}
+		return variants[i].CreatedAt.Before(variants[j].CreatedAt)
+	})
+	return variants, nil
+}
+
+// withVariantImages copia la variante guardada y le agrega las urls de sus imagenes.
+func (repo *MemoryRepository) withVariantImages(variant models.Variant) *models.Variant {
+	variant.Options = copyMap(variant.Options)
+	variant.Images = []string{}
+	for _, imageId := range repo.state.variantImages[variant.Id] {
+		variant.Images = append(variant.Images, repo.state.images[imageId].Url)
+	}
+	return &variant
+}
+
+func (repo *MemoryRepository) UpdateVariant(ctx context.Context, variant *models.Variant) error {
+	defer repo.lock()()
+	current, ok := repo.state.variants[variant.Id]
+	if !ok {
+		return nil
+	}
+	for _, existing := range repo.state.variants {
+		if existing.Sku == variant.Sku && existing.Id != variant.Id {
+			return fmt.Errorf("sku %s already exists", variant.Sku)
+		}
+	}
+	// CHECK stock >= 0
+	if variant.Stock < 0 {
+		return errors.New("stock must be zero or greater")
+	}
+	current.Sku = variant.Sku
+	current.Price = variant.Price
+	current.Stock = variant.Stock
+	repo.state.variants[variant.Id] = current
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteVariant(ctx context.Context, id string) error {
+	defer repo.lock()()
+	delete(repo.state.variants, id)
+	delete(repo.state.variantImages, id)
+
+	// ON DELETE CASCADE
+	for itemId, item := range repo.state.carItems {
+		if item.VariantId == id {
+			delete(repo.state.carItems, itemId)
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) LinkVariantToImage(ctx context.Context, variantId string, imageId string) error {
+	defer repo.lock()()
+	if _, ok := repo.state.variants[variantId]; !ok {
+		return fmt.Errorf("variant %s does not exist", variantId)
+	}
+	if _, ok := repo.state.images[imageId]; !ok {
+		return fmt.Errorf("image %s does not exist", imageId)
+	}
+	for _, linked := range repo.state.variantImages[variantId] {
+		if linked == imageId {
+			return fmt.Errorf("image %s already linked to variant %s", imageId, variantId)
+		}
+	}
+	repo.state.variantImages[variantId] = append(repo.state.variantImages[variantId], imageId)
+	return nil
+}
+
+// categories
+
+func (repo *MemoryRepository) InsertCategory(ctx context.Context, category *models.Category) error {
+	defer repo.lock()()
+	for _, existing := range repo.state.categories {
+		if existing.Slug == category.Slug {
+			return fmt.Errorf("category %s already exists", category.Slug)
+		}
+	}
+	if _, ok := repo.state.categories[category.ParentId]; category.ParentId != "" && !ok {
+		return fmt.Errorf("category %s does not exist", category.ParentId)
+	}
+	category.CreatedAt = time.Now()
+	repo.state.categories[category.Id] = *category
+	return nil
+}
+
+func (repo *MemoryRepository) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	defer repo.lock()()
+	for _, category := range repo.state.categories {
+		if category.Slug == slug {
+			return &category, nil
+		}
+	}
+	return &models.Category{}, nil
+}
+
+func (repo *MemoryRepository) UpdateCategory(ctx context.Context, category *models.Category) error {
+	defer repo.lock()()
+	current, ok := repo.state.categories[category.Id]
+	if !ok {
+		return nil
+	}
+	for _, existing := range repo.state.categories {
+		if existing.Slug == category.Slug && existing.Id != category.Id {
+			return fmt.Errorf("category %s already exists", category.Slug)
+		}
+	}
+	current.Name = category.Name
+	current.Slug = category.Slug
+	current.ParentId = category.ParentId
+	repo.state.categories[category.Id] = current
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteCategory(ctx context.Context, id string) error {
+	defer repo.lock()()
+	// ON DELETE RESTRICT
+	for _, category := range repo.state.categories {
+		if category.ParentId == id {
+			return fmt.Errorf("category %s has subcategories", id)
+		}
+	}
+	delete(repo.state.categories, id)
+
+	// ON DELETE CASCADE
+	for _, categories := range repo.state.productCats {
+		delete(categories, id)
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) ListCategories(ctx context.Context) ([]*models.Category, error) {
+	defer repo.lock()()
+	return repo.sortedCategories(func(category models.Category) bool { return true }), nil
+}
+
+func (repo *MemoryRepository) ListProductCategories(ctx context.Context, productId string) ([]*models.Category, error) {
+	defer repo.lock()()
+	linked := repo.state.productCats[productId]
+	return repo.sortedCategories(func(category models.Category) bool { return linked[category.Id] }), nil
+}
+
+// sortedCategories devuelve las categorias que cumplen keep ordenadas por nombre, igual que postgres.
+func (repo *MemoryRepository) sortedCategories(keep func(category models.Category) bool) []*models.Category {
+	var categories []*models.Category
+	for _, category := range repo.state.categories {
+		if keep(category) {
+			category := category
+			categories = append(categories, &category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Name == categories[j].Name {
+			return categories[i].Id < categories[j].Id
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories
+}
+
+func (repo *MemoryRepository) SetProductCategories(ctx context.Context, productId string, categoryIds []string) error {
+	defer repo.lock()()
+	if _, ok := repo.state.products[productId]; !ok {
+		return fmt.Errorf("product %s does not exist", productId)
+	}
+	categories := make(map[string]bool, len(categoryIds))
+	for _, categoryId := range categoryIds {
+		if _, ok := repo.state.categories[categoryId]; !ok {
+			return fmt.Errorf("category %s does not exist", categoryId)
+		}
+		categories[categoryId] = true
+	}
+	repo.state.productCats[productId] = categories
+	return nil
+}
+
+func (repo *MemoryRepository) ListCategoryProducts(ctx context.Context, categoryId string, page uint64) ([]*models.ProductList, error) {
+	defer repo.lock()()
+	products := repo.filterProducts(models.ProductFilter{CategoryId: categoryId})
+	sortProducts(products, "")
+
+	var productList []*models.ProductList
+	start := page * PAGINATION_SIZE
+	for i := start; i < uint64(len(products)) && i < start+PAGINATION_SIZE; i++ {
+		productList = append(productList, repo.toProductList(products[i]))
+	}
+	return productList, nil
+}
+
+// categoryTree devuelve la categoria y todas sus descendientes, como el CTE recursivo de postgres.
+func (repo *MemoryRepository) categoryTree(categoryId string) map[string]bool {
+	tree := map[string]bool{categoryId: true}
+	for grew := true; grew; {
+		grew = false
+		for id, category := range repo.state.categories {
+			if !tree[id] && tree[category.ParentId] {
+				tree[id] = true
+				grew = true
+			}
+		}
+	}
+	return tree
+}
+
+// inCategories dice si el producto esta en alguna categoria de tree.
+func (repo *MemoryRepository) inCategories(productId string, tree map[string]bool) bool {
+	for id := range repo.state.productCats[productId] {
+		if tree[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchProducts imita la busqueda de postgres: cada palabra de la consulta debe aparecer en el nombre
+// o la descripcion, aceptando errores de tipeo de una o dos letras segun el largo de la palabra.
+// Las coincidencias en el nombre pesan mas que en la descripcion y las exactas mas que las aproximadas.
+func (repo *MemoryRepository) SearchProducts(ctx context.Context, query string, page uint64) ([]*models.ProductSearchResult, error) {
+	defer repo.lock()()
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var results []*models.ProductSearchResult
+	for _, product := range repo.state.products {
+		name := searchWords(product.Name)
+		description := searchWords(product.Description)
+		rank := 0.0
+		found := true
+		for _, term := range terms {
+			nameScore := matchScore(term, name)
+			descriptionScore := matchScore(term, description) * 0.4
+			if nameScore == 0 && descriptionScore == 0 {
+				found = false
+				break
+			}
+			rank += max(nameScore, descriptionScore)
+		}
+		if !found {
+			continue
+		}
+
+		result := &models.ProductSearchResult{
+			ProductList: *repo.toProductList(product),
+			Rank:        rank / float64(len(terms)),
+			Highlight: models.ProductHighlight{
+				Name:        highlightWords(product.Name, terms),
+				Description: highlightWords(product.Description, terms),
+			},
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank == results[j].Rank {
+			return results[i].Id < results[j].Id
+		}
+		return results[i].Rank > results[j].Rank
+	})
+
+	start := page * PAGINATION_SIZE
+	if start >= uint64(len(results)) {
+		return nil, nil
+	}
+	return results[start:min(start+PAGINATION_SIZE, uint64(len(results)))], nil
+}
+
+var searchWordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+func searchWords(text string) []string {
+	return searchWordPattern.FindAllString(strings.ToLower(text), -1)
+}
+
+// matchScore es 1 si alguna palabra es igual a term, 0.5 si se parece y 0 si ninguna coincide.
+func matchScore(term string, words []string) float64 {
+	score := 0.0
+	for _, word := range words {
+		if word == term {
+			return 1
+		}
+		if similarWord(term, word) {
+			score = 0.5
+		}
+	}
+	return score
+}
+
+// similarWord acepta un error de tipeo en palabras de 4 letras o mas y dos desde las 8.
+func similarWord(term string, word string) bool {
+	tolerance := 0
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		tolerance = 2
+	case n >= 4:
+		tolerance = 1
+	}
+	return tolerance > 0 && editDistance(term, word) <= tolerance
+}
+
+// editDistance es la distancia de Damerau-Levenshtein (con transposiciones de letras vecinas).
+func editDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// highlightWords marca las palabras de text que coinciden con terms, igual que ts_headline.
+func highlightWords(text string, terms []string) string {
+	marked := searchWordPattern.ReplaceAllStringFunc(text, func(word string) string {
+		for _, term := range terms {
+			if lower := strings.ToLower(word); lower == term || similarWord(term, lower) {
+				return highlightStart + word + highlightStop
+			}
+		}
+		return word
+	})
+	return markHighlight(marked)
+}
+
+// wishcar
+
+func (repo *MemoryRepository) CreateWishCar(ctx context.Context, wishCar *models.Car) error {
+	defer repo.lock()()
+	if _, ok := repo.state.wishcars[wishCar.Id]; ok {
+		return fmt.Errorf("wishcar %s already exists", wishCar.Id)
+	}
+	wishCar.CreatedAt = time.Now()
+	repo.state.wishcars[wishCar.Id] = *wishCar
+	return nil
+}
+
+func (repo *MemoryRepository) GetWishCarById(ctx context.Context, userId string) (*models.Car, error) {
+	defer repo.lock()()
+	for _, car := range repo.state.wishcars {
+		if car.UserId == userId {
+			return &car, nil
+		}
+	}
+	return &models.Car{}, nil
+}
+
+func (repo *MemoryRepository) UpdateWishCar(ctx context.Context, wishCar *models.Car) error {
+	defer repo.lock()()
+	car, ok := repo.state.wishcars[wishCar.Id]
+	if !ok {
+		return nil
+	}
+	car.Total = wishCar.Total
+	repo.state.wishcars[car.Id] = car
+	return nil
+}
+
+func (repo *MemoryRepository) AddItem(ctx context.Context, carItem *models.CarItem) error {
+	defer repo.lock()()
+	if _, ok := repo.state.wishcars[carItem.CarId]; !ok {
+		return fmt.Errorf("wishcar %s does not exist", carItem.CarId)
+	}
+	if _, ok := repo.state.products[carItem.ProductId]; !ok {
+		return fmt.Errorf("product %s does not exist", carItem.ProductId)
+	}
+	if _, ok := repo.state.variants[carItem.VariantId]; carItem.VariantId != "" && !ok {
+		return fmt.Errorf("variant %s does not exist", carItem.VariantId)
+	}
+	if carItem.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+	carItem.CreatedAt = time.Now()
+	item := *carItem
+	item.Id = ksuid.New().String()
+	repo.state.carItems[item.Id] = item
+	return nil
+}
+
+func (repo *MemoryRepository) GetItem(ctx context.Context, productId string, variantId string, carId string) (*models.CarItem, error) {
+	defer repo.lock()()
+	for _, item := range repo.state.carItems {
+		if item.ProductId == productId && item.VariantId == variantId && item.CarId == carId {
+			return &item, nil
+		}
+	}
+	return &models.CarItem{}, nil
+}
+
+// RemoveItem elimina el producto de los carritos, igual que la implementacion de postgres.
+func (repo *MemoryRepository) RemoveItem(ctx context.Context, productId string) error {
+	defer repo.lock()()
+	for id, item := range repo.state.carItems {
+		if item.ProductId == productId {
+			delete(repo.state.carItems, id)
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) UpdateQuantity(ctx context.Context, itemId string, quantity int) error {
+	defer repo.lock()()
+	item, ok := repo.state.carItems[itemId]
+	if !ok {
+		return nil
+	}
+	// CHECK quantity > 0
+	if item.Quantity+quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+	item.Quantity += quantity
+	repo.state.carItems[itemId] = item
+	return nil
+}
+
+// ListItems recibe el id del usuario, igual que la implementacion de postgres.
+func (repo *MemoryRepository) ListItems(ctx context.Context, userId string, request models.PageRequest) (*models.Page[*models.CarItem], error) {
+	defer repo.lock()()
+	var carItems []*models.CarItem
+	for _, item := range repo.state.carItems {
+		if repo.state.wishcars[item.CarId].UserId == userId {
+			item := item
+			carItems = append(carItems, &item)
+		}
+	}
+	cursor := func(item *models.CarItem) models.Cursor {
+		return models.Cursor{Key: item.CreatedAt.Format(time.RFC3339Nano), Id: item.Id}
+	}
+	compare := func(item *models.CarItem, cursor models.Cursor) int {
+		createdAt, _ := time.Parse(time.RFC3339Nano, cursor.Key)
+		if c := item.CreatedAt.Compare(createdAt); c != 0 {
+			return c
+		}
+		return strings.Compare(item.Id, cursor.Id)
+	}
+	sort.Slice(carItems, func(i, j int) bool { return compare(carItems[i], cursor(carItems[j])) < 0 })
+	return memoryPage(carItems, request, cursor, compare), nil
+}
+
+func (repo *MemoryRepository) ClearWishCar(ctx context.Context, carId string) error {
+	defer repo.lock()()
+	for id, item := range repo.state.carItems {
+		if item.CarId == carId {
+			delete(repo.state.carItems, id)
+		}
+	}
+	if car, ok := repo.state.wishcars[carId]; ok {
+		car.Total = 0
+		repo.state.wishcars[carId] = car
+	}
+	return nil
+}
+
+// orders
+
+func (repo *MemoryRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+	defer repo.lock()()
+	if _, ok := repo.state.orders[order.Id]; ok {
+		return fmt.Errorf("order %s already exists", order.Id)
+	}
+
+	// primero se valida todo el stock y luego se descuenta, asi no queda nada a medias
+	products, variants := newStockRequests(order.Items)
+	productStock := make(map[string]int)
+	for _, id := range products.ids {
+		if product, ok := repo.state.products[id]; ok {
+			productStock[id] = product.Stock
+		}
+	}
+	variantStock := make(map[string]int)
+	for _, id := range variants.ids {
+		if variant, ok := repo.state.variants[id]; ok {
+			variantStock[id] = variant.Stock
+		}
+	}
+
+	shortages := append(products.shortages(productStock), variants.shortages(variantStock)...)
+	if len(shortages) > 0 {
+		return &repository.OutOfStockError{Items: shortages}
+	}
+
+	for _, id := range products.ids {
+		product := repo.state.products[id]
+		product.Stock -= products.requested[id]
+		repo.state.products[id] = product
+	}
+	for _, id := range variants.ids {
+		variant := repo.state.variants[id]
+		variant.Stock -= variants.requested[id]
+		repo.state.variants[id] = variant
+	}
+
+	order.CreatedAt = time.Now()
+	stored := *order
+	stored.Items = nil
+	repo.state.orders[order.Id] = stored
+
+	items := make([]models.OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		item.Id = ksuid.New().String()
+		item.OrderId = order.Id
+		items = append(items, *item)
+	}
+	repo.state.orderItems[order.Id] = items
+	return nil
+}
+
+func (repo *MemoryRepository) GetOrderById(ctx context.Context, id string) (*models.Order, error) {
+	defer repo.lock()()
+	order, ok := repo.state.orders[id]
+	if !ok {
+		return &models.Order{}, nil
+	}
+	return repo.withOrderItems(order), nil
+}
+
+func (repo *MemoryRepository) ListOrders(ctx context.Context, userId string) ([]*models.Order, error) {
+	defer repo.lock()()
+	var orders []*models.Order
+	for _, order := range repo.state.orders {
+		if order.UserId == userId {
+			orders = append(orders, repo.withOrderItems(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return orders, nil
+}
+
+func (repo *MemoryRepository) withOrderItems(order models.Order) *models.Order {
+	for _, item := range repo.state.orderItems[order.Id] {
+		item := item
+		order.Items = append(order.Items, &item)
+	}
+	return &order
+}
+
+func (repo *MemoryRepository) UpdateOrderStatus(ctx context.Context, change *models.OrderStatusChange) error {
+	defer repo.lock()()
+	order, ok := repo.state.orders[change.OrderId]
+	if !ok || order.Status != change.FromStatus {
+		return repository.ErrOrderStatusConflict
+	}
+	order.Status = change.ToStatus
+	repo.state.orders[order.Id] = order
+
+	// al cancelar se devuelven las unidades reservadas, a la variante si el item tiene una
+	if change.ToStatus == models.OrderCancelled {
+		for _, item := range repo.state.orderItems[order.Id] {
+			if item.VariantId != "" {
+				if variant, ok := repo.state.variants[item.VariantId]; ok {
+					variant.Stock += item.Quantity
+					repo.state.variants[variant.Id] = variant
+				}
+				continue
+			}
+			if product, ok := repo.state.products[item.ProductId]; ok {
+				product.Stock += item.Quantity
+				repo.state.products[product.Id] = product
+			}
+		}
+	}
+
+	change.Id = ksuid.New().String()
+	change.CreatedAt = time.Now()
+	repo.state.orderHistory[order.Id] = append(repo.state.orderHistory[order.Id], *change)
+	return nil
+}
+
+func (repo *MemoryRepository) ListOrderStatusHistory(ctx context.Context, orderId string) ([]*models.OrderStatusChange, error) {
+	defer repo.lock()()
+	var history []*models.OrderStatusChange
+	for _, change := range repo.state.orderHistory[orderId] {
+		change := change
+		history = append(history, &change)
+	}
+	return history, nil
+}
+
+// roles
+
+func (repo *MemoryRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	defer repo.lock()()
+	for _, r := range repo.state.roles {
+		if r.Name == role.Name {
+			return fmt.Errorf("role %s already exists", role.Name)
+		}
+	}
+	role.Id = repo.state.nextRoleId
+	role.CreatedAt = time.Now()
+	repo.state.nextRoleId++
+	repo.state.roles[role.Id] = *role
+	return nil
+}
+
+func (repo *MemoryRepository) ListRoles(ctx context.Context, request models.PageRequest) (*models.Page[*models.Role], error) {
+	defer repo.lock()()
+	var roles []*models.Role
+	for _, role := range repo.state.roles {
+		role := role
+		roles = append(roles, &role)
+	}
+	compare := func(role *models.Role, cursor models.Cursor) int {
+		createdAt, _ := time.Parse(time.RFC3339Nano, cursor.Key)
+		id, _ := strconv.Atoi(cursor.Id)
+		if c := role.CreatedAt.Compare(createdAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(role.Id, id)
+	}
+	sort.Slice(roles, func(i, j int) bool { return compare(roles[i], roleCursor(roles[j])) < 0 })
+	return memoryPage(roles, request, roleCursor, compare), nil
+}
+
+func (repo *MemoryRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	defer repo.lock()()
+	for _, role := range repo.state.roles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return &models.Role{}, nil
+}
+
+func (repo *MemoryRepository) SetRoleUser(ctx context.Context, userId string, roleId int) error {
+	defer repo.lock()()
+	if _, ok := repo.state.users[userId]; !ok {
+		return fmt.Errorf("user %s does not exist", userId)
+	}
+	if _, ok := repo.state.roles[roleId]; !ok {
+		return fmt.Errorf("role %d does not exist", roleId)
+	}
+	if repo.state.usersRoles[userId][roleId] {
+		return fmt.Errorf("user %s already has role %d", userId, roleId)
+	}
+	if repo.state.usersRoles[userId] == nil {
+		repo.state.usersRoles[userId] = make(map[int]bool)
+	}
+	repo.state.usersRoles[userId][roleId] = true
+	return nil
+}
+
+func (repo *MemoryRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	defer repo.lock()()
+	var roles []string
+	for roleId := range repo.state.usersRoles[userId] {
+		roles = append(roles, repo.state.roles[roleId].Name)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (repo *MemoryRepository) RemoveRoleUser(ctx context.Context, userId string, roleId int) error {
+	defer repo.lock()()
+	delete(repo.state.usersRoles[userId], roleId)
+	return nil
+}
+
+// permisos
+
+func (repo *MemoryRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	defer repo.lock()()
+	var permissions []*models.Permission
+	for _, permission := range repo.state.permissions {
+		permission := permission
+		permissions = append(permissions, &permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return permissions, nil
+}
+
+func (repo *MemoryRepository) GetPermission(ctx context.Context, name string) (*models.Permission, error) {
+	defer repo.lock()()
+	for _, permission := range repo.state.permissions {
+		if permission.Name == name {
+			return &permission, nil
+		}
+	}
+	return &models.Permission{}, nil
+}
+
+func (repo *MemoryRepository) GetRolePermissions(ctx context.Context, roleId int) ([]string, error) {
+	defer repo.lock()()
+	var permissions []string
+	for permissionId := range repo.state.rolePerms[roleId] {
+		permissions = append(permissions, repo.state.permissions[permissionId].Name)
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+func (repo *MemoryRepository) GrantPermission(ctx context.Context, roleId int, permissionId int) error {
+	defer repo.lock()()
+	if _, ok := repo.state.roles[roleId]; !ok {
+		return fmt.Errorf("role %d does not exist", roleId)
+	}
+	if _, ok := repo.state.permissions[permissionId]; !ok {
+		return fmt.Errorf("permission %d does not exist", permissionId)
+	}
+	if repo.state.rolePerms[roleId] == nil {
+		repo.state.rolePerms[roleId] = make(map[int]bool)
+	}
+	repo.state.rolePerms[roleId][permissionId] = true
+	return nil
+}
+
+func (repo *MemoryRepository) RevokePermission(ctx context.Context, roleId int, permissionId int) error {
+	defer repo.lock()()
+	delete(repo.state.rolePerms[roleId], permissionId)
+	return nil
+}
+
+func (repo *MemoryRepository) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	defer repo.lock()()
+	seen := make(map[string]bool)
+	var permissions []string
+	for roleId := range repo.state.usersRoles[userId] {
+		for permissionId := range repo.state.rolePerms[roleId] {
+			name := repo.state.permissions[permissionId].Name
+			if !seen[name] {
+				seen[name] = true
+				permissions = append(permissions, name)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+func (repo *MemoryRepository) InsertGrantAudit(ctx context.Context, audit *models.GrantAudit) error {
+	defer repo.lock()()
+	audit.Id = ksuid.New().String()
+	audit.CreatedAt = time.Now()
+	repo.state.grantAudit = append(repo.state.grantAudit, *audit)
+	return nil
+}
+
+func (repo *MemoryRepository) ListGrantAudit(ctx context.Context) ([]*models.GrantAudit, error) {
+	defer repo.lock()()
+	var entries []*models.GrantAudit
+	// los mas recientes primero, como en postgres
+	for i := len(repo.state.grantAudit) - 1; i >= 0; i-- {
+		audit := repo.state.grantAudit[i]
+		entries = append(entries, &audit)
+	}
+	return entries, nil
+}
+
+func (repo *MemoryRepository) InsertHubEvent(ctx context.Context, event *models.HubEvent) error {
+	defer repo.lock()()
+	event.Seq = repo.state.nextHubSeq
+	event.CreatedAt = time.Now()
+	repo.state.nextHubSeq++
+	repo.state.hubEvents = append(repo.state.hubEvents, *event)
+	return nil
+}
+
+func (repo *MemoryRepository) ListHubEvents(ctx context.Context, since int64, limit int) ([]*models.HubEvent, error) {
+	defer repo.lock()()
+	var events []*models.HubEvent
+	for _, event := range repo.state.hubEvents {
+		if len(events) == limit {
+			break
+		}
+		if event.Seq >= since {
+			event := event
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (repo *MemoryRepository) TrimHubEvents(ctx context.Context, keep int) error {
+	defer repo.lock()()
+	if extra := len(repo.state.hubEvents) - keep; extra > 0 {
+		repo.state.hubEvents = append([]models.HubEvent(nil), repo.state.hubEvents[extra:]...)
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) InsertConversation(ctx context.Context, conversation *models.Conversation) error {
+	defer repo.lock()()
+	for _, existing := range repo.state.conversations {
+		if existing.ProductId == conversation.ProductId && existing.CustomerId == conversation.CustomerId {
+			return fmt.Errorf("conversation for product %s already exists", conversation.ProductId)
+		}
+	}
+	conversation.CreatedAt = time.Now()
+	repo.state.conversations[conversation.Id] = *conversation
+	return nil
+}
+
+func (repo *MemoryRepository) GetConversationById(ctx context.Context, id string) (*models.Conversation, error) {
+	defer repo.lock()()
+	conversation, ok := repo.state.conversations[id]
+	if !ok {
+		return &models.Conversation{}, nil
+	}
+	return repo.withProductName(conversation), nil
+}
+
+func (repo *MemoryRepository) FindConversation(ctx context.Context, productId string, customerId string) (*models.Conversation, error) {
+	defer repo.lock()()
+	for _, conversation := range repo.state.conversations {
+		if conversation.ProductId == productId && conversation.CustomerId == customerId {
+			return repo.withProductName(conversation), nil
+		}
+	}
+	return &models.Conversation{}, nil
+}
+
+func (repo *MemoryRepository) withProductName(conversation models.Conversation) *models.Conversation {
+	conversation.ProductName = repo.state.products[conversation.ProductId].Name
+	return &conversation
+}
+
+func (repo *MemoryRepository) ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error) {
+	defer repo.lock()()
+	var conversations []*models.Conversation
+	activity := make(map[string]time.Time)
+	for _, conversation := range repo.state.conversations {
+		if !conversation.HasParticipant(userId) {
+			continue
+		}
+		result := repo.withProductName(conversation)
+		activity[result.Id] = result.CreatedAt
+
+		messages := repo.state.chatMessages[conversation.Id]
+		if len(messages) > 0 {
+			last := messages[len(messages)-1]
+			result.LastMessage = &last
+			activity[result.Id] = last.CreatedAt
+		}
+		for _, message := range messages {
+			if message.SenderId != userId && message.ReadAt == nil {
+				result.Unread++
+			}
+		}
+		conversations = append(conversations, result)
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return activity[conversations[i].Id].After(activity[conversations[j].Id])
+	})
+	return conversations, nil
+}
+
+func (repo *MemoryRepository) InsertChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	defer repo.lock()()
+	if _, ok := repo.state.conversations[message.ConversationId]; !ok {
+		return fmt.Errorf("conversation %s not found", message.ConversationId)
+	}
+	message.CreatedAt = time.Now()
+	repo.state.chatMessages[message.ConversationId] = append(repo.state.chatMessages[message.ConversationId], *message)
+	return nil
+}
+
+func (repo *MemoryRepository) ListChatMessages(ctx context.Context, conversationId string, page uint64) ([]*models.ChatMessage, error) {
+	defer repo.lock()()
+	messages := repo.state.chatMessages[conversationId]
+	var result []*models.ChatMessage
+	// los mas recientes primero, como en postgres
+	start := uint64(len(messages)) - min(page*CHAT_PAGE_SIZE, uint64(len(messages)))
+	for i := int(start) - 1; i >= 0 && len(result) < CHAT_PAGE_SIZE; i-- {
+		message := messages[i]
+		result = append(result, &message)
+	}
+	return result, nil
+}
+
+func (repo *MemoryRepository) MarkChatRead(ctx context.Context, conversationId string, readerId string, readAt time.Time) (int64, error) {
+	defer repo.lock()()
+	var marked int64
+	messages := repo.state.chatMessages[conversationId]
+	for i := range messages {
+		if messages[i].SenderId != readerId && messages[i].ReadAt == nil {
+			messages[i].ReadAt = &readAt
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (repo *MemoryRepository) InsertCall(ctx context.Context, call *models.Call) error {
+	defer repo.lock()()
+	if _, ok := repo.state.calls[call.Id]; ok {
+		return fmt.Errorf("call %s already exists", call.Id)
+	}
+	call.CreatedAt = time.Now()
+	repo.state.calls[call.Id] = *call
+	return nil
+}
+
+func (repo *MemoryRepository) GetCallById(ctx context.Context, id string) (*models.Call, error) {
+	defer repo.lock()()
+	call, ok := repo.state.calls[id]
+	if !ok {
+		return &models.Call{}, nil
+	}
+	return &call, nil
+}
+
+func (repo *MemoryRepository) UpdateCall(ctx context.Context, call *models.Call, fromStatus string) error {
+	defer repo.lock()()
+	current, ok := repo.state.calls[call.Id]
+	if !ok || current.Status != fromStatus {
+		return repository.ErrCallStatusConflict
+	}
+	current.Status = call.Status
+	current.CalleeClient = call.CalleeClient
+	current.AnsweredAt = call.AnsweredAt
+	current.EndedAt = call.EndedAt
+	repo.state.calls[call.Id] = current
+	return nil
+}
+
+func (repo *MemoryRepository) ListCalls(ctx context.Context, userId string) ([]*models.Call, error) {
+	defer repo.lock()()
+	var calls []*models.Call
+	for _, call := range repo.state.calls {
+		if call.HasParticipant(userId) {
+			call := call
+			calls = append(calls, &call)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].CreatedAt.After(calls[j].CreatedAt) })
+	return calls, nil
+}
+
+func (repo *MemoryRepository) ListRingingCalls(ctx context.Context) ([]*models.Call, error) {
+	defer repo.lock()()
+	var calls []*models.Call
+	for _, call := range repo.state.calls {
+		if call.Status == models.CallRinging {
+			call := call
+			calls = append(calls, &call)
+		}
+	}
+	return calls, nil
+}
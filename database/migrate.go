@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MIGRATIONS_LOCK_ID es la llave del advisory lock que evita que dos instancias migren a la vez.
+	MIGRATIONS_LOCK_ID = 5050_0001
+)
+
+// las migraciones van numeradas: 0001_nombre.up.sql y 0001_nombre.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus indica si una migracion ya fue aplicada.
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied bool
+}
+
+// loadMigrations lee los archivos embebidos y los ordena por version.
+func loadMigrations() ([]*migration, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return readMigrations(files)
+}
+
+// readMigrations arma las migraciones con los archivos de la raiz de files; cada version
+// necesita su up y su down.
+func readMigrations(files fs.FS) ([]*migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>", fileName)
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", fileName, err)
+		}
+
+		content, err := fs.ReadFile(files, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, m.name, name)
+		}
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]*migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.version, m.name)
+		}
+		if m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no down file", m.version, m.name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// withMigrationLock toma el advisory lock en una conexion dedicada (el lock es por sesion)
+// y crea la tabla schema_migrations si no existe.
+func (repo *PostgresRepository) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := repo.pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", MIGRATIONS_LOCK_ID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", MIGRATIONS_LOCK_ID)
+
+	_, err = conn.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations(
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// runMigration ejecuta el sql y registra (o borra) la version en una sola transaccion.
+func runMigration(ctx context.Context, conn *sql.Conn, m *migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.up
+	if !up {
+		script = m.down
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp aplica en orden todas las migraciones pendientes.
+func (repo *PostgresRepository) MigrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return repo.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// bases creadas con el antiguo up.sql ya tienen el esquema inicial, solo se registra;
+		// por eso 0001 es exactamente ese esquema y todo cambio posterior va en su propia migracion
+		if len(applied) == 0 {
+			var exists bool
+			err = conn.QueryRowContext(ctx, "SELECT to_regclass(quote_ident(current_schema()) || '.users') IS NOT NULL").Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				log.Printf("existing schema found, marking migration %04d_%s as applied", migrations[0].version, migrations[0].name)
+				_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migrations[0].version, migrations[0].name)
+				if err != nil {
+					return err
+				}
+				applied[migrations[0].version] = true
+			}
+		}
+
+		for _, m := range migrations {
+			if applied[m.version] {
+				continue
+			}
+			log.Printf("applying migration %04d_%s", m.version, m.name)
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown revierte las ultimas steps migraciones aplicadas.
+func (repo *PostgresRepository) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return repo.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if !applied[m.version] {
+				continue
+			}
+			log.Printf("reverting migration %04d_%s", m.version, m.name)
+			if err := runMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lista todas las migraciones conocidas y si ya estan aplicadas.
+func (repo *PostgresRepository) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	err = repo.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status = append(status, MigrationStatus{Version: m.version, Name: m.name, Applied: applied[m.version]})
+		}
+		return nil
+	})
+	return status, err
+}
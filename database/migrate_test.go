@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	cases := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"0010_later.up.sql":   file("SELECT 10"),
+				"0010_later.down.sql": file("SELECT -10"),
+				"0002_first.up.sql":   file("SELECT 2"),
+				"0002_first.down.sql": file("SELECT -2"),
+			},
+			versions: []int{2, 10},
+		},
+		{
+			name:  "unknown suffix",
+			files: fstest.MapFS{"0001_init.sql": file("SELECT 1")},
+			err:   "must end in .up.sql or .down.sql",
+		},
+		{
+			name:  "missing name",
+			files: fstest.MapFS{"0001.up.sql": file("SELECT 1")},
+			err:   "must be named <version>_<name>",
+		},
+		{
+			name:  "invalid version",
+			files: fstest.MapFS{"first_init.up.sql": file("SELECT 1")},
+			err:   "has an invalid version",
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"0002_orders.up.sql":   file("SELECT 2"),
+				"0002_orders.down.sql": file("SELECT -2"),
+				"0002_tokens.up.sql":   file("SELECT 2"),
+				"0002_tokens.down.sql": file("SELECT -2"),
+			},
+			err: "migration version 2 is used by",
+		},
+		{
+			name:  "up without down",
+			files: fstest.MapFS{"0003_stock.up.sql": file("SELECT 3")},
+			err:   "migration 0003_stock has no down file",
+		},
+		{
+			name:  "down without up",
+			files: fstest.MapFS{"0003_stock.down.sql": file("SELECT -3")},
+			err:   "migration 0003_stock has no up file",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			migrations, err := readMigrations(c.files)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrations) != len(c.versions) {
+				t.Fatalf("expected %d migrations, got %d", len(c.versions), len(migrations))
+			}
+			for i, m := range migrations {
+				if m.version != c.versions[i] || m.up == "" || m.down == "" {
+					t.Fatalf("migration %d: %+v", i, m)
+				}
+			}
+		})
+	}
+}
+
+// las migraciones embebidas tambien tienen que cargar, si no el servidor no arranca
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrations[0].version != 1 || migrations[0].name != "init" {
+		t.Fatalf("first migration is %04d_%s", migrations[0].version, migrations[0].name)
+	}
+}
+
+// newMigrationRepository conecta a TEST_DATABASE_URL sobre un esquema vacio propio del test,
+// asi las migraciones no tocan las tablas que usan los demas tests. La url tiene que ser de la
+// forma postgres://...; public queda en el search_path por las extensiones.
+func newMigrationRepository(t *testing.T) (*PostgresRepository, []*migration) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := NewPostgresRepository(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "migrate_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if _, err = admin.pool.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.pool.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	repo, err := NewPostgresRepository(url + separator + "search_path=" + schema + ",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, migrations
+}
+
+// appliedMigrations devuelve la version de cada migracion aplicada, en orden.
+func appliedMigrations(t *testing.T, repo *PostgresRepository) []int {
+	t.Helper()
+	status, err := repo.MigrationStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, s := range status {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+func tableExists(t *testing.T, repo *PostgresRepository, table string) bool {
+	t.Helper()
+	var exists bool
+	err := repo.pool.QueryRow("SELECT to_regclass(quote_ident(current_schema()) || '.' || $1) IS NOT NULL", table).Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	repo, migrations := newMigrationRepository(t)
+	ctx := context.Background()
+
+	if err := repo.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedMigrations(t, repo); len(versions) != len(migrations) {
+		t.Fatalf("applied %v, expected %d migrations", versions, len(migrations))
+	}
+	// volver a migrar no hace nada
+	if err := repo.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// down revierte desde la ultima hacia atras
+	if err := repo.MigrateDown(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	versions := appliedMigrations(t, repo)
+	if len(versions) != len(migrations)-1 || versions[len(versions)-1] != migrations[len(migrations)-2].version {
+		t.Fatalf("after one step down: %v", versions)
+	}
+	if err := repo.MigrateDown(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	versions = appliedMigrations(t, repo)
+	if len(versions) != len(migrations)-3 || versions[len(versions)-1] != migrations[len(migrations)-4].version {
+		t.Fatalf("after three steps down: %v", versions)
+	}
+
+	if err := repo.MigrateDown(ctx, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedMigrations(t, repo); len(versions) != 0 {
+		t.Fatalf("after reverting everything: %v", versions)
+	}
+	if tableExists(t, repo, "users") {
+		t.Fatal("users survived reverting every migration")
+	}
+
+	// y todo se puede volver a aplicar
+	if err := repo.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !tableExists(t, repo, "users") || !tableExists(t, repo, "calls") {
+		t.Fatal("tables missing after migrating up again")
+	}
+}
+
+// una base creada con el antiguo up.sql tiene el esquema de 0001 pero no schema_migrations
+func TestMigrateUpMarksExistingSchema(t *testing.T) {
+	repo, migrations := newMigrationRepository(t)
+	ctx := context.Background()
+
+	if _, err := repo.pool.Exec(migrations[0].up); err != nil {
+		t.Fatal(err)
+	}
+
+	// si 0001 se volviera a correr fallaria con "relation users already exists"
+	if err := repo.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedMigrations(t, repo); len(versions) != len(migrations) || versions[0] != migrations[0].version {
+		t.Fatalf("applied %v, expected %d migrations", versions, len(migrations))
+	}
+	if !tableExists(t, repo, "calls") {
+		t.Fatal("later migrations were not applied")
+	}
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS car_item;
+DROP TABLE IF EXISTS wishcar;
+DROP TABLE IF EXISTS product_images;
+DROP TABLE IF EXISTS images;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS bussinessman;
+DROP TABLE IF EXISTS users;
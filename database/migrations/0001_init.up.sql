@@ -1,8 +1,6 @@
 -- Habilitar la extensión pgcrypto
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
-DROP TABLE IF EXISTS users;
-
 CREATE TABLE users(
     id VARCHAR(32) PRIMARY KEY,
     password VARCHAR(255) NOT NULL,
@@ -10,8 +8,6 @@ CREATE TABLE users(
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
-DROP TABLE IF EXISTS bussinessman;
-
 CREATE TABLE bussinessman (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id VARCHAR(32) UNIQUE NOT NULL,
@@ -20,7 +16,6 @@ CREATE TABLE bussinessman (
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-
 -- CREATE TABLE empresarios (
 --     id VARCHAR(32) PRIMARY KEY,
 --     user_id VARCHAR(32) UNIQUE NOT NULL,
@@ -30,8 +25,6 @@ CREATE TABLE bussinessman (
 --     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 -- );
 
-DROP TABLE IF EXISTS products;
-
 CREATE TABLE products(
     id VARCHAR(32) PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
@@ -43,11 +36,6 @@ CREATE TABLE products(
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-
-DROP TABLE IF EXISTS images;
-
-
-
 CREATE TABLE images(
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(), -- Usar UUID para claves únicasa
     user_id  VARCHAR(32) NOT NULL,                        -- Usar UUID si la tabla users lo soporta
@@ -62,9 +50,6 @@ CREATE TABLE images(
 -- Crear índices para consultas rápidas
 CREATE INDEX idx_user_id ON images(user_id);
 
-
-DROP TABLE IF EXISTS product_images;
-
 CREATE TABLE product_images (
     product_id VARCHAR(32) NOT NULL,
     image_id UUID NOT NULL,
@@ -76,8 +61,6 @@ CREATE TABLE product_images (
     PRIMARY KEY (product_id, image_id)
 );
 
-DROP TABLE IF EXISTS wishcar; 
-
 CREATE TABLE wishcar(
     id VARCHAR(32) PRIMARY KEY ,
     user_id VARCHAR(32) NOT NULL,
@@ -86,8 +69,6 @@ CREATE TABLE wishcar(
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-DROP TABLE IF EXISTS car_item;
-
 CREATE TABLE car_item (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     car_id VARCHAR(32) NOT NULL,
@@ -97,9 +78,6 @@ CREATE TABLE car_item (
     FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
 );
 
-
-DROP TABLE IF EXISTS roles;
-
 CREATE TABLE roles(
     id SERIAL PRIMARY KEY,
     name VARCHAR(50) UNIQUE NOT NULL
@@ -107,14 +85,10 @@ CREATE TABLE roles(
 
 INSERT INTO roles (name) VALUES ('admin');
 
-
-
-DROP TABLE IF EXISTS users_roles;
-
 CREATE TABLE users_roles(
     user_id VARCHAR(32) NOT NULL,
     role_id INT NOT NULL,
     PRIMARY KEY (user_id, role_id),
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE 
-);
\ No newline at end of file
+);
@@ -0,0 +1,4 @@
+ALTER TABLE products
+    DROP CONSTRAINT IF EXISTS products_stock_check,
+    ALTER COLUMN stock DROP DEFAULT,
+    ALTER COLUMN stock TYPE VARCHAR(255) USING stock::VARCHAR;
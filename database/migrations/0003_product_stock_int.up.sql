@@ -0,0 +1,5 @@
+-- el esquema inicial guardaba el stock como texto; lo que no sea un numero queda en 0
+ALTER TABLE products
+    ALTER COLUMN stock TYPE INT USING CASE WHEN trim(stock) ~ '^[0-9]+$' THEN trim(stock)::INT ELSE 0 END,
+    ALTER COLUMN stock SET DEFAULT 0,
+    ADD CONSTRAINT products_stock_check CHECK (stock >= 0);
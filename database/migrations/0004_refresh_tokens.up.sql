@@ -0,0 +1,23 @@
+-- refresh tokens rotativos: solo se guarda el hash, cada rotacion conserva la familia del login original.
+-- las expiraciones usan TIMESTAMPTZ porque se comparan con horas calculadas en la aplicacion
+CREATE TABLE refresh_tokens(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id VARCHAR(32) NOT NULL,
+    family_id VARCHAR(32) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+-- access tokens revocados antes de expirar (por jti), se limpian al pasar expires_at
+CREATE TABLE revoked_tokens(
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS grant_audit;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DELETE FROM roles WHERE name = 'merchant';
@@ -0,0 +1,47 @@
+-- permisos que se asignan a los roles; el middleware revisa permisos y no nombres de roles
+CREATE TABLE permissions(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT NULL
+);
+
+CREATE TABLE role_permissions(
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+-- registro de cada cambio de roles y permisos, sin FKs para que sobreviva a los borrados
+CREATE TABLE grant_audit(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_id VARCHAR(32) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    user_id VARCHAR(32) NULL,
+    role VARCHAR(50) NOT NULL,
+    permission VARCHAR(100) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_grant_audit_created_at ON grant_audit(created_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('product:write', 'create, update and delete products and their images'),
+    ('order:read', 'read any order history'),
+    ('order:update', 'move orders through their statuses'),
+    ('order:refund', 'refund orders'),
+    ('role:manage', 'manage roles, permissions and user grants');
+
+-- los empresarios reciben merchant al registrarse; admin solo se asigna a mano.
+-- merchant no lee ni mueve ordenes: esas siguen siendo solo del admin
+INSERT INTO roles (name) VALUES ('merchant') ON CONFLICT (name) DO NOTHING;
+INSERT INTO roles (name) VALUES ('admin') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'product:write'
+WHERE r.name = 'merchant';
@@ -0,0 +1,9 @@
+-- ultimos eventos publicados por el hub del websocket. seq es el numero que recibe cada cliente
+-- y con el que pide lo que se perdio al reconectarse; el hub borra los mas viejos.
+CREATE TABLE hub_events(
+    seq BIGSERIAL PRIMARY KEY,
+    topics TEXT[] NOT NULL DEFAULT '{}',
+    type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,29 @@
+-- chat entre un cliente y el dueño de un producto, una conversacion por producto y cliente
+CREATE TABLE conversations(
+    id VARCHAR(32) PRIMARY KEY,
+    product_id VARCHAR(32) NOT NULL,
+    customer_id VARCHAR(32) NOT NULL,
+    merchant_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, customer_id),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (customer_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (merchant_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_conversations_customer_id ON conversations(customer_id);
+CREATE INDEX idx_conversations_merchant_id ON conversations(merchant_id);
+
+-- read_at lo marca el otro participante al leer la conversacion
+CREATE TABLE chat_messages(
+    id VARCHAR(32) PRIMARY KEY,
+    conversation_id VARCHAR(32) NOT NULL,
+    sender_id VARCHAR(32) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ NULL,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_messages_conversation_id ON chat_messages(conversation_id, created_at);
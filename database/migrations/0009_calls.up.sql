@@ -0,0 +1,19 @@
+-- registro de las videollamadas; caller_client y callee_client son las conexiones de websocket de cada lado
+CREATE TABLE calls(
+    id VARCHAR(32) PRIMARY KEY,
+    conversation_id VARCHAR(32) NOT NULL,
+    caller_id VARCHAR(32) NOT NULL,
+    callee_id VARCHAR(32) NOT NULL,
+    caller_client VARCHAR(32) NOT NULL,
+    callee_client VARCHAR(32) NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'ringing',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    answered_at TIMESTAMPTZ NULL,
+    ended_at TIMESTAMPTZ NULL,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (caller_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (callee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_calls_caller_id ON calls(caller_id);
+CREATE INDEX idx_calls_callee_id ON calls(callee_id);
@@ -0,0 +1,2 @@
+-- ultima vez que el usuario tuvo una conexion abierta, la presencia en vivo la lleva el hub
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMPTZ NULL;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'category:manage';
+DROP TABLE IF EXISTS product_categories;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,29 @@
+-- taxonomia de productos: cada categoria puede colgar de otra, la raiz tiene parent_id NULL
+CREATE TABLE categories(
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(100) UNIQUE NOT NULL,
+    parent_id VARCHAR(32) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- no se puede borrar una categoria que todavia tiene subcategorias
+    FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX idx_categories_parent_id ON categories(parent_id);
+
+CREATE TABLE product_categories(
+    product_id VARCHAR(32) NOT NULL,
+    category_id VARCHAR(32) NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_product_categories_category_id ON product_categories(category_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('category:manage', 'create, update and delete product categories');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'category:manage'
+WHERE r.name = 'admin';
@@ -0,0 +1,6 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS sku;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE car_item DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS variant_images;
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_options;
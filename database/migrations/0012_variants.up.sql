@@ -0,0 +1,39 @@
+-- ejes de variantes de un producto (talla, color...) con sus valores posibles
+CREATE TABLE product_options(
+    id VARCHAR(32) PRIMARY KEY,
+    product_id VARCHAR(32) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    "values" TEXT[] NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE (product_id, name),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+-- cada variante tiene su SKU y stock; price NULL usa el precio del producto.
+-- options guarda el valor de cada opcion, {"size": "M", "color": "red"}
+CREATE TABLE product_variants(
+    id VARCHAR(32) PRIMARY KEY,
+    product_id VARCHAR(32) NOT NULL,
+    sku VARCHAR(64) UNIQUE NOT NULL,
+    price DECIMAL(10, 2) NULL,
+    stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    options JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_product_variants_product_id ON product_variants(product_id);
+
+CREATE TABLE variant_images(
+    variant_id VARCHAR(32) NOT NULL,
+    image_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (variant_id, image_id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    FOREIGN KEY (image_id) REFERENCES images(id) ON DELETE CASCADE
+);
+
+-- el carrito y las ordenes apuntan a la variante cuando el producto tiene variantes
+ALTER TABLE car_item ADD COLUMN variant_id VARCHAR(32) NULL REFERENCES product_variants(id) ON DELETE CASCADE;
+ALTER TABLE order_items ADD COLUMN variant_id VARCHAR(32) NULL;
+ALTER TABLE order_items ADD COLUMN sku VARCHAR(64) NULL;
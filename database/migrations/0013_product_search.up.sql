@@ -0,0 +1,13 @@
+-- busqueda de productos: tsvector con el nombre (peso A) y la descripcion (peso B),
+-- y trigramas del nombre para encontrar productos aunque la busqueda tenga errores de tipeo
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- InsertProduct y UpdateProduct mantienen search_vector al dia
+ALTER TABLE products ADD COLUMN search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+UPDATE products SET search_vector =
+    setweight(to_tsvector('spanish', name), 'A') ||
+    setweight(to_tsvector('spanish', COALESCE(description, '')), 'B');
+
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
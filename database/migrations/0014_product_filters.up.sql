@@ -0,0 +1,4 @@
+-- filtros y orden de GET /products
+CREATE INDEX idx_products_user_id ON products(user_id);
+CREATE INDEX idx_products_price ON products(price, id);
+CREATE INDEX idx_products_created_at ON products(created_at, id);
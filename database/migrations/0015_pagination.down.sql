@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_roles_created_at;
+DROP INDEX IF EXISTS idx_car_item_car_id_created_at;
+ALTER TABLE roles DROP COLUMN IF EXISTS created_at;
+ALTER TABLE car_item DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,6 @@
+-- las listas paginan con un cursor sobre (created_at, id)
+ALTER TABLE car_item ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE roles ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX idx_car_item_car_id_created_at ON car_item(car_id, created_at, id);
+CREATE INDEX idx_roles_created_at ON roles(created_at, id);
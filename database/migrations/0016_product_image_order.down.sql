@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_product_images_primary;
+DROP INDEX IF EXISTS idx_product_images_position;
+ALTER TABLE product_images DROP COLUMN IF EXISTS is_primary;
+ALTER TABLE product_images DROP COLUMN IF EXISTS position;
@@ -0,0 +1,16 @@
+-- las imagenes de un producto tienen orden y una primaria, que es la url de las listas
+ALTER TABLE product_images ADD COLUMN position INT NOT NULL DEFAULT 0;
+ALTER TABLE product_images ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE product_images pi SET position = ordered.position
+FROM (
+    SELECT product_id, image_id,
+           ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY created_at, image_id) - 1 AS position
+    FROM product_images
+) ordered
+WHERE pi.product_id = ordered.product_id AND pi.image_id = ordered.image_id;
+
+UPDATE product_images SET is_primary = TRUE WHERE position = 0;
+
+CREATE INDEX idx_product_images_position ON product_images(product_id, position);
+CREATE UNIQUE INDEX idx_product_images_primary ON product_images(product_id) WHERE is_primary;
@@ -0,0 +1,9 @@
+-- mensajes del backplane que no caben en un NOTIFY (8000 bytes); el NOTIFY lleva solo el id
+-- y cada instancia los borra despues de unos minutos
+CREATE TABLE hub_envelopes(
+    id BIGSERIAL PRIMARY KEY,
+    envelope JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_hub_envelopes_created_at ON hub_envelopes(created_at);
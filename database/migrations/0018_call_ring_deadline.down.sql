@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_calls_ringing;
+ALTER TABLE calls DROP COLUMN IF EXISTS ring_deadline;
@@ -0,0 +1,4 @@
+-- la hora limite de una llamada que suena queda en la tabla para que cualquier instancia la pueda dar por perdida
+ALTER TABLE calls ADD COLUMN ring_deadline TIMESTAMPTZ NULL;
+
+CREATE INDEX idx_calls_ringing ON calls(status) WHERE status = 'ringing';
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/lib/pq"
+)
+
+func (repo *PostgresRepository) ClearWishCar(ctx context.Context, carId string) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		_, err := tx.db.ExecContext(ctx, "DELETE FROM car_item WHERE car_id = $1", carId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, "UPDATE wishcar SET total = 0 WHERE id = $1", carId)
+		return err
+	})
+}
+
+// CreateOrder reserva el stock y guarda la orden con sus items en una sola transaccion.
+// Si algun producto no alcanza devuelve *repository.OutOfStockError y no se guarda nada.
+func (repo *PostgresRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		err := tx.reserveStock(ctx, order.Items)
+		if err != nil {
+			return err
+		}
+
+		err = tx.db.QueryRowContext(
+			ctx,
+			"INSERT INTO orders (id, user_id, total, status) VALUES ($1, $2, $3, $4) RETURNING created_at",
+			order.Id,
+			order.UserId,
+			order.Total,
+			order.Status).Scan(&order.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			item.OrderId = order.Id
+			err = tx.db.QueryRowContext(
+				ctx,
+				"INSERT INTO order_items (order_id, product_id, name, unit_price, quantity, variant_id, sku) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, '')) RETURNING id",
+				item.OrderId,
+				item.ProductId,
+				item.Name,
+				item.UnitPrice,
+				item.Quantity,
+				item.VariantId,
+				item.Sku).Scan(&item.Id)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Println("orden creada", order.Id)
+
+		return nil
+	})
+}
+
+func (repo *PostgresRepository) GetOrderById(ctx context.Context, id string) (*models.Order, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, user_id, total, status, created_at FROM orders WHERE id = $1",
+		id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var order = models.Order{}
+	for rows.Next() {
+		if err = rows.Scan(&order.Id, &order.UserId, &order.Total, &order.Status, &order.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// la orden no existe, se devuelve vacia igual que el resto del repositorio
+	if order.Id == "" {
+		return &order, nil
+	}
+
+	items, err := repo.listOrderItems(ctx, []string{order.Id})
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items[order.Id]
+
+	return &order, nil
+}
+
+func (repo *PostgresRepository) ListOrders(ctx context.Context, userId string) ([]*models.Order, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, user_id, total, status, created_at FROM orders WHERE user_id = $1 ORDER BY created_at DESC",
+		userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var orders []*models.Order
+	var ids []string
+	for rows.Next() {
+		var order = models.Order{}
+		if err = rows.Scan(&order.Id, &order.UserId, &order.Total, &order.Status, &order.CreatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, &order)
+		ids = append(ids, order.Id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	items, err := repo.listOrderItems(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		order.Items = items[order.Id]
+	}
+
+	return orders, nil
+}
+
+// UpdateOrderStatus cambia el estado solo si la orden sigue en change.FromStatus
+// y deja el registro en el historial dentro de la misma transaccion.
+func (repo *PostgresRepository) UpdateOrderStatus(ctx context.Context, change *models.OrderStatusChange) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		result, err := tx.db.ExecContext(
+			ctx,
+			"UPDATE orders SET status = $1 WHERE id = $2 AND status = $3",
+			change.ToStatus,
+			change.OrderId,
+			change.FromStatus)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return repository.ErrOrderStatusConflict
+		}
+
+		// al cancelar se devuelven las unidades reservadas: los items con variante al stock
+		// de la variante y los demas al del producto, igual que en reserveStock
+		if change.ToStatus == models.OrderCancelled {
+			_, err = tx.db.ExecContext(
+				ctx,
+				`UPDATE products AS p
+				    SET stock = p.stock + oi.quantity
+				   FROM (SELECT product_id, SUM(quantity) AS quantity
+				           FROM order_items
+				          WHERE order_id = $1 AND variant_id IS NULL
+				          GROUP BY product_id) AS oi
+				  WHERE p.id = oi.product_id`,
+				change.OrderId)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.db.ExecContext(
+				ctx,
+				`UPDATE product_variants AS v
+				    SET stock = v.stock + oi.quantity
+				   FROM (SELECT variant_id, SUM(quantity) AS quantity
+				           FROM order_items
+				          WHERE order_id = $1 AND variant_id IS NOT NULL
+				          GROUP BY variant_id) AS oi
+				  WHERE v.id = oi.variant_id`,
+				change.OrderId)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.db.QueryRowContext(
+			ctx,
+			"INSERT INTO order_status_history (order_id, from_status, to_status, actor_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+			change.OrderId,
+			change.FromStatus,
+			change.ToStatus,
+			change.ActorId).Scan(&change.Id, &change.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (repo *PostgresRepository) ListOrderStatusHistory(ctx context.Context, orderId string) ([]*models.OrderStatusChange, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, order_id, from_status, to_status, actor_id, created_at FROM order_status_history WHERE order_id = $1 ORDER BY created_at",
+		orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var history []*models.OrderStatusChange
+	for rows.Next() {
+		var change = models.OrderStatusChange{}
+		if err = rows.Scan(&change.Id, &change.OrderId, &change.FromStatus, &change.ToStatus, &change.ActorId, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// stockRequest suma las unidades que piden los items de una orden por fila de products
+// o de product_variants, un mismo producto o variante puede venir en varios items.
+type stockRequest struct {
+	ids       []string
+	requested map[string]int
+	items     map[string]*models.OrderItem // un item de cada fila, para describir el faltante
+}
+
+// newStockRequests separa los items: los que tienen variante descuentan el stock de la variante
+// y los demas el del producto.
+func newStockRequests(items []*models.OrderItem) (products *stockRequest, variants *stockRequest) {
+	products = &stockRequest{requested: make(map[string]int), items: make(map[string]*models.OrderItem)}
+	variants = &stockRequest{requested: make(map[string]int), items: make(map[string]*models.OrderItem)}
+	for _, item := range items {
+		request, id := products, item.ProductId
+		if item.VariantId != "" {
+			request, id = variants, item.VariantId
+		}
+		if _, ok := request.requested[id]; !ok {
+			request.ids = append(request.ids, id)
+		}
+		request.requested[id] += item.Quantity
+		request.items[id] = item
+	}
+	return products, variants
+}
+
+// shortages compara lo pedido con lo disponible; lo que no aparece en available cuenta como stock 0.
+func (request *stockRequest) shortages(available map[string]int) []models.StockShortage {
+	var shortages []models.StockShortage
+	for _, id := range request.ids {
+		if available[id] < request.requested[id] {
+			item := request.items[id]
+			shortages = append(shortages, models.StockShortage{
+				ProductId: item.ProductId,
+				VariantId: item.VariantId,
+				Name:      item.Name,
+				Requested: request.requested[id],
+				Available: available[id],
+			})
+		}
+	}
+	return shortages
+}
+
+// reserveStock debe llamarse dentro de una transaccion: bloquea las filas de los productos
+// y de las variantes (FOR UPDATE), verifica que haya unidades suficientes y las descuenta.
+func (repo *PostgresRepository) reserveStock(ctx context.Context, items []*models.OrderItem) error {
+	products, variants := newStockRequests(items)
+
+	// siempre primero products y luego product_variants para tomar los bloqueos en el mismo orden
+	var shortages []models.StockShortage
+	for _, reservation := range []struct {
+		table   string
+		request *stockRequest
+	}{{"products", products}, {"product_variants", variants}} {
+		if len(reservation.request.ids) == 0 {
+			continue
+		}
+		available, err := repo.lockStock(ctx, reservation.table, reservation.request.ids)
+		if err != nil {
+			return err
+		}
+		shortages = append(shortages, reservation.request.shortages(available)...)
+	}
+	if len(shortages) > 0 {
+		return &repository.OutOfStockError{Items: shortages}
+	}
+
+	for _, id := range products.ids {
+		_, err := repo.db.ExecContext(ctx, "UPDATE products SET stock = stock - $1 WHERE id = $2", products.requested[id], id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range variants.ids {
+		_, err := repo.db.ExecContext(ctx, "UPDATE product_variants SET stock = stock - $1 WHERE id = $2", variants.requested[id], id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockStock bloquea las filas de table y devuelve su stock; table es products o product_variants.
+func (repo *PostgresRepository) lockStock(ctx context.Context, table string, ids []string) (map[string]int, error) {
+	// ORDER BY id para tomar los bloqueos siempre en el mismo orden y evitar deadlocks
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, stock FROM "+table+" WHERE id = ANY($1) ORDER BY id FOR UPDATE",
+		pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	available := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var stock int
+		if err = rows.Scan(&id, &stock); err != nil {
+			return nil, err
+		}
+		available[id] = stock
+	}
+	return available, rows.Err()
+}
+
+// listOrderItems trae los items de varias ordenes en una sola consulta, agrupados por orden.
+func (repo *PostgresRepository) listOrderItems(ctx context.Context, orderIds []string) (map[string][]*models.OrderItem, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, order_id, product_id, COALESCE(variant_id, ''), COALESCE(sku, ''), name, unit_price, quantity FROM order_items WHERE order_id = ANY($1)",
+		pq.Array(orderIds))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	items := make(map[string][]*models.OrderItem)
+	for rows.Next() {
+		var item = models.OrderItem{}
+		if err = rows.Scan(&item.Id, &item.OrderId, &item.ProductId, &item.VariantId, &item.Sku, &item.Name, &item.UnitPrice, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items[item.OrderId] = append(items[item.OrderId], &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
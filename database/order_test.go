@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/segmentio/ksuid"
+)
+
+// CreateOrder reserva el stock: todo o nada, sumando los items repetidos y descontando de la
+// variante cuando el item la tiene.
+func TestCreateOrderReservesStock(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo repository.Repository) {
+		ctx := context.Background()
+		customer := newTestUser(t, repo)
+		merchant := newTestUser(t, repo)
+
+		type stock struct{ mouse, shirt, small int }
+		for _, test := range []struct {
+			name      string
+			items     func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem
+			shortages string
+			after     stock
+		}{
+			{
+				name: "enough stock",
+				items: func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem {
+					return []*models.OrderItem{{ProductId: mouse.Id, Quantity: 2}, {ProductId: shirt.Id, VariantId: small.Id, Quantity: 1}}
+				},
+				after: stock{mouse: 2, shirt: 3, small: 1},
+			},
+			{
+				name: "repeated items add up",
+				items: func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem {
+					return []*models.OrderItem{{ProductId: mouse.Id, Quantity: 2}, {ProductId: mouse.Id, Quantity: 2}}
+				},
+				after: stock{mouse: 0, shirt: 3, small: 2},
+			},
+			{
+				name: "product short",
+				items: func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem {
+					return []*models.OrderItem{{ProductId: mouse.Id, Quantity: 3}, {ProductId: mouse.Id, Quantity: 2}, {ProductId: shirt.Id, VariantId: small.Id, Quantity: 1}}
+				},
+				shortages: "[mouse:5/4]",
+				after:     stock{mouse: 4, shirt: 3, small: 2},
+			},
+			{
+				name: "variant short",
+				items: func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem {
+					return []*models.OrderItem{{ProductId: mouse.Id, Quantity: 1}, {ProductId: shirt.Id, VariantId: small.Id, Quantity: 3}}
+				},
+				shortages: "[small:3/2]",
+				after:     stock{mouse: 4, shirt: 3, small: 2},
+			},
+			{
+				name: "missing product",
+				items: func(mouse *models.Product, shirt *models.Product, small *models.Variant) []*models.OrderItem {
+					return []*models.OrderItem{{ProductId: ksuid.New().String(), Quantity: 1}}
+				},
+				shortages: "[missing:1/0]",
+				after:     stock{mouse: 4, shirt: 3, small: 2},
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				mouse := newTestProduct(t, repo, merchant, models.Product{Name: "Mouse", Price: 10, Stock: 4})
+				shirt := newTestProduct(t, repo, merchant, models.Product{Name: "Camiseta", Price: 20, Stock: 3})
+				small := newTestVariant(t, repo, shirt, 2)
+				names := map[string]string{mouse.Id: "mouse", small.Id: "small"}
+
+				items := test.items(mouse, shirt, small)
+				for _, item := range items {
+					item.Name = "item"
+				}
+				order := &models.Order{Id: ksuid.New().String(), UserId: customer.Id, Status: models.OrderPending, Items: items}
+				err := repo.CreateOrder(ctx, order)
+
+				var stockErr *repository.OutOfStockError
+				if test.shortages == "" && err != nil {
+					t.Fatal(err)
+				}
+				if test.shortages != "" {
+					if !errors.As(err, &stockErr) {
+						t.Fatalf("expected OutOfStockError, got %v", err)
+					}
+					var shortages []string
+					for _, shortage := range stockErr.Items {
+						name, ok := names[shortage.VariantId]
+						if shortage.VariantId == "" {
+							name, ok = names[shortage.ProductId]
+						}
+						if !ok {
+							name = "missing"
+						}
+						shortages = append(shortages, fmt.Sprintf("%s:%d/%d", name, shortage.Requested, shortage.Available))
+					}
+					if fmt.Sprint(shortages) != test.shortages {
+						t.Fatalf("shortages: expected %s, got %v", test.shortages, shortages)
+					}
+					if stored, _ := repo.GetOrderById(ctx, order.Id); stored.Id != "" {
+						t.Fatal("a rejected order was stored")
+					}
+				}
+
+				variant, err := repo.GetVariantById(ctx, small.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := stock{mouse: productStock(t, repo, mouse.Id), shirt: productStock(t, repo, shirt.Id), small: variant.Stock}
+				if got != test.after {
+					t.Fatalf("stock: expected %+v, got %+v", test.after, got)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+// keysetSQL devuelve la condicion del cursor sobre (key, id) y el ORDER BY ... LIMIT de la consulta.
+// Las filas de un cursor Before se leen al reves (las mas cercanas al cursor primero) y keysetPage
+// las vuelve a ordenar. Se lee una fila de mas para saber si hay otra pagina.
+func keysetSQL(key string, id string, desc bool, request models.PageRequest, args []interface{}) (string, string, []interface{}) {
+	if request.Cursor != nil && request.Cursor.Before {
+		desc = !desc
+	}
+	direction, compare := "", ">"
+	if desc {
+		direction, compare = " DESC", "<"
+	}
+
+	condition := "TRUE"
+	if request.Cursor != nil {
+		args = append(args, request.Cursor.Key, request.Cursor.Id)
+		condition = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", key, id, compare, len(args)-1, len(args))
+	}
+	order := fmt.Sprintf("ORDER BY %s%s, %s%s", key, direction, id, direction)
+	if request.Limit > 0 {
+		args = append(args, request.Limit+1)
+		order += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return condition, order, args
+}
+
+// keysetPage arma la pagina con las filas que leyo la consulta de keysetSQL (o memoryPage).
+// cursor devuelve la posicion de una fila.
+func keysetPage[T any](rows []T, request models.PageRequest, total int, cursor func(row T) models.Cursor) *models.Page[T] {
+	backward := request.Cursor != nil && request.Cursor.Before
+	more := request.Limit > 0 && len(rows) > request.Limit
+	if more {
+		rows = rows[:request.Limit]
+	}
+	if backward {
+		slices.Reverse(rows)
+	}
+
+	page := &models.Page[T]{Items: rows, Total: total}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	// hacia atras siempre queda la fila del cursor adelante, y hacia adelante la del cursor atras
+	hasNext := backward || more
+	hasPrev := request.Cursor != nil && !backward || backward && more
+
+	if len(rows) == 0 {
+		// una pagina vacia vuelve desde la posicion del cursor
+		if request.Cursor != nil {
+			back := *request.Cursor
+			back.Before = !back.Before
+			if backward {
+				page.Next = back.Encode()
+			} else {
+				page.Prev = back.Encode()
+			}
+		}
+		return page
+	}
+	if hasNext {
+		next := cursor(rows[len(rows)-1])
+		next.Before = false
+		page.Next = next.Encode()
+	}
+	if hasPrev {
+		prev := cursor(rows[0])
+		prev.Before = true
+		page.Prev = prev.Encode()
+	}
+	return page
+}
+
+// memoryPage hace lo mismo que keysetSQL y keysetPage sobre rows ya ordenadas.
+// compare devuelve si la fila va antes (<0) o despues (>0) de la posicion del cursor.
+func memoryPage[T any](rows []T, request models.PageRequest, cursor func(row T) models.Cursor, compare func(row T, cursor models.Cursor) int) *models.Page[T] {
+	total := len(rows)
+	if request.Cursor != nil {
+		var selected []T
+		for _, row := range rows {
+			if c := compare(row, *request.Cursor); c > 0 && !request.Cursor.Before || c < 0 && request.Cursor.Before {
+				selected = append(selected, row)
+			}
+		}
+		if request.Cursor.Before {
+			slices.Reverse(selected)
+		}
+		rows = selected
+	}
+	if request.Limit > 0 && len(rows) > request.Limit+1 {
+		rows = rows[:request.Limit+1]
+	}
+	return keysetPage(slices.Clone(rows), request, total, cursor)
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+)
+
+func TestListProductKeysetPaging(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo repository.Repository) {
+		ctx := context.Background()
+		merchant := newTestUser(t, repo)
+
+		// hay precios y nombres repetidos: el id desempata, asi que el orden esperado depende de los ids
+		letter := map[string]string{} // id -> a, b, c... en el orden de insercion
+		var products []*models.Product
+		for _, product := range []models.Product{
+			{Name: "Mouse", Price: 30},
+			{Name: "Cable", Price: 10},
+			{Name: "Teclado", Price: 50},
+			{Name: "Cable", Price: 30},
+			{Name: "Monitor", Price: 40},
+		} {
+			products = append(products, newTestProduct(t, repo, merchant, product))
+		}
+		for i, product := range products {
+			letter[product.Id] = string(rune('a' + i))
+		}
+		pair := func(i, j int) string {
+			if products[i].Id < products[j].Id {
+				return letter[products[i].Id] + letter[products[j].Id]
+			}
+			return letter[products[j].Id] + letter[products[i].Id]
+		}
+		reverse := func(s string) string {
+			runes := []rune(s)
+			for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+				runes[i], runes[j] = runes[j], runes[i]
+			}
+			return string(runes)
+		}
+
+		for _, test := range []struct {
+			sort     string
+			expected string
+		}{
+			{models.ProductSortPriceAsc, "b" + pair(0, 3) + "ec"},
+			{models.ProductSortPriceDesc, "ce" + reverse(pair(0, 3)) + "b"},
+			{models.ProductSortName, pair(1, 3) + "eac"},
+		} {
+			t.Run(test.sort, func(t *testing.T) {
+				filter := &models.ProductFilter{UserId: merchant.Id, Sort: test.sort}
+				list := func(cursor string) *models.Page[*models.ProductList] {
+					t.Helper()
+					request := models.PageRequest{Limit: 2}
+					if cursor != "" {
+						decoded, err := models.DecodeCursor(cursor)
+						if err != nil {
+							t.Fatal(err)
+						}
+						request.Cursor = decoded
+					}
+					page, err := repo.ListProduct(ctx, filter, request)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if page.Total != len(products) {
+						t.Fatalf("total: %d", page.Total)
+					}
+					return page
+				}
+				names := func(page *models.Page[*models.ProductList]) string {
+					var got strings.Builder
+					for _, product := range page.Items {
+						got.WriteString(letter[product.Id])
+					}
+					return got.String()
+				}
+
+				// hacia adelante hasta la ultima pagina
+				var pages []*models.Page[*models.ProductList]
+				var got string
+				for page := list(""); ; page = list(page.Next) {
+					pages = append(pages, page)
+					got += names(page)
+					if page.Next == "" {
+						break
+					}
+				}
+				if got != test.expected || len(pages) != 3 {
+					t.Fatalf("forward: expected %s, got %s in %d pages", test.expected, got, len(pages))
+				}
+				if pages[0].Prev != "" {
+					t.Fatal("first page has prev")
+				}
+
+				// y de vuelta con prev las mismas paginas
+				page := pages[len(pages)-1]
+				for i := len(pages) - 2; i >= 0; i-- {
+					page = list(page.Prev)
+					if names(page) != names(pages[i]) {
+						t.Fatalf("backward page %d: expected %s, got %s", i, names(pages[i]), names(page))
+					}
+				}
+				if page.Prev != "" {
+					t.Fatal("first page reached backward has prev")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func (repo *PostgresRepository) RemoveRoleUser(ctx context.Context, userId string, roleId int) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM users_roles WHERE user_id = $1 AND role_id = $2", userId, roleId)
+	return err
+}
+
+func (repo *PostgresRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT id, name, COALESCE(description, '') FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var permissions []*models.Permission
+	for rows.Next() {
+		var permission = models.Permission{}
+		if err = rows.Scan(&permission.Id, &permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (repo *PostgresRepository) GetPermission(ctx context.Context, name string) (*models.Permission, error) {
+	var permission = models.Permission{}
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT id, name, COALESCE(description, '') FROM permissions WHERE name = $1",
+		name).Scan(&permission.Id, &permission.Name, &permission.Description)
+	if err == sql.ErrNoRows {
+		return &models.Permission{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &permission, nil
+}
+
+func (repo *PostgresRepository) GetRolePermissions(ctx context.Context, roleId int) ([]string, error) {
+	return repo.listNames(
+		ctx,
+		`SELECT p.name FROM role_permissions rp JOIN permissions p ON rp.permission_id = p.id
+		WHERE rp.role_id = $1 ORDER BY p.name`,
+		roleId)
+}
+
+func (repo *PostgresRepository) GrantPermission(ctx context.Context, roleId int, permissionId int) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		roleId,
+		permissionId)
+	return err
+}
+
+func (repo *PostgresRepository) RevokePermission(ctx context.Context, roleId int, permissionId int) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2", roleId, permissionId)
+	return err
+}
+
+// GetUserPermissions junta los permisos de todos los roles del usuario.
+func (repo *PostgresRepository) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	return repo.listNames(
+		ctx,
+		`SELECT DISTINCT p.name FROM users_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE ur.user_id = $1 ORDER BY p.name`,
+		userId)
+}
+
+func (repo *PostgresRepository) InsertGrantAudit(ctx context.Context, audit *models.GrantAudit) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO grant_audit (actor_id, action, user_id, role, permission) VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, '')) RETURNING id, created_at",
+		audit.ActorId,
+		audit.Action,
+		audit.UserId,
+		audit.Role,
+		audit.Permission).Scan(&audit.Id, &audit.CreatedAt)
+}
+
+func (repo *PostgresRepository) ListGrantAudit(ctx context.Context) ([]*models.GrantAudit, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, actor_id, action, COALESCE(user_id, ''), role, COALESCE(permission, ''), created_at FROM grant_audit ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var entries []*models.GrantAudit
+	for rows.Next() {
+		var audit = models.GrantAudit{}
+		if err = rows.Scan(&audit.Id, &audit.ActorId, &audit.Action, &audit.UserId, &audit.Role, &audit.Permission, &audit.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &audit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// listNames ejecuta una consulta que devuelve una sola columna de texto.
+func (repo *PostgresRepository) listNames(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
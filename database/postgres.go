@@ -5,8 +5,11 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
 	_ "github.com/lib/pq" // necesarion para que los drives de postgres funcionen.
 )
 
@@ -14,8 +17,18 @@ const (
 	PAGINATION_SIZE = 34
 )
 
+// querier agrupa los metodos que comparten *sql.DB y *sql.Tx,
+// asi cada metodo del repositorio funciona igual dentro o fuera de una transaccion.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type PostgresRepository struct {
-	db *sql.DB
+	db   querier // conexion o transaccion sobre la que se ejecutan las consultas
+	pool *sql.DB
+	tx   *sql.Tx // distinto de nil cuando el repositorio esta atado a una transaccion
 }
 
 func NewPostgresRepository(url string) (*PostgresRepository, error) {
@@ -23,7 +36,41 @@ func NewPostgresRepository(url string) (*PostgresRepository, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresRepository{db}, nil
+	return &PostgresRepository{db: db, pool: db}, nil
+}
+
+// WithTx ejecuta fn con un repositorio atado a una sola transaccion (unit of work).
+// Si fn devuelve un error se hace rollback de todo, si no se hace commit.
+func (repo *PostgresRepository) WithTx(ctx context.Context, fn func(repository.Repository) error) error {
+	return repo.inTx(ctx, func(tx *PostgresRepository) error {
+		return fn(tx)
+	})
+}
+
+// inTx abre una transaccion o, si el repositorio ya esta dentro de una, la reutiliza.
+func (repo *PostgresRepository) inTx(ctx context.Context, fn func(tx *PostgresRepository) error) (err error) {
+	if repo.tx != nil {
+		return fn(repo)
+	}
+
+	tx, err := repo.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(&PostgresRepository{db: tx, pool: repo.pool, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repo *PostgresRepository) InsertUser(ctx context.Context, user *models.User) error {
@@ -34,7 +81,7 @@ func (repo *PostgresRepository) InsertUser(ctx context.Context, user *models.Use
 }
 
 func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, email FROM users WHERE id = $1", id)
+	rows, err := repo.db.QueryContext(ctx, "SELECT id, email, email_verified_at FROM users WHERE id = $1", id)
 
 	defer func() {
 		err = rows.Close()
@@ -46,7 +93,11 @@ func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*mo
 	var user = models.User{}
 	for rows.Next() {
 		// toma rows he intenta mapear los valores de las columnas "SELECT id email FROM" dentro del modelo de datos de usuario.
-		if err = rows.Scan(&user.Id, &user.Email); err == nil { // parseo datos para se adaptados al modelo user
+		var verifiedAt sql.NullTime
+		if err = rows.Scan(&user.Id, &user.Email, &verifiedAt); err == nil { // parseo datos para se adaptados al modelo user
+			if verifiedAt.Valid {
+				user.EmailVerifiedAt = &verifiedAt.Time
+			}
 			log.Println(user)
 			return &user, nil
 		}
@@ -61,7 +112,7 @@ func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*mo
 }
 
 func (repo *PostgresRepository) Close() error {
-	return repo.db.Close() // cierra conexion de la base de datos cuando se deja usar.
+	return repo.pool.Close() // cierra conexion de la base de datos cuando se deja usar.
 }
 
 func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
@@ -95,7 +146,7 @@ func (repo *PostgresRepository) InsertProduct(ctx context.Context, product *mode
 	// execContext permite ejecutar codigo sql
 	_, err := repo.db.ExecContext(
 		ctx,
-		"INSERT INTO products (id, name, price, stock, user_id, description) VALUES ($1, $2, $3, $4, $5, $6)",
+		"INSERT INTO products (id, name, price, stock, user_id, description, search_vector) VALUES ($1, $2, $3, $4, $5, $6, "+productSearchVector("$2", "$6")+")",
 		product.Id,
 		product.Name,
 		product.Price,
@@ -109,7 +160,7 @@ func (repo *PostgresRepository) InsertProduct(ctx context.Context, product *mode
 func (repo *PostgresRepository) UpdateProduct(ctx context.Context, product *models.Product) error {
 	_, err := repo.db.ExecContext(
 		ctx,
-		"UPDATE products SET name = $1, description = $2, price = $3, stock = $4 WHERE id = $5 and user_id = $6",
+		"UPDATE products SET name = $1, description = $2, price = $3, stock = $4, search_vector = "+productSearchVector("$1", "$2")+" WHERE id = $5 and user_id = $6",
 		product.Name,
 		product.Description,
 		product.Price,
@@ -124,8 +175,17 @@ func (repo *PostgresRepository) DeleteProduct(ctx context.Context, id string, us
 	return err
 }
 
-func (repo *PostgresRepository) ListProduct(ctx context.Context, page uint64) ([]*models.ProductList, error) {
-	// offset es la cantidad de registros que se saltara
+// ListProduct pagina con un cursor sobre la columna de orden y el id, asi las paginas no se corren
+// cuando se agregan productos y no hace falta saltar filas con OFFSET.
+func (repo *PostgresRepository) ListProduct(ctx context.Context, filter *models.ProductFilter, request models.PageRequest) (*models.Page[*models.ProductList], error) {
+	where, args := productFilterSQL(*filter, nil)
+	var total int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products p WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	key, desc := productSortKey(filter.Sort)
+	after, order, args := keysetSQL(key, "p.id", desc, request, args)
 	rows, err := repo.db.QueryContext(
 		ctx,
 		`SELECT 
@@ -135,14 +195,11 @@ func (repo *PostgresRepository) ListProduct(ctx context.Context, page uint64) ([
 			p.stock, 
 			p.user_id, 
 			p.description, 
-			p.created_at,
-			COALESCE(STRING_AGG(i.url, ', '), '/uploads/default/product.jpg') AS image_urls
+			p.created_at
 		 FROM products p
-		 LEFT JOIN product_images pi ON p.id = pi.product_id
-		 LEFT JOIN images i ON pi.image_id = i.id
-		 GROUP BY p.id
-		 LIMIT $1 OFFSET $2`,
-		PAGINATION_SIZE, page*PAGINATION_SIZE,
+		 WHERE `+where+` AND `+after+`
+		 `+order,
+		args...,
 	)
 
 	if err != nil {
@@ -166,8 +223,7 @@ func (repo *PostgresRepository) ListProduct(ctx context.Context, page uint64) ([
 			&product.Stock,
 			&product.User_id,
 			&product.Description,
-			&product.CreatedAt,
-			&product.Url); err == nil {
+			&product.CreatedAt); err == nil {
 
 			products = append(products, &product)
 		}
@@ -176,12 +232,21 @@ func (repo *PostgresRepository) ListProduct(ctx context.Context, page uint64) ([
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	if err = repo.attachImages(ctx, products...); err != nil {
+		return nil, err
+	}
 
-	return products, nil
+	return keysetPage(products, request, total, func(product *models.ProductList) models.Cursor {
+		return productCursor(filter.Sort, product)
+	}), nil
 }
 
 func (repo *PostgresRepository) GetProductById(ctx context.Context, id string) (*models.ProductList, error) {
-	rows, err := repo.db.QueryContext(
+	log.Println("in date base", id)
+
+	// QueryRow libera la conexion antes de buscar las imagenes, que dentro de una tx usan la misma
+	var product = models.ProductList{}
+	err := repo.db.QueryRowContext(
 		ctx,
 		`SELECT p.id,
 			p.name,
@@ -189,39 +254,20 @@ func (repo *PostgresRepository) GetProductById(ctx context.Context, id string) (
 			p.stock,
 			p.user_id,
 			p.description,
-			p.created_at,
-			COALESCE(i.url, '/uploads/default/product.jpg') AS url
+			p.created_at
 		FROM products AS p
-		LEFT JOIN product_images AS pi ON pi.product_id = p.id
-		LEFT JOIN images AS i ON i.id = pi.image_id
 		WHERE p.id = $1;`,
 		id,
-	)
-	//SELECT r.name FROM users_roles ur JOIN roles r ON ur.role_id = r.id WHERE ur.user_id = $1
-
-	log.Println("in date base", id)
-
-	defer func() {
-		err = rows.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
-	var product = models.ProductList{}
-	for rows.Next() {
-		// toma rows he intenta mapear los valores de las columnas "SELECT id email FROM" dentro del modelo de datos de usuario.
-		if err = rows.Scan(&product.Id, &product.Name, &product.Price, &product.Stock, &product.User_id, &product.Description, &product.CreatedAt, &product.Url); err == nil { // parseo datos para se adaptados al modelo post
-			return &product, nil
-		}
+	).Scan(&product.Id, &product.Name, &product.Price, &product.Stock, &product.User_id, &product.Description, &product.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &models.ProductList{}, nil
 	}
-
-	if err = rows.Err(); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
 	log.Println(product)
-	return &product, nil
+	return &product, repo.attachImages(ctx, &product)
 }
 
 func (repo *PostgresRepository) InsertImage(ctx context.Context, image *models.Image) (string, error) {
@@ -238,16 +284,6 @@ func (repo *PostgresRepository) InsertImage(ctx context.Context, image *models.I
 	return imageID, err
 }
 
-func (repo *PostgresRepository) LinkProductToImage(ctx context.Context, productID string, imageID string) error {
-	_, err := repo.db.ExecContext(
-		ctx,
-		"INSERT INTO product_images (product_id, image_id) VALUES ($1, $2)",
-		productID,
-		imageID,
-	)
-	return err
-}
-
 func (repo *PostgresRepository) GetImageById(ctx context.Context, productId string) (*models.Image, error) {
 	rows, err := repo.db.QueryContext(ctx, "SELECT product_id, image_id, created_at FROM product_images WHERE product_id = $1", productId)
 
@@ -304,10 +340,11 @@ func (repo *PostgresRepository) AddItem(ctx context.Context, carItem *models.Car
 	log.Println("AddItem", carItem)
 	_, err := repo.db.ExecContext(
 		ctx,
-		"INSERT INTO car_item (car_id, product_id, quantity) VALUES ($1, $2, $3)",
+		"INSERT INTO car_item (car_id, product_id, quantity, variant_id) VALUES ($1, $2, $3, NULLIF($4, ''))",
 		carItem.CarId,
 		carItem.ProductId,
-		carItem.Quantity)
+		carItem.Quantity,
+		carItem.VariantId)
 
 	return err
 }
@@ -317,16 +354,17 @@ func (repo *PostgresRepository) RemoveItem(ctx context.Context, productId string
 	return err
 }
 
-func (repo *PostgresRepository) UpdateQuantity(ctx context.Context, productId string, quantity int) error {
-	_, err := repo.db.ExecContext(ctx, "UPDATE car_item SET quantity = quantity + $1 WHERE product_id = $2", quantity, productId)
+func (repo *PostgresRepository) UpdateQuantity(ctx context.Context, itemId string, quantity int) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE car_item SET quantity = quantity + $1 WHERE id = $2", quantity, itemId)
 	return err
 }
 
-func (repo *PostgresRepository) GetItem(ctx context.Context, productId string, carId string) (*models.CarItem, error) {
+func (repo *PostgresRepository) GetItem(ctx context.Context, productId string, variantId string, carId string) (*models.CarItem, error) {
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, car_id, product_id, quantity FROM car_item WHERE product_id = $1 AND car_id = $2",
+		"SELECT id, car_id, product_id, COALESCE(variant_id, ''), quantity FROM car_item WHERE product_id = $1 AND COALESCE(variant_id, '') = $2 AND car_id = $3",
 		productId,
+		variantId,
 		carId)
 
 	defer func() {
@@ -337,7 +375,7 @@ func (repo *PostgresRepository) GetItem(ctx context.Context, productId string, c
 	}()
 	var carItem = models.CarItem{}
 	for rows.Next() {
-		if err = rows.Scan(&carItem.Id, &carItem.CarId, &carItem.ProductId, &carItem.Quantity); err == nil {
+		if err = rows.Scan(&carItem.Id, &carItem.CarId, &carItem.ProductId, &carItem.VariantId, &carItem.Quantity); err == nil {
 			return &carItem, nil
 		}
 	}
@@ -387,18 +425,31 @@ func (repo *PostgresRepository) UpdateWishCar(ctx context.Context, wishCar *mode
 	return err
 }
 
-func (repo *PostgresRepository) ListItems(ctx context.Context, userId string) ([]*models.CarItem, error) {
-	// offset es la cantidad de registros que se saltara
+func (repo *PostgresRepository) ListItems(ctx context.Context, userId string, request models.PageRequest) (*models.Page[*models.CarItem], error) {
+	var total int
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM car_item ci JOIN wishcar w ON w.id = ci.car_id WHERE w.user_id = $1",
+		userId,
+	).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	after, order, args := keysetSQL("ci.created_at", "ci.id::text", false, request, []interface{}{userId})
 	rows, err := repo.db.QueryContext(
 		ctx,
 		`SELECT ci.id, 
 				ci.car_id, 
 				ci.product_id, 
-				ci.quantity
+				COALESCE(ci.variant_id, ''),
+				ci.quantity,
+				ci.created_at
 		   FROM car_item AS ci
 		   JOIN wishcar AS w ON w.id = ci.car_id
-		  WHERE w.user_id = $1`,
-		userId,
+		  WHERE w.user_id = $1 AND `+after+`
+		  `+order,
+		args...,
 	)
 
 	if err != nil {
@@ -420,7 +471,9 @@ func (repo *PostgresRepository) ListItems(ctx context.Context, userId string) ([
 			&carItem.Id,
 			&carItem.CarId,
 			&carItem.ProductId,
-			&carItem.Quantity); err == nil {
+			&carItem.VariantId,
+			&carItem.Quantity,
+			&carItem.CreatedAt); err == nil {
 			carItems = append(carItems, &carItem)
 		}
 	}
@@ -429,7 +482,9 @@ func (repo *PostgresRepository) ListItems(ctx context.Context, userId string) ([
 		return nil, err
 	}
 	log.Println("itemscar:", carItems)
-	return carItems, nil
+	return keysetPage(carItems, request, total, func(item *models.CarItem) models.Cursor {
+		return models.Cursor{Key: item.CreatedAt.Format(time.RFC3339Nano), Id: item.Id}
+	}), nil
 }
 
 // roles
@@ -442,10 +497,17 @@ func (repo *PostgresRepository) CreateRole(ctx context.Context, role *models.Rol
 	return err
 }
 
-func (repo *PostgresRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+func (repo *PostgresRepository) ListRoles(ctx context.Context, request models.PageRequest) (*models.Page[*models.Role], error) {
+	var total int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM roles").Scan(&total); err != nil {
+		return nil, err
+	}
+
+	after, order, args := keysetSQL("created_at", "id", false, request, nil)
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, name FROM roles")
+		"SELECT id, name, created_at FROM roles WHERE "+after+" "+order,
+		args...)
 	if err != nil {
 		return nil, err
 	}
@@ -462,7 +524,8 @@ func (repo *PostgresRepository) ListRoles(ctx context.Context) ([]*models.Role,
 		var role = models.Role{}
 		if err = rows.Scan(
 			&role.Id,
-			&role.Name); err == nil {
+			&role.Name,
+			&role.CreatedAt); err == nil {
 			roles = append(roles, &role)
 		}
 	}
@@ -471,13 +534,18 @@ func (repo *PostgresRepository) ListRoles(ctx context.Context) ([]*models.Role,
 		return nil, err
 	}
 
-	return roles, nil
+	return keysetPage(roles, request, total, roleCursor), nil
+}
+
+// roleCursor es la posicion del rol en el orden (created_at, id).
+func roleCursor(role *models.Role) models.Cursor {
+	return models.Cursor{Key: role.CreatedAt.Format(time.RFC3339Nano), Id: strconv.Itoa(role.Id)}
 }
 
 func (repo *PostgresRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, name FROM roles WHERE name= $1",
+		"SELECT id, name, created_at FROM roles WHERE name= $1",
 		name)
 
 	defer func() {
@@ -489,7 +557,7 @@ func (repo *PostgresRepository) GetRole(ctx context.Context, name string) (*mode
 
 	var role = models.Role{}
 	for rows.Next() {
-		if err = rows.Scan(&role.Id, &role.Name); err == nil {
+		if err = rows.Scan(&role.Id, &role.Name, &role.CreatedAt); err == nil {
 			return &role, nil
 		}
 
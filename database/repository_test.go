@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/segmentio/ksuid"
+)
+
+// forEachRepository corre test sobre memoria y, si TEST_DATABASE_URL esta definida, sobre postgres.
+// La base de postgres se comparte entre corridas: los fixtures usan ids y emails nuevos cada vez.
+func forEachRepository(t *testing.T, test func(t *testing.T, repo repository.Repository)) {
+	for _, driver := range []string{"memory", "postgres"} {
+		t.Run(driver, func(t *testing.T) {
+			if driver == "memory" {
+				test(t, NewMemoryRepository())
+				return
+			}
+			url := os.Getenv("TEST_DATABASE_URL")
+			if url == "" {
+				t.Skip("TEST_DATABASE_URL is not set")
+			}
+			repo, err := NewPostgresRepository(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { repo.Close() })
+			test(t, repo)
+		})
+	}
+}
+
+func newTestUser(t *testing.T, repo repository.Repository) *models.User {
+	t.Helper()
+	id := ksuid.New().String()
+	user := &models.User{Id: id, Email: id + "@store.com", Password: "secret"}
+	if err := repo.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func newTestProduct(t *testing.T, repo repository.Repository, owner *models.User, product models.Product) *models.Product {
+	t.Helper()
+	product.Id = ksuid.New().String()
+	product.User_id = owner.Id
+	if err := repo.InsertProduct(context.Background(), &product); err != nil {
+		t.Fatal(err)
+	}
+	return &product
+}
+
+func newTestCategory(t *testing.T, repo repository.Repository, name string, parent *models.Category) *models.Category {
+	t.Helper()
+	id := ksuid.New().String()
+	category := &models.Category{Id: id, Name: name, Slug: strings.ToLower(name) + "-" + strings.ToLower(id)}
+	if parent != nil {
+		category.ParentId = parent.Id
+	}
+	if err := repo.InsertCategory(context.Background(), category); err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
+
+func newTestVariant(t *testing.T, repo repository.Repository, product *models.Product, stock int) *models.Variant {
+	t.Helper()
+	id := ksuid.New().String()
+	variant := &models.Variant{Id: id, ProductId: product.Id, Sku: "SKU-" + id, Stock: stock, Options: map[string]string{"size": id}}
+	if err := repo.InsertVariant(context.Background(), variant); err != nil {
+		t.Fatal(err)
+	}
+	return variant
+}
+
+func productStock(t *testing.T, repo repository.Repository, id string) int {
+	t.Helper()
+	product, err := repo.GetProductById(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product.Stock
+}
+
+// un error a mitad de WithTx deshace los pasos anteriores: la orden, la reserva de stock y el vaciado del carrito
+func TestWithTxRollsBackOnError(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo repository.Repository) {
+		ctx := context.Background()
+		customer := newTestUser(t, repo)
+		merchant := newTestUser(t, repo)
+		mouse := newTestProduct(t, repo, merchant, models.Product{Name: "Mouse", Price: 10, Stock: 5})
+
+		car := models.NewCar(ksuid.New().String(), customer.Id, 20)
+		if err := repo.CreateWishCar(ctx, car); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddItem(ctx, &models.CarItem{CarId: car.Id, ProductId: mouse.Id, Quantity: 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		order := &models.Order{
+			Id:     ksuid.New().String(),
+			UserId: customer.Id,
+			Total:  20,
+			Status: models.OrderPending,
+			Items:  []*models.OrderItem{{ProductId: mouse.Id, Name: mouse.Name, UnitPrice: mouse.Price, Quantity: 2}},
+		}
+		var secondErr error
+		err := repo.WithTx(ctx, func(tx repository.Repository) error {
+			if err := tx.CreateOrder(ctx, order); err != nil {
+				return err
+			}
+			if err := tx.ClearWishCar(ctx, car.Id); err != nil {
+				return err
+			}
+			// la misma orden otra vez falla por el id repetido
+			secondErr = tx.CreateOrder(ctx, order)
+			return secondErr
+		})
+		if secondErr == nil || !errors.Is(err, secondErr) {
+			t.Fatalf("expected the second CreateOrder to fail the transaction, got %v", err)
+		}
+
+		stored, err := repo.GetOrderById(ctx, order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Id != "" {
+			t.Fatalf("order %s survived the rollback", stored.Id)
+		}
+		if stock := productStock(t, repo, mouse.Id); stock != 5 {
+			t.Fatalf("stock after rollback: %d", stock)
+		}
+		items, err := repo.ListItems(ctx, customer.Id, models.PageRequest{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items.Items) != 1 || items.Items[0].Quantity != 2 {
+			t.Fatalf("cart after rollback: %+v", items.Items)
+		}
+		storedCar, err := repo.GetWishCarById(ctx, customer.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if storedCar.Total != 20 {
+			t.Fatalf("cart total after rollback: %v", storedCar.Total)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+const (
+	// configuracion de texto de postgres con la que se indexan y buscan los productos
+	SEARCH_CONFIG = "spanish"
+
+	// ts_headline marca las palabras con estos caracteres y despues se cambian por <mark>,
+	// asi el resto del texto se puede escapar
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// productSearchVector arma el tsvector de un producto a partir de los parametros del nombre y la descripcion.
+// Los casts mantienen el tipo que postgres deduce para el parametro en el resto de la consulta.
+func productSearchVector(name string, description string) string {
+	return fmt.Sprintf(
+		"setweight(to_tsvector('%s', %s::varchar), 'A') || setweight(to_tsvector('%s', COALESCE(%s::text, '')), 'B')",
+		SEARCH_CONFIG, name, SEARCH_CONFIG, description)
+}
+
+// markHighlight escapa el fragmento y cambia los marcadores de ts_headline por <mark>.
+func markHighlight(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	return strings.ReplaceAll(text, highlightStop, "</mark>")
+}
+
+// SearchProducts busca en el nombre y la descripcion con el tsvector y, para tolerar errores de tipeo,
+// con la similitud de trigramas de cada palabra del nombre (operador <% de pg_trgm).
+// Ordena por relevancia: ts_rank mas la similitud del nombre.
+func (repo *PostgresRepository) SearchProducts(ctx context.Context, query string, page uint64) ([]*models.ProductSearchResult, error) {
+	headline := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, highlightStart, highlightStop)
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT
+			p.id,
+			p.name,
+			p.price,
+			p.stock,
+			p.user_id,
+			COALESCE(p.description, ''),
+			p.created_at,
+			ts_rank(p.search_vector, q.query) + word_similarity($1, p.name) AS rank,
+			ts_headline('`+SEARCH_CONFIG+`', p.name, q.query, $4::text || ', HighlightAll=TRUE'),
+			ts_headline('`+SEARCH_CONFIG+`', COALESCE(p.description, ''), q.query, $4::text || ', MaxWords=30, MinWords=10')
+		 FROM products p, plainto_tsquery('`+SEARCH_CONFIG+`', $1) AS q(query)
+		 WHERE p.search_vector @@ q.query OR $1 <% p.name
+		 ORDER BY rank DESC, p.id
+		 LIMIT $2 OFFSET $3`,
+		query, PAGINATION_SIZE, page*PAGINATION_SIZE, headline,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var results []*models.ProductSearchResult
+	for rows.Next() {
+		var result = models.ProductSearchResult{}
+		if err = rows.Scan(
+			&result.Id,
+			&result.Name,
+			&result.Price,
+			&result.Stock,
+			&result.User_id,
+			&result.Description,
+			&result.CreatedAt,
+			&result.Rank,
+			&result.Highlight.Name,
+			&result.Highlight.Description); err != nil {
+			return nil, err
+		}
+		result.Highlight.Name = markHighlight(result.Highlight.Name)
+		result.Highlight.Description = markHighlight(result.Highlight.Description)
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	products := make([]*models.ProductList, 0, len(results))
+	for _, result := range results {
+		products = append(products, &result.ProductList)
+	}
+	return results, repo.attachImages(ctx, products...)
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+)
+
+func (repo *PostgresRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		token.UserId,
+		token.FamilyId,
+		token.TokenHash,
+		token.ExpiresAt).Scan(&token.Id, &token.CreatedAt)
+}
+
+func (repo *PostgresRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token = models.RefreshToken{}
+	var revokedAt sql.NullTime
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT id, user_id, family_id, token_hash, expires_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1",
+		tokenHash).Scan(&token.Id, &token.UserId, &token.FamilyId, &token.TokenHash, &token.ExpiresAt, &revokedAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &models.RefreshToken{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// RevokeRefreshToken marca el token como usado; si ya lo estaba (dos refresh con el mismo token)
+// devuelve repository.ErrRefreshTokenRevoked.
+func (repo *PostgresRepository) RevokeRefreshToken(ctx context.Context, id string) error {
+	result, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrRefreshTokenRevoked
+	}
+	return nil
+}
+
+func (repo *PostgresRepository) RevokeRefreshFamily(ctx context.Context, familyId string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyId)
+	return err
+}
+
+func (repo *PostgresRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	// se aprovecha para limpiar los que ya expiraron, no hace falta seguir guardandolos
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.ExecContext(
+		ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING",
+		jti,
+		expiresAt)
+	return err
+}
+
+func (repo *PostgresRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := repo.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (repo *PostgresRepository) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userId)
+	return err
+}
+
+func (repo *PostgresRepository) InsertUserToken(ctx context.Context, token *models.UserToken) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		token.UserId,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt).Scan(&token.Id, &token.CreatedAt)
+}
+
+// UseUserToken marca el token como usado en la misma sentencia que lo valida,
+// asi dos requests con el mismo token no pueden usarlo ambos.
+func (repo *PostgresRepository) UseUserToken(ctx context.Context, tokenHash string, purpose string) (*models.UserToken, error) {
+	var token = models.UserToken{}
+	var usedAt time.Time
+	err := repo.db.QueryRowContext(
+		ctx,
+		`UPDATE user_tokens
+		    SET used_at = NOW()
+		  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at`,
+		tokenHash,
+		purpose).Scan(&token.Id, &token.UserId, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &usedAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &models.UserToken{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.UsedAt = &usedAt
+	return &token, nil
+}
+
+func (repo *PostgresRepository) UpdatePassword(ctx context.Context, userId string, password string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", password, userId)
+	return err
+}
+
+func (repo *PostgresRepository) SetEmailVerified(ctx context.Context, userId string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL", userId)
+	return err
+}
+
+func (repo *PostgresRepository) SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE users SET last_seen_at = $2 WHERE id = $1", userId, lastSeen)
+	return err
+}
+
+func (repo *PostgresRepository) GetLastSeen(ctx context.Context, userId string) (*time.Time, error) {
+	var lastSeen *time.Time
+	err := repo.db.QueryRowContext(ctx, "SELECT last_seen_at FROM users WHERE id = $1", userId).Scan(&lastSeen)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lastSeen, err
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/lib/pq"
+)
+
+func (repo *PostgresRepository) InsertProductOption(ctx context.Context, option *models.ProductOption) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		`INSERT INTO product_options (id, product_id, name, "values", position) VALUES ($1, $2, $3, $4, $5)`,
+		option.Id,
+		option.ProductId,
+		option.Name,
+		pq.Array(option.Values),
+		option.Position)
+	return err
+}
+
+func (repo *PostgresRepository) ListProductOptions(ctx context.Context, productId string) ([]*models.ProductOption, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT id, product_id, name, "values", position FROM product_options WHERE product_id = $1 ORDER BY position, name`,
+		productId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var options []*models.ProductOption
+	for rows.Next() {
+		var option = models.ProductOption{}
+		if err = rows.Scan(&option.Id, &option.ProductId, &option.Name, pq.Array(&option.Values), &option.Position); err != nil {
+			return nil, err
+		}
+		options = append(options, &option)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (repo *PostgresRepository) InsertVariant(ctx context.Context, variant *models.Variant) error {
+	options, err := json.Marshal(variant.Options)
+	if err != nil {
+		return err
+	}
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO product_variants (id, product_id, sku, price, stock, options) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at",
+		variant.Id,
+		variant.ProductId,
+		variant.Sku,
+		variant.Price,
+		variant.Stock,
+		options).Scan(&variant.CreatedAt)
+}
+
+func (repo *PostgresRepository) GetVariantById(ctx context.Context, id string) (*models.Variant, error) {
+	variants, err := repo.queryVariants(ctx, "v.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return &models.Variant{}, nil
+	}
+	return variants[0], nil
+}
+
+// GetVariantBySku devuelve una variante vacia si ningun producto usa el SKU.
+func (repo *PostgresRepository) GetVariantBySku(ctx context.Context, sku string) (*models.Variant, error) {
+	variants, err := repo.queryVariants(ctx, "v.sku = $1", sku)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return &models.Variant{}, nil
+	}
+	return variants[0], nil
+}
+
+func (repo *PostgresRepository) ListVariants(ctx context.Context, productId string) ([]*models.Variant, error) {
+	return repo.queryVariants(ctx, "v.product_id = $1", productId)
+}
+
+// queryVariants trae las variantes con las urls de sus imagenes, en el orden en que se crearon.
+func (repo *PostgresRepository) queryVariants(ctx context.Context, where string, args ...interface{}) ([]*models.Variant, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT
+			v.id,
+			v.product_id,
+			v.sku,
+			v.price,
+			v.stock,
+			v.options,
+			v.created_at,
+			COALESCE(ARRAY(
+				SELECT i.url FROM variant_images vi
+				JOIN images i ON i.id = vi.image_id
+				WHERE vi.variant_id = v.id
+				ORDER BY vi.created_at
+			), '{}')
+		 FROM product_variants v
+		 WHERE `+where+`
+		 ORDER BY v.created_at, v.id`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var variants []*models.Variant
+	for rows.Next() {
+		var variant = models.Variant{}
+		var price sql.NullFloat64
+		var options []byte
+		if err = rows.Scan(
+			&variant.Id,
+			&variant.ProductId,
+			&variant.Sku,
+			&price,
+			&variant.Stock,
+			&options,
+			&variant.CreatedAt,
+			pq.Array(&variant.Images)); err != nil {
+			return nil, err
+		}
+		if price.Valid {
+			variant.Price = &price.Float64
+		}
+		if err = json.Unmarshal(options, &variant.Options); err != nil {
+			return nil, err
+		}
+		variants = append(variants, &variant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (repo *PostgresRepository) UpdateVariant(ctx context.Context, variant *models.Variant) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE product_variants SET sku = $1, price = $2, stock = $3 WHERE id = $4",
+		variant.Sku,
+		variant.Price,
+		variant.Stock,
+		variant.Id)
+	return err
+}
+
+func (repo *PostgresRepository) DeleteVariant(ctx context.Context, id string) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM product_variants WHERE id = $1", id)
+	return err
+}
+
+func (repo *PostgresRepository) LinkVariantToImage(ctx context.Context, variantId string, imageId string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"INSERT INTO variant_images (variant_id, image_id) VALUES ($1, $2)",
+		variantId,
+		imageId)
+	return err
+}
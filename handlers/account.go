@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kevintovar01/Store/mailer"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PASSWORD_RESET_TTL     = time.Hour
+	EMAIL_VERIFICATION_TTL = 48 * time.Hour
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// sendUserToken crea un token de un solo uso para el usuario y le envia el enlace por correo.
+func sendUserToken(ctx context.Context, s server.Server, user *models.User, purpose string) error {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := EMAIL_VERIFICATION_TTL
+	path, subject, text := "/verify-email", "Verify your email", "Confirm your email address by opening this link:"
+	if purpose == models.TokenPasswordReset {
+		ttl = PASSWORD_RESET_TTL
+		path, subject, text = "/reset-password", "Reset your password", "You asked to reset your password. Open this link to choose a new one:"
+	}
+
+	err = repository.InsertUserToken(ctx, &models.UserToken{
+		UserId:    user.Id,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	appUrl := s.Config().AppUrl
+	if appUrl == "" {
+		appUrl = "http://localhost:5173"
+	}
+	link := appUrl + path + "?token=" + url.QueryEscape(token)
+
+	return s.Mailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("%s\n\n%s\n\nThe link expires in %s.\n", text, link, ttl),
+	})
+}
+
+// sendVerificationEmail no corta el registro si el correo falla, el usuario puede pedir otro enlace.
+func sendVerificationEmail(ctx context.Context, s server.Server, user *models.User) {
+	if err := sendUserToken(ctx, s, user, models.TokenEmailVerification); err != nil {
+		log.Println("error sending verification email:", err)
+	}
+}
+
+// ForgotPasswordHandler siempre responde lo mismo, exista o no el email, para no revelar que usuarios existen.
+func ForgotPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ForgotPasswordRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := repository.GetUserByEmail(r.Context(), request.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if user.Id != "" {
+			if err := sendUserToken(r.Context(), s, user, models.TokenPasswordReset); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&MessageResponse{
+			Message: "if the email exists, a reset link was sent",
+		})
+	}
+}
+
+// ResetPasswordHandler cambia la contraseña con el token del correo y cierra todas las sesiones del usuario.
+func ResetPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ResetPasswordRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.Password == "" {
+			http.Error(w, "password is required", http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), HASH_COST)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var token *models.UserToken
+		err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			token, err = tx.UseUserToken(r.Context(), hashToken(request.Token), models.TokenPasswordReset)
+			if err != nil || token.Id == "" {
+				return err
+			}
+			if err := tx.UpdatePassword(r.Context(), token.UserId, string(hashedPassword)); err != nil {
+				return err
+			}
+			return tx.RevokeUserRefreshTokens(r.Context(), token.UserId)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if token.Id == "" {
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&MessageResponse{
+			Message: "password updated",
+		})
+	}
+}
+
+func VerifyEmailHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.URL.Query().Get("token")
+
+		var token *models.UserToken
+		err := repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			var err error
+			token, err = tx.UseUserToken(r.Context(), hashToken(tokenString), models.TokenEmailVerification)
+			if err != nil || token.Id == "" {
+				return err
+			}
+			return tx.SetEmailVerified(r.Context(), token.UserId)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if token.Id == "" {
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&MessageResponse{
+			Message: "email verified",
+		})
+	}
+}
+
+// ResendVerificationHandler envia un enlace nuevo al usuario autenticado si aun no verifico su email.
+func ResendVerificationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			user, err := repository.GetUserById(r.Context(), claims.UserId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if user.EmailVerifiedAt != nil {
+				http.Error(w, "email already verified", http.StatusConflict)
+				return
+			}
+
+			if err := sendUserToken(r.Context(), s, user, models.TokenEmailVerification); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&MessageResponse{
+				Message: "verification email sent",
+			})
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
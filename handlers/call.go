@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/kevintovar01/Store/websocket"
+	"github.com/segmentio/ksuid"
+)
+
+// cuanto suena una llamada si Config.CallRingTimeout no dice otra cosa
+const CALL_RING_TIMEOUT = 30 * time.Second
+
+/*
+CallRinger da por perdidas las llamadas que nadie contesta y cuelga las de las conexiones que se cierran.
+La hora limite queda en la llamada (ring_deadline) y no en esta instancia: al arrancar se retoman
+los timeouts de las que siguen sonando, y cualquier instancia termina una llamada vencida cuando
+alguien intenta contestarla, rechazarla o colgarla. Cada servidor tiene el suyo, lo crea BindRoutes.
+*/
+type CallRinger struct {
+	s       server.Server
+	timeout time.Duration
+	mutex   sync.Mutex
+	timers  map[string]*time.Timer     // call_id -> timeout de las llamadas que suenan aqui
+	clients map[string]map[string]bool // client_id -> call_ids de las conexiones de esta instancia
+}
+
+// NewCallRinger crea el CallRinger del servidor y programa el timeout de las llamadas que ya estaban sonando.
+func NewCallRinger(s server.Server) *CallRinger {
+	timeout := s.Config().CallRingTimeout
+	if timeout == 0 {
+		timeout = CALL_RING_TIMEOUT
+	}
+	ringer := &CallRinger{
+		s:       s,
+		timeout: timeout,
+		timers:  make(map[string]*time.Timer),
+		clients: make(map[string]map[string]bool),
+	}
+
+	calls, err := repository.ListRingingCalls(context.Background())
+	if err != nil {
+		log.Println("Error loading ringing calls:", err)
+	}
+	for _, call := range calls {
+		ringer.ring(call)
+	}
+	return ringer
+}
+
+// ring programa el timeout de la llamada para su ring_deadline.
+func (ringer *CallRinger) ring(call *models.Call) {
+	wait := ringer.timeout
+	if call.RingDeadline != nil {
+		wait = time.Until(*call.RingDeadline)
+	}
+
+	ringer.mutex.Lock()
+	defer ringer.mutex.Unlock()
+	ringer.timers[call.Id] = time.AfterFunc(wait, func() { ringer.expire(call.Id) })
+}
+
+// stop detiene el timeout de una llamada que ya se contesto o termino.
+func (ringer *CallRinger) stop(callId string) {
+	ringer.mutex.Lock()
+	defer ringer.mutex.Unlock()
+	if timer, ok := ringer.timers[callId]; ok {
+		timer.Stop()
+		delete(ringer.timers, callId)
+	}
+}
+
+// track anota que la conexion participa en la llamada, para colgarla si se cierra.
+func (ringer *CallRinger) track(clientId string, callId string) {
+	ringer.mutex.Lock()
+	defer ringer.mutex.Unlock()
+	if ringer.clients[clientId] == nil {
+		ringer.clients[clientId] = make(map[string]bool)
+	}
+	ringer.clients[clientId][callId] = true
+}
+
+// untrack olvida una llamada que termino.
+func (ringer *CallRinger) untrack(call *models.Call) {
+	ringer.mutex.Lock()
+	defer ringer.mutex.Unlock()
+	for _, clientId := range []string{call.CallerClient, call.CalleeClient} {
+		delete(ringer.clients[clientId], call.Id)
+		if len(ringer.clients[clientId]) == 0 {
+			delete(ringer.clients, clientId)
+		}
+	}
+}
+
+// clientCalls saca y devuelve las llamadas de una conexion que se cerro.
+func (ringer *CallRinger) clientCalls(clientId string) []string {
+	ringer.mutex.Lock()
+	defer ringer.mutex.Unlock()
+	var callIds []string
+	for callId := range ringer.clients[clientId] {
+		callIds = append(callIds, callId)
+	}
+	delete(ringer.clients, clientId)
+	return callIds
+}
+
+// expire da por perdida la llamada si todavia sonaba; si otra instancia ya la cambio no hace nada.
+func (ringer *CallRinger) expire(callId string) {
+	err := ringer.finish(callId, models.CallRinging, models.CallMissed, models.MessageCallTimeout)
+	if err != nil && !errors.Is(err, repository.ErrCallStatusConflict) {
+		log.Println("Error timing out call:", err)
+	}
+}
+
+// finish pasa la llamada de from a un estado final y se lo avisa a los dos lados.
+func (ringer *CallRinger) finish(callId string, from string, to string, messageType string) error {
+	call, err := repository.GetCallById(context.Background(), callId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	call.Status = to
+	call.EndedAt = &now
+	if err = repository.UpdateCall(context.Background(), call, from); err != nil {
+		return err
+	}
+	ringer.stop(call.Id)
+	ringer.untrack(call)
+
+	ringer.s.Hub().Signal(callTopics(call), models.WebsocketMessage{Type: messageType, Payload: call})
+	return nil
+}
+
+// ListCallsHandler devuelve el registro de llamadas del usuario, la mas reciente primero.
+func ListCallsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		calls, err := repository.ListCalls(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calls)
+	}
+}
+
+// CallStartMessageHandler llama al otro participante de una conversacion: suenan todas sus conexiones
+// hasta que una contesta, alguien cuelga o pasa el timeout.
+func CallStartMessageHandler(s server.Server, ringer *CallRinger) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		conversation, _, ok := chatConversation(client, payload)
+		if !ok {
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			client.SendError(err.Error())
+			return
+		}
+		call := &models.Call{
+			Id:             id.String(),
+			ConversationId: conversation.Id,
+			CallerId:       client.UserId(),
+			CalleeId:       conversation.OtherParticipant(client.UserId()),
+			CallerClient:   client.Id(),
+			Status:         models.CallRinging,
+		}
+		deadline := time.Now().UTC().Add(ringer.timeout)
+		call.RingDeadline = &deadline
+		if err = repository.InsertCall(context.Background(), call); err != nil {
+			client.SendError(err.Error())
+			return
+		}
+
+		ringer.track(client.Id(), call.Id)
+		client.Send(models.WebsocketMessage{Type: models.MessageCallRinging, Payload: call})
+		s.Hub().Signal([]string{models.UserTopic(call.CalleeId)}, models.WebsocketMessage{
+			Type:    models.MessageCallRing,
+			Payload: call,
+		})
+		ringer.ring(call)
+	}
+}
+
+// CallAcceptMessageHandler contesta la llamada desde esta conexion, las demas del usuario dejan de sonar.
+func CallAcceptMessageHandler(s server.Server, ringer *CallRinger) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		call, ok := lookupCall(ringer, client, payload)
+		if !ok {
+			return
+		}
+		if call.CalleeId != client.UserId() {
+			client.SendError("only the callee can accept the call")
+			return
+		}
+
+		if call.Status != models.CallRinging {
+			client.SendError("the call is no longer ringing")
+			return
+		}
+
+		now := time.Now().UTC()
+		call.Status = models.CallActive
+		call.CalleeClient = client.Id()
+		call.AnsweredAt = &now
+		if err := repository.UpdateCall(context.Background(), call, models.CallRinging); err != nil {
+			client.SendError(callError(err))
+			return
+		}
+
+		// ya contestaron, el timeout sobra
+		ringer.stop(call.Id)
+		ringer.track(client.Id(), call.Id)
+
+		s.Hub().Signal(callTopics(call), models.WebsocketMessage{Type: models.MessageCallAccepted, Payload: call})
+	}
+}
+
+func CallRejectMessageHandler(s server.Server, ringer *CallRinger) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		call, ok := lookupCall(ringer, client, payload)
+		if !ok {
+			return
+		}
+		if call.CalleeId != client.UserId() {
+			client.SendError("only the callee can reject the call")
+			return
+		}
+
+		if err := ringer.finish(call.Id, models.CallRinging, models.CallRejected, models.MessageCallRejected); err != nil {
+			client.SendError(callError(err))
+		}
+	}
+}
+
+// CallHangupMessageHandler termina la llamada activa, o la cancela si todavia esta sonando.
+func CallHangupMessageHandler(s server.Server, ringer *CallRinger) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		call, ok := lookupCall(ringer, client, payload)
+		if !ok {
+			return
+		}
+		if call.Status != models.CallRinging && call.Status != models.CallActive {
+			client.SendError("the call already finished")
+			return
+		}
+
+		if err := ringer.finish(call.Id, call.Status, models.CallEnded, models.MessageCallEnded); err != nil {
+			client.SendError(callError(err))
+		}
+	}
+}
+
+// CallSignalMessageHandler reenvia ofertas, respuestas y candidatos ICE a la otra conexion de la llamada.
+func CallSignalMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		var signal = models.CallSignal{}
+		if err := json.Unmarshal(payload, &signal); err != nil || signal.CallId == "" {
+			client.SendError("call_signal needs a call_id")
+			return
+		}
+		switch signal.Kind {
+		case models.SignalOffer, models.SignalAnswer, models.SignalCandidate:
+		default:
+			client.SendError("unknown signal kind: " + signal.Kind)
+			return
+		}
+
+		call, err := repository.GetCallById(context.Background(), signal.CallId)
+		if err != nil {
+			client.SendError(err.Error())
+			return
+		}
+		// solo las dos conexiones de una llamada contestada se pueden hablar
+		peer := call.PeerClient(client.Id())
+		if call.Status != models.CallActive || peer == "" {
+			client.SendError("call not found")
+			return
+		}
+
+		signal.From = client.UserId()
+		s.Hub().Signal([]string{models.ClientTopic(peer)}, models.WebsocketMessage{
+			Type:    models.MessageCallSignal,
+			Payload: &signal,
+		})
+	}
+}
+
+// HangupOnDisconnect termina las llamadas de una conexion que se cerro.
+func HangupOnDisconnect(s server.Server, ringer *CallRinger) func(client *websocket.Client) {
+	return func(client *websocket.Client) {
+		for _, callId := range ringer.clientCalls(client.Id()) {
+			call, err := repository.GetCallById(context.Background(), callId)
+			if err != nil {
+				log.Println("Error ending call:", err)
+				continue
+			}
+			if call.Status != models.CallRinging && call.Status != models.CallActive {
+				continue
+			}
+			err = ringer.finish(call.Id, call.Status, models.CallEnded, models.MessageCallEnded)
+			if err != nil && !errors.Is(err, repository.ErrCallStatusConflict) {
+				log.Println("Error ending call:", err)
+			}
+		}
+	}
+}
+
+// lookupCall busca la llamada del payload, si no existe o el usuario no participa le responde el error.
+// Si seguia sonando despues de su hora limite (la instancia que la empezo no la termino) se da por perdida.
+func lookupCall(ringer *CallRinger, client *websocket.Client, payload json.RawMessage) (*models.Call, bool) {
+	var request = models.CallRequest{}
+	if err := json.Unmarshal(payload, &request); err != nil || request.CallId == "" {
+		client.SendError("call messages need a call_id")
+		return nil, false
+	}
+
+	call, err := repository.GetCallById(context.Background(), request.CallId)
+	if err != nil {
+		client.SendError(err.Error())
+		return nil, false
+	}
+	if !call.HasParticipant(client.UserId()) {
+		client.SendError("call not found")
+		return nil, false
+	}
+
+	if call.RingExpired(time.Now()) {
+		ringer.expire(call.Id)
+		if call, err = repository.GetCallById(context.Background(), call.Id); err != nil {
+			client.SendError(err.Error())
+			return nil, false
+		}
+	}
+	return call, true
+}
+
+// callTopics son la conexion que llamo y todas las del que recibe, asi las que no contestaron dejan de sonar.
+func callTopics(call *models.Call) []string {
+	return []string{models.ClientTopic(call.CallerClient), models.UserTopic(call.CalleeId)}
+}
+
+func callError(err error) string {
+	if errors.Is(err, repository.ErrCallStatusConflict) {
+		return "the call already changed"
+	}
+	return err.Error()
+}
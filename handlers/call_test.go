@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/database"
+	"github.com/kevintovar01/Store/mailer"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/kevintovar01/Store/websocket"
+)
+
+// testServer es un server.Server sin rutas, para probar los handlers que solo usan el hub y la configuracion.
+type testServer struct {
+	config *server.Config
+	hub    *websocket.Hub
+}
+
+func (s *testServer) Config() *server.Config { return s.config }
+func (s *testServer) Hub() *websocket.Hub    { return s.hub }
+func (s *testServer) Mailer() mailer.Mailer  { return nil }
+
+func newTestRepository(t *testing.T) repository.Repository {
+	t.Helper()
+
+	repo := database.NewMemoryRepository()
+	repository.SetRepository(repo)
+	return repo
+}
+
+// una instancia que arranca retoma las llamadas que dejo sonando otra, incluidas las ya vencidas
+func TestCallRingerResumesRingingCalls(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for _, call := range []struct {
+		id       string
+		status   string
+		deadline time.Time
+	}{
+		{"overdue", models.CallRinging, now.Add(-time.Minute)},
+		{"ringing", models.CallRinging, now.Add(100 * time.Millisecond)},
+		{"active", models.CallActive, now.Add(-time.Minute)},
+	} {
+		deadline := call.deadline
+		err := repo.InsertCall(ctx, &models.Call{Id: call.id, CallerClient: "caller", Status: call.status, RingDeadline: &deadline})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	NewCallRinger(&testServer{config: &server.Config{}, hub: websocket.NewHub()})
+
+	status := func(id string) string {
+		call, err := repo.GetCallById(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return call.Status
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for status("overdue") != models.CallMissed || status("ringing") != models.CallMissed {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls were not timed out: overdue %s, ringing %s", status("overdue"), status("ringing"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status("active") != models.CallActive {
+		t.Fatalf("an active call should not time out, got %s", status("active"))
+	}
+}
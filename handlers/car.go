@@ -23,7 +23,8 @@ type CarResponse struct {
 }
 
 type QuantityRequest struct {
-	Quantity int `json:"quantity"`
+	Quantity  int    `json:"quantity"`
+	VariantId string `json:"variant_id"` // obligatorio si el producto tiene variantes
 }
 
 func GetInstanceCar(userId string, total float64, r *http.Request) (*models.Car, error) {
@@ -53,13 +54,7 @@ func GetInstanceCar(userId string, total float64, r *http.Request) (*models.Car,
 func AddItemHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claim, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claim, ok := middleware.ClaimsFromContext(r.Context()); ok {
 
 			var QuantityRequest *QuantityRequest
 			if err := json.NewDecoder(r.Body).Decode(&QuantityRequest); err != nil {
@@ -69,10 +64,33 @@ func AddItemHandler(s server.Server) http.HandlerFunc {
 
 			log.Println("el id del producto es: ", claim.UserId)
 
-			builder := NewCarBuilder(claim.UserId, r)
-			builder.LoadOrCreate()
-			builder.AddProduct(params["id"], QuantityRequest.Quantity)
-			builder.Build()
+			// un producto con variantes se agrega al carrito por variante
+			variants, err := repository.ListVariants(r.Context(), params["id"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if QuantityRequest.VariantId == "" && len(variants) > 0 {
+				http.Error(w, "product has variants, variant_id is required", http.StatusBadRequest)
+				return
+			}
+			if QuantityRequest.VariantId != "" && !hasVariant(variants, QuantityRequest.VariantId) {
+				http.Error(w, "variant not found", http.StatusNotFound)
+				return
+			}
+
+			// todos los pasos del builder se guardan en una sola transaccion
+			err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+				builder := NewCarBuilder(tx, claim.UserId, r)
+				if err := builder.LoadOrCreate(); err != nil {
+					return err
+				}
+				return builder.AddProduct(params["id"], QuantityRequest.VariantId, QuantityRequest.Quantity)
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(&MessageResponse{
@@ -89,29 +107,18 @@ func AddItemHandler(s server.Server) http.HandlerFunc {
 
 func ListItemHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		// pageStr := r.URL.Query().Get("page")
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		request, ok := pageRequestFromRequest(w, r, "")
+		if !ok {
 			return
 		}
 
-		//var page = uint64(0)
-		// if pageStr != "" {
-		// 	page, err = strconv.ParseUint(pageStr, 10, 64)
-		// 	if err != nil {
-		// 		http.Error(w, err.Error(), http.StatusBadRequest)
-		// 		return
-		// 	}
-		// }
-
-		if claim, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			carItem, err := repository.ListItems(r.Context(), claim.UserId)
+		if claim, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			carItem, err := repository.ListItems(r.Context(), claim.UserId, request)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			writePageLinks(w, r, carItem.Next, carItem.Prev)
 			// w.header nos permite enviar una cabecera en la respuesta
 			//content-type es el tipo de contenido que se esta enviando
 			//application/json es el tipo de contenido que se esta enviando
@@ -13,21 +13,23 @@ type carBuilder struct {
 	car    *models.Car
 	userId string
 	r      *http.Request
+	repo   repository.Repository // repositorio (normalmente transaccional) donde se guardan los cambios
 }
 
 // NewCarBuilder crea un nuevo builder para un carrito
-func NewCarBuilder(userId string, r *http.Request) *carBuilder {
+func NewCarBuilder(repo repository.Repository, userId string, r *http.Request) *carBuilder {
 	return &carBuilder{
 		userId: userId,
 		car:    &models.Car{},
 		r:      r,
+		repo:   repo,
 	}
 }
 
 func (cb *carBuilder) LoadOrCreate() error {
 
 	var err error
-	cb.car, err = repository.GetWishCarById(cb.r.Context(), cb.userId)
+	cb.car, err = cb.repo.GetWishCarById(cb.r.Context(), cb.userId)
 	if err != nil {
 		return err
 	}
@@ -38,7 +40,7 @@ func (cb *carBuilder) LoadOrCreate() error {
 			return err
 		}
 		cb.car = models.NewCar(id.String(), cb.userId, 0)
-		err = repository.CreateWishCar(cb.r.Context(), cb.car)
+		err = cb.repo.CreateWishCar(cb.r.Context(), cb.car)
 		if err != nil {
 			return err
 		}
@@ -50,9 +52,10 @@ func (cb *carBuilder) LoadOrCreate() error {
 	return nil
 }
 
-func (cb *carBuilder) AddProduct(product_id string, quantity int) error {
+// AddProduct agrega unidades del producto al carrito; variant_id va vacio si el producto no tiene variantes.
+func (cb *carBuilder) AddProduct(product_id string, variant_id string, quantity int) error {
 	var carItem = &models.CarItem{}
-	carItem, err := repository.GetItem(cb.r.Context(), product_id, cb.car.Id)
+	carItem, err := cb.repo.GetItem(cb.r.Context(), product_id, variant_id, cb.car.Id)
 	if err != nil {
 		return err
 	}
@@ -62,31 +65,39 @@ func (cb *carBuilder) AddProduct(product_id string, quantity int) error {
 		carItem := models.CarItem{
 			CarId:     cb.car.Id,
 			ProductId: product_id,
+			VariantId: variant_id,
 			Quantity:  quantity,
 		}
 		log.Println("el item es 2", carItem)
-		err = repository.AddItem(cb.r.Context(), &carItem)
+		err = cb.repo.AddItem(cb.r.Context(), &carItem)
 		if err != nil {
 			return err
 		}
 		log.Println("el item es 3", carItem)
 	} else {
-		err = repository.UpdateQuantity(cb.r.Context(), product_id, quantity)
+		err = cb.repo.UpdateQuantity(cb.r.Context(), carItem.Id, quantity)
 		if err != nil {
 			return err
 		}
 	}
-	priceItem, err := repository.GetProductById(cb.r.Context(), product_id)
+	priceItem, err := cb.repo.GetProductById(cb.r.Context(), product_id)
 	if err != nil {
 		return err
 	}
-	cb.car.Total += float64(quantity) * float64(priceItem.Price)
-	cb.UpdateTotal()
-	return nil
+	price := priceItem.Price
+	if variant_id != "" {
+		variant, err := cb.repo.GetVariantById(cb.r.Context(), variant_id)
+		if err != nil {
+			return err
+		}
+		price = variant.UnitPrice(price)
+	}
+	cb.car.Total += float64(quantity) * float64(price)
+	return cb.UpdateTotal()
 }
 
 func (cb *carBuilder) UpdateTotal() error {
-	err := repository.UpdateWishCar(cb.r.Context(), cb.car)
+	err := cb.repo.UpdateWishCar(cb.r.Context(), cb.car)
 	if err != nil {
 		return err
 	}
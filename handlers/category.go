@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/segmentio/ksuid"
+)
+
+// slugs en minusculas separados por guiones, por ejemplo "ropa-de-hombre"
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type UpsertCategoryRequest struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`      // si va vacio se arma con el nombre
+	ParentId string `json:"parent_id"` // vacio para una categoria raiz
+}
+
+type ProductCategoriesRequest struct {
+	Categories []string `json:"categories"` // slugs
+}
+
+// slugify arma el slug a partir del nombre: minusculas y guiones en lugar de lo demas.
+func slugify(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+// categoryFromRequest valida el body de alta o edicion de una categoria.
+// current es la categoria que se edita, nil en un alta. Responde el error y devuelve false si no es valido.
+func categoryFromRequest(w http.ResponseWriter, r *http.Request, current *models.Category) (*models.Category, bool) {
+	var request = UpsertCategoryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		http.Error(w, "category needs a name", http.StatusBadRequest)
+		return nil, false
+	}
+	if request.Slug == "" {
+		request.Slug = slugify(request.Name)
+	}
+	if !slugPattern.MatchString(request.Slug) {
+		http.Error(w, "slug must be lowercase letters, numbers and dashes", http.StatusBadRequest)
+		return nil, false
+	}
+
+	category := &models.Category{
+		Name:     request.Name,
+		Slug:     request.Slug,
+		ParentId: request.ParentId,
+	}
+	if current != nil {
+		category.Id = current.Id
+		category.CreatedAt = current.CreatedAt
+	}
+
+	existing, err := repository.GetCategoryBySlug(r.Context(), category.Slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if existing.Id != "" && existing.Id != category.Id {
+		http.Error(w, "slug already in use", http.StatusConflict)
+		return nil, false
+	}
+
+	if category.ParentId != "" {
+		categories, err := repository.ListCategories(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		parents := make(map[string]string, len(categories))
+		for _, c := range categories {
+			parents[c.Id] = c.ParentId
+		}
+		if _, ok := parents[category.ParentId]; !ok {
+			http.Error(w, "parent category not found", http.StatusBadRequest)
+			return nil, false
+		}
+		// subiendo desde el nuevo padre no se puede llegar a la misma categoria
+		for id := category.ParentId; id != ""; id = parents[id] {
+			if id == category.Id {
+				http.Error(w, "a category cannot be inside itself", http.StatusBadRequest)
+				return nil, false
+			}
+		}
+	}
+
+	return category, true
+}
+
+// lookupCategory busca la categoria del slug de la url, responde 404 si no existe.
+func lookupCategory(w http.ResponseWriter, r *http.Request) (*models.Category, bool) {
+	category, err := repository.GetCategoryBySlug(r.Context(), mux.Vars(r)["slug"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if category.Id == "" {
+		http.Error(w, "category not found", http.StatusNotFound)
+		return nil, false
+	}
+	return category, true
+}
+
+// ListCategoriesHandler devuelve todas las categorias; el arbol se arma con parent_id.
+func ListCategoriesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categories, err := repository.ListCategories(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if categories == nil {
+			categories = []*models.Category{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(categories)
+	}
+}
+
+func GetCategoryHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category, ok := lookupCategory(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(category)
+	}
+}
+
+func InsertCategoryHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category, ok := categoryFromRequest(w, r, nil)
+		if !ok {
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		category.Id = id.String()
+
+		if err = repository.InsertCategory(r.Context(), category); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(category)
+	}
+}
+
+func UpdateCategoryHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, ok := lookupCategory(w, r)
+		if !ok {
+			return
+		}
+		category, ok := categoryFromRequest(w, r, current)
+		if !ok {
+			return
+		}
+
+		if err := repository.UpdateCategory(r.Context(), category); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(category)
+	}
+}
+
+// DeleteCategoryHandler borra una categoria sin subcategorias; sus productos solo pierden el enlace.
+func DeleteCategoryHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category, ok := lookupCategory(w, r)
+		if !ok {
+			return
+		}
+
+		categories, err := repository.ListCategories(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, child := range categories {
+			if child.ParentId == category.Id {
+				http.Error(w, "category has subcategories", http.StatusConflict)
+				return
+			}
+		}
+
+		if err = repository.DeleteCategory(r.Context(), category.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&ProductUpdateResponse{
+			Message: "Category deleted",
+		})
+	}
+}
+
+// ListCategoryProductsHandler devuelve los productos de la categoria y de todas sus subcategorias, por paginas.
+func ListCategoryProductsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		pageStr := r.URL.Query().Get("page")
+		var page = uint64(0)
+		if pageStr != "" {
+			page, err = strconv.ParseUint(pageStr, 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		category, ok := lookupCategory(w, r)
+		if !ok {
+			return
+		}
+
+		products, err := repository.ListCategoryProducts(r.Context(), category.Id, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if products == nil {
+			products = []*models.ProductList{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(products)
+	}
+}
+
+// SetProductCategoriesHandler reemplaza las categorias de un producto del usuario.
+func SetProductCategoriesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ProductCategoriesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+
+		categories := []*models.Category{}
+		categoryIds := []string{}
+		for _, slug := range request.Categories {
+			category, err := repository.GetCategoryBySlug(r.Context(), slug)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if category.Id == "" {
+				http.Error(w, "category not found: "+slug, http.StatusBadRequest)
+				return
+			}
+			categories = append(categories, category)
+			categoryIds = append(categoryIds, category.Id)
+		}
+
+		if err := repository.SetProductCategories(r.Context(), product.Id, categoryIds); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(categories)
+	}
+}
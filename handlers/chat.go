@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/kevintovar01/Store/websocket"
+	"github.com/segmentio/ksuid"
+)
+
+// largo maximo de un mensaje de chat
+const maxChatMessageLength = 2000
+
+var errInvalidChatMessage = errors.New("the message must have between 1 and 2000 characters")
+
+type ConversationRequest struct {
+	ProductId string `json:"product_id"`
+}
+
+type ChatMessageRequest struct {
+	Body string `json:"body"`
+}
+
+// StartConversationHandler abre la conversacion del cliente con el dueño del producto,
+// si ya existia la devuelve.
+func StartConversationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		var request = ConversationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		product, err := repository.GetProductById(r.Context(), request.ProductId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if product.Id == "" {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		if product.User_id == claims.UserId {
+			http.Error(w, "you cannot open a conversation about your own product", http.StatusBadRequest)
+			return
+		}
+
+		conversation, err := repository.FindConversation(r.Context(), product.Id, claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if conversation.Id == "" {
+			id, err := ksuid.NewRandom()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			conversation = &models.Conversation{
+				Id:          id.String(),
+				ProductId:   product.Id,
+				ProductName: product.Name,
+				CustomerId:  claims.UserId,
+				MerchantId:  product.User_id,
+			}
+			if err = repository.InsertConversation(r.Context(), conversation); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status = http.StatusCreated
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+// ListConversationsHandler devuelve las conversaciones del usuario como cliente y como vendedor.
+func ListConversationsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		conversations, err := repository.ListConversations(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversations)
+	}
+}
+
+// ListChatMessagesHandler devuelve el historial por paginas, ?page=0 son los mensajes mas recientes.
+func ListChatMessagesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		var err error
+		pageStr := r.URL.Query().Get("page")
+		var page = uint64(0)
+		if pageStr != "" {
+			page, err = strconv.ParseUint(pageStr, 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		conversation, ok := lookupConversation(w, r, params["id"], claims.UserId)
+		if !ok {
+			return
+		}
+
+		messages, err := repository.ListChatMessages(r.Context(), conversation.Id, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+// SendChatMessageHandler envia un mensaje por http, llega en vivo igual que uno enviado por websocket.
+func SendChatMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		var request = ChatMessageRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		conversation, ok := lookupConversation(w, r, params["id"], claims.UserId)
+		if !ok {
+			return
+		}
+
+		message, err := sendChatMessage(r.Context(), s, conversation, claims.UserId, request.Body)
+		if errors.Is(err, errInvalidChatMessage) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+// ReadConversationHandler marca como leidos los mensajes recibidos en la conversacion.
+func ReadConversationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		conversation, ok := lookupConversation(w, r, params["id"], claims.UserId)
+		if !ok {
+			return
+		}
+
+		receipt, err := readConversation(r.Context(), s, conversation, claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receipt)
+	}
+}
+
+// ChatSendMessageHandler envia un mensaje de chat recibido por websocket.
+func ChatSendMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		conversation, request, ok := chatConversation(client, payload)
+		if !ok {
+			return
+		}
+
+		if _, err := sendChatMessage(context.Background(), s, conversation, client.UserId(), request.Body); err != nil {
+			client.SendError(err.Error())
+		}
+	}
+}
+
+// ChatTypingMessageHandler le avisa al otro participante que el usuario esta escribiendo.
+func ChatTypingMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		conversation, _, ok := chatConversation(client, payload)
+		if !ok {
+			return
+		}
+
+		s.Hub().Signal([]string{models.UserTopic(conversation.OtherParticipant(client.UserId()))}, models.WebsocketMessage{
+			Type: models.MessageChatTyping,
+			Payload: &models.ChatTyping{
+				ConversationId: conversation.Id,
+				UserId:         client.UserId(),
+			},
+		})
+	}
+}
+
+// ChatReadMessageHandler marca la conversacion como leida desde el websocket.
+func ChatReadMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		conversation, _, ok := chatConversation(client, payload)
+		if !ok {
+			return
+		}
+
+		if _, err := readConversation(context.Background(), s, conversation, client.UserId()); err != nil {
+			client.SendError(err.Error())
+		}
+	}
+}
+
+// lookupConversation responde 404 si la conversacion no existe o el usuario no participa en ella.
+func lookupConversation(w http.ResponseWriter, r *http.Request, id string, userId string) (*models.Conversation, bool) {
+	conversation, err := repository.GetConversationById(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !conversation.HasParticipant(userId) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+	return conversation, true
+}
+
+// chatConversation decodifica un mensaje de chat del websocket y busca su conversacion,
+// si no puede le responde el error al cliente.
+func chatConversation(client *websocket.Client, payload json.RawMessage) (*models.Conversation, *models.ChatRequest, bool) {
+	var request = models.ChatRequest{}
+	if err := json.Unmarshal(payload, &request); err != nil || request.ConversationId == "" {
+		client.SendError("chat messages need a conversation_id")
+		return nil, nil, false
+	}
+
+	conversation, err := repository.GetConversationById(context.Background(), request.ConversationId)
+	if err != nil {
+		client.SendError(err.Error())
+		return nil, nil, false
+	}
+	if !conversation.HasParticipant(client.UserId()) {
+		client.SendError("conversation not found")
+		return nil, nil, false
+	}
+	return conversation, &request, true
+}
+
+// sendChatMessage guarda el mensaje y lo publica a los dos participantes (a todas sus conexiones).
+func sendChatMessage(ctx context.Context, s server.Server, conversation *models.Conversation, senderId string, body string) (*models.ChatMessage, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len([]rune(body)) > maxChatMessageLength {
+		return nil, errInvalidChatMessage
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	message := &models.ChatMessage{
+		Id:             id.String(),
+		ConversationId: conversation.Id,
+		SenderId:       senderId,
+		Body:           body,
+	}
+	if err = repository.InsertChatMessage(ctx, message); err != nil {
+		return nil, err
+	}
+
+	s.Hub().PublishAll([]string{models.UserTopic(conversation.CustomerId), models.UserTopic(conversation.MerchantId)}, models.WebsocketMessage{
+		Type:    models.MessageChatMessage,
+		Payload: message,
+	})
+	return message, nil
+}
+
+// readConversation marca los mensajes recibidos como leidos y, si habia alguno, avisa a los participantes.
+func readConversation(ctx context.Context, s server.Server, conversation *models.Conversation, readerId string) (*models.ChatReceipt, error) {
+	receipt := &models.ChatReceipt{
+		ConversationId: conversation.Id,
+		ReaderId:       readerId,
+		ReadAt:         time.Now().UTC(),
+	}
+
+	marked, err := repository.MarkChatRead(ctx, conversation.Id, readerId, receipt.ReadAt)
+	if err != nil {
+		return nil, err
+	}
+	if marked > 0 {
+		s.Hub().PublishAll([]string{models.UserTopic(conversation.CustomerId), models.UserTopic(conversation.MerchantId)}, models.WebsocketMessage{
+			Type:    models.MessageChatRead,
+			Payload: receipt,
+		})
+	}
+	return receipt, nil
+}
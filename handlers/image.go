@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+)
+
+// ListProductImagesHandler devuelve las imagenes del producto en orden.
+func ListProductImagesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, err := repository.GetProductById(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if product.Id == "" {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(product.Images)
+	}
+}
+
+// ReorderProductImagesHandler recibe {"image_ids": [...]} con todas las imagenes del producto en el orden nuevo.
+func ReorderProductImagesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+		var request = models.ReorderImagesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		linked := make(map[string]bool, len(product.Images))
+		for _, image := range product.Images {
+			linked[image.Id] = true
+		}
+		if len(request.ImageIds) != len(linked) {
+			http.Error(w, "image_ids must list every image of the product once", http.StatusBadRequest)
+			return
+		}
+		for _, imageId := range request.ImageIds {
+			if !linked[imageId] {
+				http.Error(w, "image_ids must list every image of the product once", http.StatusBadRequest)
+				return
+			}
+			delete(linked, imageId)
+		}
+
+		if err := repository.ReorderProductImages(r.Context(), product.Id, request.ImageIds); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeProductImages(w, r, product.Id)
+	}
+}
+
+// SetPrimaryProductImageHandler marca la imagen como la primaria del producto.
+func SetPrimaryProductImageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+		image, ok := productImage(w, r, product)
+		if !ok {
+			return
+		}
+
+		if err := repository.SetPrimaryProductImage(r.Context(), product.Id, image.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeProductImages(w, r, product.Id)
+	}
+}
+
+// DeleteProductImageHandler quita la imagen del producto. Si ya nadie la usa se borra, y el archivo
+// tambien si ninguna otra imagen apunta a el.
+func DeleteProductImageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+		image, ok := productImage(w, r, product)
+		if !ok {
+			return
+		}
+
+		if err := repository.UnlinkProductImage(r.Context(), product.Id, image.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deleted, err := repository.DeleteUnusedImage(r.Context(), image.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if deleted {
+			count, err := repository.CountImagesByUrl(r.Context(), image.Url)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if count == 0 {
+				removeUpload(s.Config().UploadsDir, image.Url)
+			}
+		}
+		writeProductImages(w, r, product.Id)
+	}
+}
+
+// productImage busca la imagen de la url entre las del producto; responde 404 si no esta.
+func productImage(w http.ResponseWriter, r *http.Request, product *models.ProductList) (*models.ProductImage, bool) {
+	imageId := mux.Vars(r)["imageId"]
+	for _, image := range product.Images {
+		if image.Id == imageId {
+			return image, true
+		}
+	}
+	http.Error(w, "image not found", http.StatusNotFound)
+	return nil, false
+}
+
+func writeProductImages(w http.ResponseWriter, r *http.Request, productId string) {
+	images, err := repository.ListProductImages(r.Context(), productId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if images == nil {
+		images = []*models.ProductImage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+// removeUpload borra el archivo de una url /uploads/...; nunca sale de uploadsDir ni toca las imagenes por defecto.
+func removeUpload(uploadsDir string, url string) {
+	name, ok := strings.CutPrefix(url, "/uploads/")
+	if !ok || strings.HasPrefix(name, "default/") {
+		return
+	}
+	path := filepath.Join(uploadsDir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(uploadsDir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Println("remove upload:", err)
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/segmentio/ksuid"
+)
+
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type OutOfStockResponse struct {
+	Message string                 `json:"message"`
+	Items   []models.StockShortage `json:"items"`
+}
+
+// CheckoutHandler convierte el carrito del usuario en una orden y luego vacia el carrito.
+func CheckoutHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			if s.Config().RequireVerifiedEmail {
+				user, err := repository.GetUserById(r.Context(), claims.UserId)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if user.EmailVerifiedAt == nil {
+					http.Error(w, "email not verified", http.StatusForbidden)
+					return
+				}
+			}
+
+			car, err := repository.GetWishCarById(r.Context(), claims.UserId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			// sin limite, el checkout necesita todo el carrito
+			items, err := repository.ListItems(r.Context(), claims.UserId, models.PageRequest{})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			carItems := items.Items
+
+			if car.Id == "" || len(carItems) == 0 {
+				http.Error(w, "wishcar is empty", http.StatusBadRequest)
+				return
+			}
+
+			id, err := ksuid.NewRandom()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			order := models.Order{
+				Id:     id.String(),
+				UserId: claims.UserId,
+				Status: models.OrderPending,
+			}
+
+			// se toma una copia del nombre y precio actual de cada producto
+			for _, carItem := range carItems {
+				product, err := repository.GetProductById(r.Context(), carItem.ProductId)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if product.Id == "" {
+					http.Error(w, "product not available: "+carItem.ProductId, http.StatusConflict)
+					return
+				}
+
+				item := &models.OrderItem{
+					ProductId: product.Id,
+					Name:      product.Name,
+					UnitPrice: product.Price,
+					Quantity:  carItem.Quantity,
+				}
+				// el item de una variante lleva su SKU, su precio y su stock
+				if carItem.VariantId != "" {
+					variant, err := repository.GetVariantById(r.Context(), carItem.VariantId)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					if variant.Id == "" {
+						http.Error(w, "variant not available: "+carItem.VariantId, http.StatusConflict)
+						return
+					}
+					item.VariantId = variant.Id
+					item.Sku = variant.Sku
+					item.UnitPrice = variant.UnitPrice(product.Price)
+				}
+
+				order.Items = append(order.Items, item)
+				order.Total += float64(item.Quantity) * item.UnitPrice
+			}
+
+			// la reserva del stock, la orden y el vaciado del carrito van en la misma transaccion
+			err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+				if err := tx.CreateOrder(r.Context(), &order); err != nil {
+					return err
+				}
+				return tx.ClearWishCar(r.Context(), car.Id)
+			})
+			var stockErr *repository.OutOfStockError
+			if errors.As(err, &stockErr) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(&OutOfStockResponse{
+					Message: "some items are out of stock",
+					Items:   stockErr.Items,
+				})
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&order)
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ListOrdersHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			orders, err := repository.ListOrders(r.Context(), claims.UserId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(orders)
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetOrderHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			order, err := repository.GetOrderById(r.Context(), params["id"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			// solo el dueño puede ver su orden
+			if order.Id == "" || order.UserId != claims.UserId {
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(order)
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// UpdateOrderStatusHandler mueve la orden al siguiente estado, solo si la transicion es valida,
+// y avisa por websocket al cliente.
+func UpdateOrderStatusHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			var statusRequest = OrderStatusRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&statusRequest); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if !models.IsOrderStatus(statusRequest.Status) {
+				http.Error(w, "unknown order status: "+statusRequest.Status, http.StatusBadRequest)
+				return
+			}
+
+			order, err := repository.GetOrderById(r.Context(), params["id"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if order.Id == "" {
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
+			}
+
+			if !models.CanTransition(order.Status, statusRequest.Status) {
+				http.Error(w, "invalid transition from "+order.Status+" to "+statusRequest.Status, http.StatusConflict)
+				return
+			}
+
+			// la ruta pide order:update, los reembolsos ademas order:refund
+			if statusRequest.Status == models.OrderRefunded {
+				allowed, err := middleware.HasPermission(r.Context(), claims.UserId, models.PermissionOrderRefund)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if !allowed {
+					http.Error(w, "Forbidden: missing permission "+models.PermissionOrderRefund, http.StatusForbidden)
+					return
+				}
+			}
+
+			change := models.OrderStatusChange{
+				OrderId:    order.Id,
+				FromStatus: order.Status,
+				ToStatus:   statusRequest.Status,
+				ActorId:    claims.UserId,
+			}
+
+			err = repository.UpdateOrderStatus(r.Context(), &change)
+			if errors.Is(err, repository.ErrOrderStatusConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			// le llega al dueño de la orden y a quien este siguiendo la orden
+			s.Hub().PublishAll([]string{models.UserTopic(order.UserId), models.OrderTopic(order.Id)}, models.WebsocketMessage{
+				Type:    models.MessageOrderStatusChanged,
+				Payload: &change,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&change)
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetOrderHistoryHandler devuelve el historial de estados, visible para el dueño de la orden y quien tenga order:read.
+func GetOrderHistoryHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			order, err := repository.GetOrderById(r.Context(), params["id"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if order.Id == "" {
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
+			}
+
+			if order.UserId != claims.UserId {
+				allowed, err := middleware.HasPermission(r.Context(), claims.UserId, models.PermissionOrderRead)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if !allowed {
+					http.Error(w, "order not found", http.StatusNotFound)
+					return
+				}
+			}
+
+			history, err := repository.ListOrderStatusHistory(r.Context(), order.Id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(history)
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
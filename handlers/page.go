@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+// pageRequestFromRequest lee limit (por defecto models.DefaultPageLimit) y cursor de la url;
+// un cursor solo sirve para una lista con el mismo sort y con una Key del tipo de ese orden.
+// Responde 400 si alguno es invalido.
+func pageRequestFromRequest(w http.ResponseWriter, r *http.Request, sort string) (models.PageRequest, bool) {
+	request := models.PageRequest{Limit: models.DefaultPageLimit}
+	query := r.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > models.MaxPageLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", models.MaxPageLimit), http.StatusBadRequest)
+			return request, false
+		}
+		request.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := models.DecodeCursor(value)
+		if err != nil || cursor.Sort != sort || cursor.CheckKey() != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return request, false
+		}
+		request.Cursor = cursor
+	}
+	return request, true
+}
+
+// writePageLinks agrega los headers Link (RFC 5988) de la pagina siguiente y la anterior
+// con los mismos parametros de la url actual.
+func writePageLinks(w http.ResponseWriter, r *http.Request, next string, prev string) {
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
+		}
+		query := r.URL.Query()
+		query.Del("page")
+		query.Set("cursor", link.cursor)
+		w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), link.rel))
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func TestPageRequestFromRequest(t *testing.T) {
+	createdAt := "2026-10-18T12:00:00.123456789Z"
+	for _, test := range []struct {
+		name  string
+		sort  string
+		query string
+		ok    bool
+	}{
+		{"first page", "", "", true},
+		{"limit", "", "limit=10", true},
+		{"limit out of range", "", "limit=1000", false},
+		{"limit not a number", "", "limit=ten", false},
+		{"created_at cursor", "", "cursor=" + models.Cursor{Key: createdAt, Id: "a"}.Encode(), true},
+		{"newest cursor", models.ProductSortNewest, "cursor=" + models.Cursor{Sort: models.ProductSortNewest, Key: createdAt, Id: "a"}.Encode(), true},
+		{"price cursor", models.ProductSortPriceAsc, "cursor=" + models.Cursor{Sort: models.ProductSortPriceAsc, Key: "19.9", Id: "a"}.Encode(), true},
+		{"name cursor", models.ProductSortName, "cursor=" + models.Cursor{Sort: models.ProductSortName, Key: "'; DROP", Id: "a"}.Encode(), true},
+		{"cursor of another sort", models.ProductSortPriceAsc, "cursor=" + models.Cursor{Key: createdAt, Id: "a"}.Encode(), false},
+		{"forged date", models.ProductSortNewest, "cursor=" + models.Cursor{Sort: models.ProductSortNewest, Key: "ayer", Id: "a"}.Encode(), false},
+		{"forged price", models.ProductSortPriceDesc, "cursor=" + models.Cursor{Sort: models.ProductSortPriceDesc, Key: "barato", Id: "a"}.Encode(), false},
+		{"forged created_at", "", "cursor=" + models.Cursor{Key: "1", Id: "a"}.Encode(), false},
+		{"cursor without id", "", "cursor=" + models.Cursor{Key: createdAt}.Encode(), false},
+		{"not base64", "", "cursor=%25%25", false},
+		{"not json", "", "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("{")), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/products?"+test.query, nil)
+
+			_, ok := pageRequestFromRequest(w, r, test.sort)
+			if ok != test.ok {
+				t.Fatalf("expected ok=%t, got %t (%d %s)", test.ok, ok, w.Code, w.Body.String())
+			}
+			if !ok && w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+)
+
+type PermissionRequest struct {
+	Name string `json:"name"`
+}
+
+// lookupRole responde 404 si el rol no existe.
+func lookupRole(w http.ResponseWriter, r *http.Request, name string) (*models.Role, bool) {
+	role, err := repository.GetRole(r.Context(), name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if role.Id == 0 {
+		http.Error(w, "role not found: "+name, http.StatusNotFound)
+		return nil, false
+	}
+	return role, true
+}
+
+// ListUserRolesHandler devuelve los roles de otro usuario.
+func ListUserRolesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		roles, err := repository.GetUserRoles(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roles)
+	}
+}
+
+// GrantUserRoleHandler asigna un rol al usuario de la url y deja el cambio en grant_audit.
+func GrantUserRoleHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		var roleRequest = RoleRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := repository.GetUserById(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		role, ok := lookupRole(w, r, roleRequest.Name)
+		if !ok {
+			return
+		}
+
+		roles, err := repository.GetUserRoles(r.Context(), user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, name := range roles {
+			if name == role.Name {
+				http.Error(w, "the user already has the role "+role.Name, http.StatusConflict)
+				return
+			}
+		}
+
+		err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.SetRoleUser(r.Context(), user.Id, role.Id); err != nil {
+				return err
+			}
+			return tx.InsertGrantAudit(r.Context(), &models.GrantAudit{
+				ActorId: claims.UserId,
+				Action:  models.GrantRoleAdded,
+				UserId:  user.Id,
+				Role:    role.Name,
+			})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&MessageRoleResponse{
+			Message: "The user is now: " + role.Name,
+		})
+	}
+}
+
+// RevokeUserRoleHandler quita un rol al usuario de la url. Nadie se puede quitar sus propios roles
+// para que no quede la tienda sin quien administre los permisos.
+func RevokeUserRoleHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		if params["id"] == claims.UserId {
+			http.Error(w, "you cannot revoke your own roles", http.StatusConflict)
+			return
+		}
+
+		role, ok := lookupRole(w, r, params["role"])
+		if !ok {
+			return
+		}
+
+		err := repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.RemoveRoleUser(r.Context(), params["id"], role.Id); err != nil {
+				return err
+			}
+			return tx.InsertGrantAudit(r.Context(), &models.GrantAudit{
+				ActorId: claims.UserId,
+				Action:  models.GrantRoleRemoved,
+				UserId:  params["id"],
+				Role:    role.Name,
+			})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&MessageRoleResponse{
+			Message: "role revoked: " + role.Name,
+		})
+	}
+}
+
+func ListPermissionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permissions, err := repository.ListPermissions(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(permissions)
+	}
+}
+
+func ListRolePermissionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		role, ok := lookupRole(w, r, params["name"])
+		if !ok {
+			return
+		}
+
+		permissions, err := repository.GetRolePermissions(r.Context(), role.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(permissions)
+	}
+}
+
+// GrantRolePermissionHandler agrega un permiso a un rol, afecta a todos los usuarios con ese rol.
+func GrantRolePermissionHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		var permissionRequest = PermissionRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&permissionRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		changeRolePermission(w, r, claims.UserId, params["name"], permissionRequest.Name, true)
+	}
+}
+
+func RevokeRolePermissionHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		changeRolePermission(w, r, claims.UserId, params["name"], params["permission"], false)
+	}
+}
+
+func changeRolePermission(w http.ResponseWriter, r *http.Request, actorId string, roleName string, permissionName string, grant bool) {
+	role, ok := lookupRole(w, r, roleName)
+	if !ok {
+		return
+	}
+
+	permission, err := repository.GetPermission(r.Context(), permissionName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if permission.Id == 0 {
+		http.Error(w, "permission not found: "+permissionName, http.StatusNotFound)
+		return
+	}
+
+	action := models.GrantPermissionAdded
+	if !grant {
+		action = models.GrantPermissionRemoved
+	}
+
+	err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+		var err error
+		if grant {
+			err = tx.GrantPermission(r.Context(), role.Id, permission.Id)
+		} else {
+			err = tx.RevokePermission(r.Context(), role.Id, permission.Id)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.InsertGrantAudit(r.Context(), &models.GrantAudit{
+			ActorId:    actorId,
+			Action:     action,
+			Role:       role.Name,
+			Permission: permission.Name,
+		})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	permissions, err := repository.GetRolePermissions(r.Context(), role.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+// ListGrantAuditHandler devuelve el historial de cambios de roles y permisos, el mas reciente primero.
+func ListGrantAuditHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := repository.ListGrantAudit(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/kevintovar01/Store/websocket"
+)
+
+// GetPresenceHandler dice si el usuario esta online, away u offline y desde cuando.
+// Los cambios llegan en vivo a quien sigue el topic presence:{id}.
+func GetPresenceHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		user, err := repository.GetUserById(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		presence := s.Hub().Presence(user.Id)
+		// el hub solo recuerda a quien vio desde que arranco, lo demas esta en el repositorio
+		if presence.Status == models.PresenceOffline && presence.LastSeen == nil {
+			presence.LastSeen, err = repository.GetLastSeen(r.Context(), user.Id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presence)
+	}
+}
+
+// PresenceMessageHandler recibe {"status": "away"} cuando el usuario deja de usar la pestaña
+// y {"status": "online"} cuando vuelve.
+func PresenceMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		var request = models.PresenceRequest{}
+		if err := json.Unmarshal(payload, &request); err != nil {
+			client.SendError("invalid presence")
+			return
+		}
+
+		switch request.Status {
+		case models.PresenceOnline:
+			s.Hub().SetAway(client, false)
+		case models.PresenceAway:
+			s.Hub().SetAway(client, true)
+		default:
+			client.SendError("presence status must be online or away")
+		}
+	}
+}
@@ -23,7 +23,7 @@ type UpsertProductRequest struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
-	Stock       string  `json:"stock"`
+	Stock       int     `json:"stock"`
 }
 
 type ProductUpdateResponse struct {
@@ -34,7 +34,7 @@ type ProductResponse struct {
 	Id    string  `json:"id"`
 	Name  string  `json:"name"`
 	Price float64 `json:"price"`
-	Stock string  `json:"stock"`
+	Stock int     `json:"stock"`
 }
 
 type GetProductResponse struct {
@@ -42,27 +42,31 @@ type GetProductResponse struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Price       float64   `json:"price"`
-	Stock       string    `json:"stock"`
+	Stock       int       `json:"stock"`
 	User_id     string    `json:"user_id"`
 	CreatedAt   time.Time `json:"created_at"`
-	Url         string    `json:"url"`
+	Url         string    `json:"url"` // la imagen primaria
+
+	Images     []*models.ProductImage  `json:"images"` // ordenadas por position
+	Categories []*models.Category      `json:"categories"`
+	Options    []*models.ProductOption `json:"options"`
+	Variants   []*models.Variant       `json:"variants"` // una por combinacion de valores de Options
 }
 
 func InsertProductHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claim, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claim, ok := middleware.ClaimsFromContext(r.Context()); ok {
 			var productRequest = UpsertProductRequest{}
 			if err := json.NewDecoder(r.Body).Decode(&productRequest); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
+			if productRequest.Stock < 0 {
+				http.Error(w, "stock must be zero or greater", http.StatusBadRequest)
+				return
+			}
+
 			id, err := ksuid.NewRandom()
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -84,10 +88,10 @@ func InsertProductHandler(s server.Server) http.HandlerFunc {
 				return
 			}
 			var productMessage = models.WebsocketMessage{
-				Type:    "Product created",
+				Type:    models.MessageProductCreated,
 				Payload: &product,
 			}
-			s.Hub().Broadcast(productMessage, nil)
+			s.Hub().Publish(models.TopicProducts, productMessage)
 
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(&ProductResponse{
@@ -105,20 +109,25 @@ func InsertProductHandler(s server.Server) http.HandlerFunc {
 
 func UpdateProductHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
 		params := mux.Vars(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
 
-		if claim, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claim, ok := middleware.ClaimsFromContext(r.Context()); ok {
 			var productRequest = UpsertProductRequest{}
 			if err := json.NewDecoder(r.Body).Decode(&productRequest); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
+			if productRequest.Stock < 0 {
+				http.Error(w, "stock must be zero or greater", http.StatusBadRequest)
+				return
+			}
+
+			// el UPDATE filtra por user_id: sin este chequeo un producto ajeno responderia 200 sin cambiar nada
+			if _, ok := ownProduct(w, r); !ok {
+				return
+			}
+
 			product := models.Product{
 				Id:          params["id"],
 				Name:        productRequest.Name,
@@ -128,16 +137,26 @@ func UpdateProductHandler(s server.Server) http.HandlerFunc {
 				User_id:     claim.UserId,
 			}
 
-			err = repository.UpdateProduct(r.Context(), &product)
+			err := repository.UpdateProduct(r.Context(), &product)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// se publica lo que quedo guardado, no el body de la peticion
+			stored, err := repository.GetProductById(r.Context(), product.Id)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if stored.Id == "" {
+				http.Error(w, "product not found", http.StatusNotFound)
+				return
+			}
 			var productMessage = models.WebsocketMessage{
-				Type:    "Product created",
-				Payload: &product,
+				Type:    models.MessageProductUpdated,
+				Payload: stored,
 			}
-			s.Hub().Broadcast(productMessage, nil)
+			s.Hub().PublishAll([]string{models.TopicProducts, models.ProductTopic(product.Id)}, productMessage)
 
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(&ProductUpdateResponse{
@@ -159,6 +178,30 @@ func GetProductByIdHandler(s server.Server) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		categories, err := repository.ListProductCategories(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if categories == nil {
+			categories = []*models.Category{}
+		}
+		options, err := repository.ListProductOptions(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if options == nil {
+			options = []*models.ProductOption{}
+		}
+		variants, err := repository.ListVariants(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if variants == nil {
+			variants = []*models.Variant{}
+		}
 
 		w.Header().Set("Content-Type", "aplication/json")
 		json.NewEncoder(w).Encode(&GetProductResponse{
@@ -169,20 +212,19 @@ func GetProductByIdHandler(s server.Server) http.HandlerFunc {
 			Stock:       product.Stock,
 			User_id:     product.User_id,
 			CreatedAt:   product.CreatedAt,
-			Url:         product.Url})
+			Url:         product.Url,
+			Images:      product.Images,
+			Categories:  categories,
+			Options:     options,
+			Variants:    variants})
 	}
 }
 
 func DeleteProductHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
 		params := mux.Vars(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
 
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
 			err := repository.DeleteProduct(r.Context(), params["id"], claims.UserId)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -202,88 +244,115 @@ func DeleteProductHandler(s server.Server) http.HandlerFunc {
 
 func ListProductHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		pageStr := r.URL.Query().Get("page")
-		var page = uint64(0)
-		if pageStr != "" {
-			page, err = strconv.ParseUint(pageStr, 10, 64)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
+		filter, ok := productFilterFromRequest(w, r)
+		if !ok {
+			return
+		}
+		request, ok := pageRequestFromRequest(w, r, filter.Sort)
+		if !ok {
+			return
+		}
+
+		page, err := repository.ListProduct(r.Context(), filter, request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		product, err := repository.ListProduct(r.Context(), page)
+		facets, err := repository.ProductFacets(r.Context(), filter)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		writePageLinks(w, r, page.Next, page.Prev)
 		// w.header nos permite enviar una cabecera en la respuesta
 		//content-type es el tipo de contenido que se esta enviando
 		//application/json es el tipo de contenido que se esta enviando
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(product)
+		json.NewEncoder(w).Encode(models.ProductPage{Page: *page, Facets: *facets})
 	}
 }
 
-func InsertImageHandler(s server.Server) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+// productFilterFromRequest lee min_price, max_price, category (slug), user_id, in_stock,
+// created_after (RFC 3339 o 2006-01-02) y sort; responde 400 si alguno es invalido.
+func productFilterFromRequest(w http.ResponseWriter, r *http.Request) (*models.ProductFilter, bool) {
+	query := r.URL.Query()
+	filter := &models.ProductFilter{UserId: query.Get("user_id"), Sort: query.Get("sort")}
+
+	prices := []struct {
+		name string
+		dest **float64
+	}{{"min_price", &filter.MinPrice}, {"max_price", &filter.MaxPrice}}
+	for _, param := range prices {
+		if value := query.Get(param.name); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || price < 0 {
+				http.Error(w, fmt.Sprintf("invalid %s %q", param.name, value), http.StatusBadRequest)
+				return nil, false
+			}
+			*param.dest = &price
 		}
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		http.Error(w, "min_price is greater than max_price", http.StatusBadRequest)
+		return nil, false
+	}
 
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			file, header, err := r.FormFile("image")
-			if err != nil {
-				http.Error(w, "Error with the file", http.StatusBadRequest)
-				return
-			}
-			defer file.Close()
+	if slug := query.Get("category"); slug != "" {
+		category, err := repository.GetCategoryBySlug(r.Context(), slug)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		if category.Id == "" {
+			http.Error(w, fmt.Sprintf("category %s not found", slug), http.StatusBadRequest)
+			return nil, false
+		}
+		filter.CategoryId = category.Id
+	}
 
-			// guardar ruta en el servidor
-			now := time.Now()
-			folderPath := fmt.Sprintf("./uploads/%d/%02d/%02d", now.Year(), now.Month(), now.Day())
-			err = os.MkdirAll(folderPath, os.ModePerm)
-			if err != nil {
-				http.Error(w, "Error to create de folder", http.StatusInternalServerError)
-				return
-			}
+	if value := query.Get("in_stock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid in_stock %q", value), http.StatusBadRequest)
+			return nil, false
+		}
+		filter.InStock = inStock
+	}
 
-			filePath := filepath.Join(folderPath, header.Filename)
-			destFile, err := os.Create(filePath)
-			if err != nil {
-				http.Error(w, "Error to save the file", http.StatusInternalServerError)
-				return
-			}
+	if value := query.Get("created_after"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			createdAfter, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid created_after %q", value), http.StatusBadRequest)
+			return nil, false
+		}
+		filter.CreatedAfter = &createdAfter
+	}
 
-			defer destFile.Close()
+	switch filter.Sort {
+	case "", models.ProductSortNewest, models.ProductSortPriceAsc, models.ProductSortPriceDesc, models.ProductSortName:
+	default:
+		http.Error(w, fmt.Sprintf("invalid sort %q", filter.Sort), http.StatusBadRequest)
+		return nil, false
+	}
+	return filter, true
+}
 
-			_, err = io.Copy(destFile, file)
-			if err != nil {
-				http.Error(w, "Error to copy the file", http.StatusInternalServerError)
+func InsertImageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			product, ok := ownProduct(w, r)
+			if !ok {
 				return
 			}
-
-			url := fmt.Sprintf("/uploads/%d/%02d/%02d/%s", now.Year(), now.Month(), now.Day(), header.Filename)
-			image := models.Image{
-				UserId: claims.UserId,
-				Url:    url,
-				Name:   header.Filename,
-				Type:   header.Header.Get("Content-Type"),
-				Size:   header.Size,
-			}
-
-			log.Println(image)
-
-			imageID, err := repository.InsertImage(r.Context(), &image)
-			if err != nil {
-				http.Error(w, "Error to upload the image", http.StatusInternalServerError)
+			imageID, ok := uploadImage(s, w, r, claims.UserId)
+			if !ok {
 				return
 			}
 
-			err = repository.LinkProductToImage(r.Context(), params["id"], imageID)
+			err := repository.LinkProductToImage(r.Context(), product.Id, imageID)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -298,3 +367,56 @@ func InsertImageHandler(s server.Server) http.HandlerFunc {
 		}
 	}
 }
+
+// uploadImage guarda el archivo del campo "image" en la carpeta de uploads y lo registra en images.
+// Responde el error y devuelve false si algo falla.
+func uploadImage(s server.Server, w http.ResponseWriter, r *http.Request, userId string) (string, bool) {
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "Error with the file", http.StatusBadRequest)
+		return "", false
+	}
+	defer file.Close()
+
+	// guardar ruta en el servidor
+	now := time.Now()
+	folderPath := filepath.Join(s.Config().UploadsDir, fmt.Sprintf("%d/%02d/%02d", now.Year(), now.Month(), now.Day()))
+	err = os.MkdirAll(folderPath, os.ModePerm)
+	if err != nil {
+		http.Error(w, "Error to create de folder", http.StatusInternalServerError)
+		return "", false
+	}
+
+	filePath := filepath.Join(folderPath, header.Filename)
+	destFile, err := os.Create(filePath)
+	if err != nil {
+		http.Error(w, "Error to save the file", http.StatusInternalServerError)
+		return "", false
+	}
+
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, file)
+	if err != nil {
+		http.Error(w, "Error to copy the file", http.StatusInternalServerError)
+		return "", false
+	}
+
+	url := fmt.Sprintf("/uploads/%d/%02d/%02d/%s", now.Year(), now.Month(), now.Day(), header.Filename)
+	image := models.Image{
+		UserId: userId,
+		Url:    url,
+		Name:   header.Filename,
+		Type:   header.Header.Get("Content-Type"),
+		Size:   header.Size,
+	}
+
+	log.Println(image)
+
+	imageID, err := repository.InsertImage(r.Context(), &image)
+	if err != nil {
+		http.Error(w, "Error to upload the image", http.StatusInternalServerError)
+		return "", false
+	}
+	return imageID, true
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func TestProductFilterFromRequest(t *testing.T) {
+	repo := newTestRepository(t)
+	clothes := &models.Category{Id: "ropa-id", Name: "Ropa", Slug: "ropa"}
+	if err := repo.InsertCategory(context.Background(), clothes); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		query string
+		ok    bool
+		check func(filter *models.ProductFilter) bool
+	}{
+		{"no filters", "", true, func(filter *models.ProductFilter) bool {
+			return filter.MinPrice == nil && filter.MaxPrice == nil && filter.CategoryId == "" && !filter.InStock && filter.CreatedAfter == nil
+		}},
+		{"price range", "min_price=20&max_price=50", true, func(filter *models.ProductFilter) bool {
+			return *filter.MinPrice == 20 && *filter.MaxPrice == 50
+		}},
+		{"same min and max", "min_price=20&max_price=20", true, nil},
+		{"category slug", "category=ropa", true, func(filter *models.ProductFilter) bool { return filter.CategoryId == clothes.Id }},
+		{"in stock", "in_stock=true", true, func(filter *models.ProductFilter) bool { return filter.InStock }},
+		{"created after a date", "created_after=2026-10-18", true, func(filter *models.ProductFilter) bool {
+			return filter.CreatedAfter.Format("2006-01-02") == "2026-10-18"
+		}},
+		{"created after a time", "created_after=2026-10-18T12:00:00Z", true, func(filter *models.ProductFilter) bool {
+			return filter.CreatedAfter.Hour() == 12
+		}},
+		{"user and sort", "user_id=shop&sort=price_desc", true, func(filter *models.ProductFilter) bool {
+			return filter.UserId == "shop" && filter.Sort == models.ProductSortPriceDesc
+		}},
+		{"unknown sort", "sort=cheap", false, nil},
+		{"negative price", "min_price=-1", false, nil},
+		{"price not a number", "max_price=barato", false, nil},
+		{"min over max", "min_price=50&max_price=20", false, nil},
+		{"missing category", "category=missing", false, nil},
+		{"in stock not a bool", "in_stock=maybe", false, nil},
+		{"created after not a date", "created_after=ayer", false, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/products?"+test.query, nil)
+
+			filter, ok := productFilterFromRequest(w, r)
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v (%d %s)", test.ok, ok, w.Code, w.Body.String())
+			}
+			if !ok && w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", w.Code)
+			}
+			if ok && test.check != nil && !test.check(filter) {
+				t.Fatalf("unexpected filter %+v", filter)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/kevintovar01/Store/middleware"
 	"github.com/kevintovar01/Store/models"
@@ -45,13 +46,25 @@ func CreateRoleHandler(s server.Server) http.HandlerFunc {
 
 func ListRolesHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		request, ok := pageRequestFromRequest(w, r, "")
+		if !ok {
+			return
+		}
+		// los ids de los roles son numeros, la consulta compara el id del cursor con la columna
+		if request.Cursor != nil {
+			if _, err := strconv.Atoi(request.Cursor.Id); err != nil {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+		}
 
-		roles, err := repository.ListRoles(r.Context())
+		roles, err := repository.ListRoles(r.Context(), request)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Println(roles)
+		log.Println(roles.Items)
+		writePageLinks(w, r, roles.Next, roles.Prev)
 		// w.header nos permite enviar una cabecera en la respuesta
 		//content-type es el tipo de contenido que se esta enviando
 		//application/json es el tipo de contenido que se esta enviando
@@ -86,43 +99,9 @@ func getRoleRequest(w http.ResponseWriter, r *http.Request) (*models.Role, error
 	return role, nil
 }
 
-func SetRoleUserHandler(s server.Server) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			role, err := getRoleRequest(w, r)
-			if err != nil {
-				return
-			}
-			err = repository.SetRoleUser(r.Context(), claims.UserId, role.Id)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "aplication/json")
-			json.NewEncoder(w).Encode(&MessageRoleResponse{
-				Message: "The user is now: " + role.Name,
-			})
-		} else {
-			http.Error(w, "Invalid token", http.StatusInternalServerError)
-			return
-		}
-	}
-}
-
 func GetUserRolesHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
 
 			roles, err := repository.GetUserRoles(r.Context(), claims.UserId)
 			if err != nil {
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	ACCESS_TOKEN_TTL  = 15 * time.Minute
+	REFRESH_TOKEN_TTL = 30 * 24 * time.Hour
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens firma un access token corto (con jti para poder revocarlo) y guarda un refresh token nuevo.
+// familyId agrupa todos los refresh tokens que nacen del mismo login.
+func issueTokens(ctx context.Context, repo repository.Repository, s server.Server, userId string, familyId string) (*LoginResponse, error) {
+	jti, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := models.AppClaims{
+		UserId: userId,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ACCESS_TOKEN_TTL).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	accessToken, err := token.SignedString([]byte(s.Config().JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.InsertRefreshToken(ctx, &models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(REFRESH_TOKEN_TTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(ACCESS_TOKEN_TTL.Seconds()),
+	}, nil
+}
+
+// newOpaqueToken genera un token aleatorio que no contiene informacion, solo sirve para buscar su hash.
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenHandler cambia un refresh token valido por un par nuevo (rotacion).
+// Si llega un refresh token que ya fue usado se asume que fue robado y se revoca toda la familia.
+func RefreshTokenHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = RefreshTokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stored, err := repository.GetRefreshToken(r.Context(), hashToken(request.RefreshToken))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if stored.Id == "" || stored.ExpiresAt.Before(time.Now()) {
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		if stored.RevokedAt != nil {
+			revokeFamily(w, r, stored.FamilyId)
+			return
+		}
+
+		var response *LoginResponse
+		err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.RevokeRefreshToken(r.Context(), stored.Id); err != nil {
+				return err
+			}
+			response, err = issueTokens(r.Context(), tx, s, stored.UserId, stored.FamilyId)
+			return err
+		})
+		// otro request roto este mismo token primero
+		if errors.Is(err, repository.ErrRefreshTokenRevoked) {
+			revokeFamily(w, r, stored.FamilyId)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func revokeFamily(w http.ResponseWriter, r *http.Request, familyId string) {
+	if err := repository.RevokeRefreshFamily(r.Context(), familyId); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, "refresh token reused, session revoked", http.StatusUnauthorized)
+}
+
+// LogoutHandler revoca la familia del refresh token y agrega el access token actual a la lista de revocados.
+func LogoutHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			// el body es opcional, sin refresh token solo se revoca el access token
+			var request = RefreshTokenRequest{}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			err := repository.WithTx(r.Context(), func(tx repository.Repository) error {
+				if request.RefreshToken != "" {
+					stored, err := tx.GetRefreshToken(r.Context(), hashToken(request.RefreshToken))
+					if err != nil {
+						return err
+					}
+					// solo se revoca si el refresh token es del mismo usuario
+					if stored.Id != "" && stored.UserId == claims.UserId {
+						if err := tx.RevokeRefreshFamily(r.Context(), stored.FamilyId); err != nil {
+							return err
+						}
+					}
+				}
+				return tx.RevokeAccessToken(r.Context(), claims.Id, time.Unix(claims.ExpiresAt, 0))
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&MessageResponse{
+				Message: "logged out",
+			})
+		} else {
+			http.Error(w, "invalid token", http.StatusInternalServerError)
+			return
+		}
+	}
+}
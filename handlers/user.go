@@ -3,9 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/kevintovar01/Store/middleware"
 	"github.com/kevintovar01/Store/models"
 	"github.com/kevintovar01/Store/repository"
@@ -37,7 +35,9 @@ type SingUpbussinesResponse struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"` // access token
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // segundos de vida del access token
 }
 
 func SingUpHandler(s server.Server) http.HandlerFunc {
@@ -72,6 +72,8 @@ func SingUpHandler(s server.Server) http.HandlerFunc {
 			return
 		}
 
+		sendVerificationEmail(r.Context(), s, &user)
+
 		w.Header().Set("Content-type", "application/json")
 		json.NewEncoder(w).Encode(SingUpResponse{
 			Id:    user.Id,
@@ -109,39 +111,33 @@ func LoginHandler(s server.Server) http.HandlerFunc {
 			return
 		}
 
-		// Crea los claims para el JWT
-		claims := models.AppClaims{
-			UserId: user.Id,
-			StandardClaims: jwt.StandardClaims{
-				// Establece la fecha de expiración del token a 2 dias desde el momento actual
-				ExpiresAt: time.Now().Add(2 * time.Hour * 24).Unix(),
-			},
+		// cada login inicia una familia nueva de refresh tokens
+		familyId, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)           // Crea un nuevo token con los claims
-		tokenString, err := token.SignedString([]byte(s.Config().JWTSecret)) // Firma el token con la clave secreta
+		// Crea el access token y el refresh token
+		var response *LoginResponse
+		err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			response, err = issueTokens(r.Context(), tx, s, user.Id, familyId.String())
+			return err
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("content-type", "application/json")
-		json.NewEncoder(w).Encode(LoginResponse{
-			Token: tokenString,
-		})
+		json.NewEncoder(w).Encode(response)
 
 	}
 }
 
 func MyHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := middleware.TokenAuth(s, w, *r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
 			user, err := repository.GetUserById(r.Context(), claims.UserId)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -190,29 +186,38 @@ func InsertUserBusinessHandler(s server.Server) http.HandlerFunc {
 			CompanyId:   bussinessman.CompanyId,
 		}
 
-		err = repository.InsertUser(r.Context(), &bussinessman.User)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		err = repository.InsertUserBusiness(r.Context(), &bussinessman)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		// el usuario, la empresa y el rol se crean juntos o no se crea nada
+		err = repository.WithTx(r.Context(), func(tx repository.Repository) error {
+			if err := tx.InsertUser(r.Context(), &bussinessman.User); err != nil {
+				return err
+			}
+			if err := tx.InsertUserBusiness(r.Context(), &bussinessman); err != nil {
+				return err
+			}
 
-		role, err := repository.GetRole(r.Context(), "admin")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+			// los empresarios entran como merchant, admin solo lo asigna otro admin
+			role, err := tx.GetRole(r.Context(), "merchant")
+			if err != nil {
+				return err
+			}
 
-		err = repository.SetRoleUser(r.Context(), bussinessman.User.Id, role.Id)
+			if err := tx.SetRoleUser(r.Context(), bussinessman.User.Id, role.Id); err != nil {
+				return err
+			}
+			return tx.InsertGrantAudit(r.Context(), &models.GrantAudit{
+				ActorId: bussinessman.User.Id,
+				Action:  models.GrantRoleAdded,
+				UserId:  bussinessman.User.Id,
+				Role:    role.Name,
+			})
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		sendVerificationEmail(r.Context(), s, &bussinessman.User)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(SingUpbussinesResponse{
 			Id:          bussinessman.Id,
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/segmentio/ksuid"
+)
+
+type ProductOptionRequest struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// VariantRequest crea o edita una variante; al editar Options se ignora porque la combinacion no cambia.
+type VariantRequest struct {
+	Sku     string            `json:"sku"`
+	Price   *float64          `json:"price"` // null usa el precio del producto
+	Stock   int               `json:"stock"`
+	Options map[string]string `json:"options"`
+}
+
+func hasVariant(variants []*models.Variant, variantId string) bool {
+	for _, variant := range variants {
+		if variant.Id == variantId {
+			return true
+		}
+	}
+	return false
+}
+
+// ownProduct busca el producto de la url y verifica que sea del usuario; responde 404 o 403 si no.
+func ownProduct(w http.ResponseWriter, r *http.Request) (*models.ProductList, bool) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	product, err := repository.GetProductById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if product.Id == "" {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return nil, false
+	}
+	if product.User_id != claims.UserId {
+		http.Error(w, "not your product", http.StatusForbidden)
+		return nil, false
+	}
+	return product, true
+}
+
+// ownVariant busca la variante de la url dentro de un producto del usuario.
+func ownVariant(w http.ResponseWriter, r *http.Request) (*models.Variant, bool) {
+	product, ok := ownProduct(w, r)
+	if !ok {
+		return nil, false
+	}
+	variant, err := repository.GetVariantById(r.Context(), mux.Vars(r)["variantId"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if variant.Id == "" || variant.ProductId != product.Id {
+		http.Error(w, "variant not found", http.StatusNotFound)
+		return nil, false
+	}
+	return variant, true
+}
+
+// validVariant revisa el SKU, precio y stock de la variante; responde 400 o 409 si no son validos.
+func validVariant(w http.ResponseWriter, r *http.Request, variant *models.Variant) bool {
+	variant.Sku = strings.TrimSpace(variant.Sku)
+	if variant.Sku == "" {
+		http.Error(w, "variant needs a sku", http.StatusBadRequest)
+		return false
+	}
+	if variant.Stock < 0 {
+		http.Error(w, "stock must be zero or greater", http.StatusBadRequest)
+		return false
+	}
+	if variant.Price != nil && *variant.Price < 0 {
+		http.Error(w, "price must be zero or greater", http.StatusBadRequest)
+		return false
+	}
+
+	existing, err := repository.GetVariantBySku(r.Context(), variant.Sku)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if existing.Id != "" && existing.Id != variant.Id {
+		http.Error(w, "sku already in use", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// InsertProductOptionHandler agrega un eje de variantes (talla, color...) a un producto sin variantes.
+func InsertProductOptionHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = ProductOptionRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+
+		option := models.ProductOption{
+			ProductId: product.Id,
+			Name:      strings.TrimSpace(request.Name),
+		}
+		if option.Name == "" {
+			http.Error(w, "option needs a name", http.StatusBadRequest)
+			return
+		}
+		seen := make(map[string]bool)
+		for _, value := range request.Values {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[value] {
+				http.Error(w, "option values must be unique and not empty", http.StatusBadRequest)
+				return
+			}
+			seen[value] = true
+			option.Values = append(option.Values, value)
+		}
+		if len(option.Values) == 0 {
+			http.Error(w, "option needs at least one value", http.StatusBadRequest)
+			return
+		}
+
+		// las variantes que ya existen no tendrian valor para la nueva opcion
+		variants, err := repository.ListVariants(r.Context(), product.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(variants) > 0 {
+			http.Error(w, "product already has variants", http.StatusConflict)
+			return
+		}
+
+		options, err := repository.ListProductOptions(r.Context(), product.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, existing := range options {
+			if existing.Name == option.Name {
+				http.Error(w, "option already exists", http.StatusConflict)
+				return
+			}
+		}
+		option.Position = len(options)
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		option.Id = id.String()
+
+		if err = repository.InsertProductOption(r.Context(), &option); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&option)
+	}
+}
+
+// InsertVariantHandler crea una combinacion de valores de las opciones del producto.
+// Cada opcion debe tener un valor y no puede haber dos variantes con la misma combinacion.
+func InsertVariantHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = VariantRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		product, ok := ownProduct(w, r)
+		if !ok {
+			return
+		}
+
+		options, err := repository.ListProductOptions(r.Context(), product.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(options) == 0 {
+			http.Error(w, "product has no options", http.StatusBadRequest)
+			return
+		}
+		if len(request.Options) != len(options) {
+			http.Error(w, "variant needs exactly one value for each option", http.StatusBadRequest)
+			return
+		}
+		for _, option := range options {
+			value, ok := request.Options[option.Name]
+			if !ok || !containsValue(option.Values, value) {
+				http.Error(w, "invalid value for option "+option.Name, http.StatusBadRequest)
+				return
+			}
+		}
+
+		variants, err := repository.ListVariants(r.Context(), product.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, existing := range variants {
+			if sameOptions(existing.Options, request.Options) {
+				http.Error(w, "a variant with these options already exists", http.StatusConflict)
+				return
+			}
+		}
+
+		variant := models.Variant{
+			ProductId: product.Id,
+			Sku:       request.Sku,
+			Price:     request.Price,
+			Stock:     request.Stock,
+			Options:   request.Options,
+			Images:    []string{},
+		}
+		if !validVariant(w, r, &variant) {
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		variant.Id = id.String()
+
+		if err = repository.InsertVariant(r.Context(), &variant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&variant)
+	}
+}
+
+func UpdateVariantHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = VariantRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		variant, ok := ownVariant(w, r)
+		if !ok {
+			return
+		}
+		variant.Sku = request.Sku
+		variant.Price = request.Price
+		variant.Stock = request.Stock
+		if !validVariant(w, r, variant) {
+			return
+		}
+
+		if err := repository.UpdateVariant(r.Context(), variant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(variant)
+	}
+}
+
+// DeleteVariantHandler borra la variante, tambien sale de los carritos que la tenian.
+func DeleteVariantHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		variant, ok := ownVariant(w, r)
+		if !ok {
+			return
+		}
+
+		if err := repository.DeleteVariant(r.Context(), variant.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&MessageResponse{
+			Message: "Variant deleted",
+		})
+	}
+}
+
+// InsertVariantImageHandler sube una imagen (campo "image" del form) para la variante.
+func InsertVariantImageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := middleware.ClaimsFromContext(r.Context())
+
+		variant, ok := ownVariant(w, r)
+		if !ok {
+			return
+		}
+
+		imageID, ok := uploadImage(s, w, r, claims.UserId)
+		if !ok {
+			return
+		}
+
+		if err := repository.LinkVariantToImage(r.Context(), variant.Id, imageID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&ProductUpdateResponse{
+			Message: "Image upload",
+		})
+	}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sameOptions(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if b[name] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+	"github.com/kevintovar01/Store/websocket"
+)
+
+// WebSocketHandler abre la conexion del usuario autenticado; el token llega en el header
+// Authorization o, desde el navegador, en ?token=.
+// Al reconectarse el cliente manda sus topics en ?topics=a,b y el ultimo seq que recibio en ?since=
+// para que se le repitan los eventos que perdio.
+func WebSocketHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			options, ok := connectOptions(w, r, claims.UserId)
+			if !ok {
+				return
+			}
+			s.Hub().Connect(w, r, claims.UserId, options)
+		} else {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+}
+
+// EventsHandler envia los mismos eventos que /ws como Server-Sent Events. Recibe los mismos
+// parametros; al reconectarse el navegador manda el ultimo seq en el header Last-Event-ID.
+func EventsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+			options, ok := connectOptions(w, r, claims.UserId)
+			if !ok {
+				return
+			}
+			s.Hub().Stream(w, r, claims.UserId, options)
+		} else {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+}
+
+// connectOptions lee los topics y el seq desde el que se reanuda; responde 400 o 403 si no son validos.
+func connectOptions(w http.ResponseWriter, r *http.Request, userId string) (websocket.ConnectOptions, bool) {
+	var options = websocket.ConnectOptions{}
+	query := r.URL.Query()
+
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = query.Get("since")
+	}
+	if since != "" {
+		seq, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || seq < 1 {
+			http.Error(w, "since must be a positive sequence number", http.StatusBadRequest)
+			return options, false
+		}
+		options.Since = seq
+	}
+
+	if topics := query.Get("topics"); topics != "" {
+		for _, topic := range strings.Split(topics, ",") {
+			allowed, err := canSubscribe(r.Context(), userId, topic)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return options, false
+			}
+			if !allowed {
+				http.Error(w, "cannot subscribe to "+topic, http.StatusForbidden)
+				return options, false
+			}
+			options.Topics = append(options.Topics, topic)
+		}
+	}
+
+	return options, true
+}
+
+// PingMessageHandler responde pong con el mismo payload, sirve para que el cliente mida la conexion.
+func PingMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		client.Send(models.WebsocketMessage{
+			Type:    models.MessagePong,
+			Payload: payload,
+		})
+	}
+}
+
+// SubscribeMessageHandler suscribe al cliente a un topic si su usuario puede verlo.
+func SubscribeMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		var request = models.TopicRequest{}
+		if err := json.Unmarshal(payload, &request); err != nil || request.Topic == "" {
+			client.SendError("subscribe needs a topic")
+			return
+		}
+
+		allowed, err := canSubscribe(context.Background(), client.UserId(), request.Topic)
+		if err != nil {
+			client.SendError(err.Error())
+			return
+		}
+		if !allowed {
+			client.SendError("cannot subscribe to " + request.Topic)
+			return
+		}
+
+		s.Hub().Subscribe(client, request.Topic)
+		client.Send(models.WebsocketMessage{
+			Type:    models.MessageSubscribed,
+			Payload: &request,
+		})
+	}
+}
+
+func UnsubscribeMessageHandler(s server.Server) websocket.MessageHandler {
+	return func(client *websocket.Client, payload json.RawMessage) {
+		var request = models.TopicRequest{}
+		if err := json.Unmarshal(payload, &request); err != nil || request.Topic == "" {
+			client.SendError("unsubscribe needs a topic")
+			return
+		}
+
+		s.Hub().Unsubscribe(client, request.Topic)
+		client.Send(models.WebsocketMessage{
+			Type:    models.MessageUnsubscribed,
+			Payload: &request,
+		})
+	}
+}
+
+// canSubscribe decide quien puede seguir cada topic: los productos son publicos,
+// user:{id} es solo del propio usuario y order:{id} del dueño o de quien tenga order:read.
+func canSubscribe(ctx context.Context, userId string, topic string) (bool, error) {
+	if topic == models.TopicProducts {
+		return true, nil
+	}
+
+	kind, id, ok := strings.Cut(topic, ":")
+	if !ok || id == "" {
+		return false, nil
+	}
+
+	switch kind {
+	case "product", "presence":
+		return true, nil
+	case "user":
+		return id == userId, nil
+	case "order":
+		order, err := repository.GetOrderById(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		if order.Id != "" && order.UserId == userId {
+			return true, nil
+		}
+		return middleware.HasPermission(ctx, userId, models.PermissionOrderRead)
+	default:
+		return false, nil
+	}
+}
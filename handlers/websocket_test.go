@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func TestCanSubscribe(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	for _, userId := range []string{"ana", "bob", "staff"} {
+		if err := repo.InsertUser(ctx, &models.User{Id: userId, Email: userId + "@store.com", Password: "secret"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin, err := repo.GetRole(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.SetRoleUser(ctx, "staff", admin.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.CreateOrder(ctx, &models.Order{Id: "ana-order", UserId: "ana", Status: models.OrderPending}); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob no tiene ninguna conversacion con ana
+	for _, test := range []struct {
+		name   string
+		userId string
+		topic  string
+		allow  bool
+	}{
+		{"product list", "bob", models.TopicProducts, true},
+		{"a product", "bob", "product:mouse", true},
+		// la presencia va en su propio topic porque user:{id} es privado: cualquiera la sigue, aunque no sea contacto
+		{"presence of a non-contact", "bob", models.PresenceTopic("ana"), true},
+		{"own user topic", "ana", models.UserTopic("ana"), true},
+		{"someone else's user topic", "bob", models.UserTopic("ana"), false},
+		{"own order", "ana", models.OrderTopic("ana-order"), true},
+		{"someone else's order", "bob", models.OrderTopic("ana-order"), false},
+		{"order as staff", "staff", models.OrderTopic("ana-order"), true},
+		{"a connection", "bob", models.ClientTopic("ana-connection"), false},
+		{"unknown kind", "bob", "chat:ana", false},
+		{"missing id", "bob", "presence:", false},
+		{"no kind", "bob", "presence", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			allow, err := canSubscribe(ctx, test.userId, test.topic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allow != test.allow {
+				t.Fatalf("%s subscribing to %s: expected %v, got %v", test.userId, test.topic, test.allow, allow)
+			}
+		})
+	}
+}
@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"github.com/kevintovar01/Store/database"
 	"github.com/kevintovar01/Store/handlers"
 	"github.com/kevintovar01/Store/middleware"
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/repository"
 	"github.com/kevintovar01/Store/server"
 )
 
@@ -22,11 +27,38 @@ func main() {
 	PORT := os.Getenv("PORT")
 	JWT_SECRET := os.Getenv("JWT_SECRET")
 	DATABASE_URL := os.Getenv("DATABASE_URL")
+	DATABASE_DRIVER := os.Getenv("DATABASE_DRIVER") // "memory" para correr sin postgres
+
+	// go run . migrate [up | down <n> | status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := Migrate(DATABASE_URL, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// go run . grant-admin <email>, para crear el primer admin
+	if len(os.Args) > 2 && os.Args[1] == "grant-admin" {
+		if err := GrantAdmin(DATABASE_URL, os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	s, err := server.NewServer(context.Background(), &server.Config{
-		Port:        PORT,
-		JWTSecret:   JWT_SECRET,
-		DatabaseUrl: DATABASE_URL,
+		Port:                 PORT,
+		JWTSecret:            JWT_SECRET,
+		DatabaseUrl:          DATABASE_URL,
+		DatabaseDriver:       DATABASE_DRIVER,
+		SMTPHost:             os.Getenv("SMTP_HOST"),
+		SMTPPort:             os.Getenv("SMTP_PORT"),
+		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		MailFrom:             os.Getenv("MAIL_FROM"),
+		MailOutboxDir:        os.Getenv("MAIL_OUTBOX_DIR"),
+		AppUrl:               os.Getenv("APP_URL"),
+		RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		UploadsDir:           os.Getenv("UPLOADS_DIR"),
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -35,49 +67,217 @@ func main() {
 	s.Start(BindRoutes)
 }
 
+// Migrate ejecuta las migraciones de la base de datos sin levantar el servidor.
+func Migrate(databaseUrl string, args []string) error {
+	repo, err := database.NewPostgresRepository(databaseUrl)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return repo.MigrateUp(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+		}
+		return repo.MigrateDown(ctx, steps)
+	case "status":
+		status, err := repo.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			log.Printf("%04d_%s applied=%t", m.Version, m.Name, m.Applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+}
+
+// GrantAdmin asigna el rol admin a un usuario existente; las rutas de roles ya exigen role:manage,
+// asi que el primer admin se crea desde la linea de comandos.
+func GrantAdmin(databaseUrl string, email string) error {
+	repo, err := database.NewPostgresRepository(databaseUrl)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	if err := repo.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	return repo.WithTx(ctx, func(tx repository.Repository) error {
+		user, err := tx.GetUserByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if user.Id == "" {
+			return fmt.Errorf("user not found: %s", email)
+		}
+
+		role, err := tx.GetRole(ctx, "admin")
+		if err != nil {
+			return err
+		}
+
+		roles, err := tx.GetUserRoles(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		for _, name := range roles {
+			if name == role.Name {
+				log.Printf("%s is already admin", email)
+				return nil
+			}
+		}
+
+		if err := tx.SetRoleUser(ctx, user.Id, role.Id); err != nil {
+			return err
+		}
+		log.Printf("%s is now admin", email)
+		return tx.InsertGrantAudit(ctx, &models.GrantAudit{
+			ActorId: "cli",
+			Action:  models.GrantRoleAdded,
+			UserId:  user.Id,
+			Role:    role.Name,
+		})
+	})
+}
+
 func BindRoutes(s server.Server, r *mux.Router) {
 	// api := r.PathPrefix("/api/v1").Subrouter()
 	// r es tu *mux.Router
 	r.PathPrefix("/uploads/").Handler(
 		http.StripPrefix("/uploads/",
-			http.FileServer(http.Dir("./uploads"))),
+			http.FileServer(http.Dir(s.Config().UploadsDir))),
 	)
 
-	// Le estamos diciendo a nuestro router, que para cada una de esas rutas use el middleware CheckAuthMiddleware
-	r.Use(middleware.CheckAuthMiddleware(s))
+	// cada ruta declara quien puede entrar: public, authenticated o un permiso
+	public := middleware.Public()
+	authenticated := middleware.Authenticated(s)
+	productWrite := middleware.Permission(s, models.PermissionProductWrite)
+	orderUpdate := middleware.Permission(s, models.PermissionOrderUpdate)
+	roleManage := middleware.Permission(s, models.PermissionRoleManage)
+	categoryManage := middleware.Permission(s, models.PermissionCategoryManage)
 
 	// url for the users
-	r.HandleFunc("/", handlers.HomeHandler(s)).Methods(http.MethodGet)                              //esto es home (Ya esta )
-	r.HandleFunc("/signup", handlers.SingUpHandler(s)).Methods(http.MethodPost)                     // debe ir en register
-	r.HandleFunc("/signupBusiness", handlers.InsertUserBusinessHandler(s)).Methods(http.MethodPost) //debe ir en register
-	r.HandleFunc("/login", handlers.LoginHandler(s)).Methods(http.MethodPost)                       //ya esta
-	r.HandleFunc("/me", handlers.MyHandler(s)).Methods(http.MethodGet)                              //perfil ya esta
+	r.HandleFunc("/", public(handlers.HomeHandler(s))).Methods(http.MethodGet)                              //esto es home (Ya esta )
+	r.HandleFunc("/signup", public(handlers.SingUpHandler(s))).Methods(http.MethodPost)                     // debe ir en register
+	r.HandleFunc("/signupBusiness", public(handlers.InsertUserBusinessHandler(s))).Methods(http.MethodPost) //debe ir en register
+	r.HandleFunc("/login", public(handlers.LoginHandler(s))).Methods(http.MethodPost)                       //ya esta
+	r.HandleFunc("/me", authenticated(handlers.MyHandler(s))).Methods(http.MethodGet)                       //perfil ya esta
+	r.HandleFunc("/token/refresh", public(handlers.RefreshTokenHandler(s))).Methods(http.MethodPost)        // rota el refresh token
+	r.HandleFunc("/logout", authenticated(handlers.LogoutHandler(s))).Methods(http.MethodPost)              // revoca la sesion
+	r.HandleFunc("/password/forgot", public(handlers.ForgotPasswordHandler(s))).Methods(http.MethodPost)    // envia el enlace de reseteo
+	r.HandleFunc("/password/reset", public(handlers.ResetPasswordHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/verify-email", public(handlers.VerifyEmailHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/verify-email/resend", authenticated(handlers.ResendVerificationHandler(s))).Methods(http.MethodPost)
 
 	// url for the products de (aca esta todo)
-	r.HandleFunc("/products", middleware.RoleProxy([]string{"admin"}, s)(handlers.InsertProductHandler(s))).Methods(http.MethodPost)
-	r.HandleFunc("/image/{id}", middleware.RoleProxy([]string{"admin"}, s)(handlers.InsertImageHandler(s))).Methods(http.MethodPost)
-	r.HandleFunc("/products/{id}", middleware.RoleProxy([]string{"admin"}, s)(handlers.GetProductByIdHandler(s))).Methods(http.MethodGet)
-	r.HandleFunc("/products/{id}", middleware.RoleProxy([]string{"admin"}, s)(handlers.UpdateProductHandler(s))).Methods(http.MethodPut)
-	r.HandleFunc("/products/{id}", middleware.RoleProxy([]string{"admin"}, s)(handlers.DeleteProductHandler(s))).Methods(http.MethodDelete)
-	r.HandleFunc("/products", handlers.ListProductHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/products", productWrite(handlers.InsertProductHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/image/{id}", productWrite(handlers.InsertImageHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/products/search", public(handlers.SearchProductsHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/products/{id}", public(handlers.GetProductByIdHandler(s))).Methods(http.MethodGet) // los clientes eligen la variante desde aca
+	r.HandleFunc("/products/{id}", productWrite(handlers.UpdateProductHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/products/{id}", productWrite(handlers.DeleteProductHandler(s))).Methods(http.MethodDelete)
+	r.HandleFunc("/products", public(handlers.ListProductHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/products/{id}/categories", productWrite(handlers.SetProductCategoriesHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/products/{id}/images", public(handlers.ListProductImagesHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/products/{id}/images", productWrite(handlers.ReorderProductImagesHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/products/{id}/images/{imageId}/primary", productWrite(handlers.SetPrimaryProductImageHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/products/{id}/images/{imageId}", productWrite(handlers.DeleteProductImageHandler(s))).Methods(http.MethodDelete)
+	// variantes: primero las opciones (talla, color...) y luego una variante por combinacion
+	r.HandleFunc("/products/{id}/options", productWrite(handlers.InsertProductOptionHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/products/{id}/variants", productWrite(handlers.InsertVariantHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/products/{id}/variants/{variantId}", productWrite(handlers.UpdateVariantHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/products/{id}/variants/{variantId}", productWrite(handlers.DeleteVariantHandler(s))).Methods(http.MethodDelete)
+	r.HandleFunc("/products/{id}/variants/{variantId}/images", productWrite(handlers.InsertVariantImageHandler(s))).Methods(http.MethodPost)
+
+	// categorias, anidadas con parent_id; los productos de una categoria incluyen los de sus subcategorias
+	r.HandleFunc("/categories", public(handlers.ListCategoriesHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/categories", categoryManage(handlers.InsertCategoryHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/categories/{slug}", public(handlers.GetCategoryHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/categories/{slug}", categoryManage(handlers.UpdateCategoryHandler(s))).Methods(http.MethodPut)
+	r.HandleFunc("/categories/{slug}", categoryManage(handlers.DeleteCategoryHandler(s))).Methods(http.MethodDelete)
+	r.HandleFunc("/categories/{slug}/products", public(handlers.ListCategoryProductsHandler(s))).Methods(http.MethodGet)
 
 	// urls for the carwish es CartPage
-	r.HandleFunc("/addItem/{id}", handlers.AddItemHandler(s)).Methods(http.MethodPost)      //agregar a carrito (+/-)
-	r.HandleFunc("/wishcar", handlers.ListItemHandler(s)).Methods(http.MethodGet)           //Mostrar productos de  carrito
-	r.HandleFunc("/wishcar/{id}", handlers.RemoveItemHandler(s)).Methods(http.MethodDelete) //eliminar item del carrito
+	r.HandleFunc("/addItem/{id}", authenticated(handlers.AddItemHandler(s))).Methods(http.MethodPost)      //agregar a carrito (+/-)
+	r.HandleFunc("/wishcar", authenticated(handlers.ListItemHandler(s))).Methods(http.MethodGet)           //Mostrar productos de  carrito
+	r.HandleFunc("/wishcar/{id}", authenticated(handlers.RemoveItemHandler(s))).Methods(http.MethodDelete) //eliminar item del carrito
+
+	// urls for the orders
+	r.HandleFunc("/checkout", authenticated(handlers.CheckoutHandler(s))).Methods(http.MethodPost) // convierte el carrito en una orden
+	r.HandleFunc("/orders", authenticated(handlers.ListOrdersHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/orders/{id}", authenticated(handlers.GetOrderHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/orders/{id}/history", authenticated(handlers.GetOrderHistoryHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/orders/{id}/status", orderUpdate(handlers.UpdateOrderStatusHandler(s))).Methods(http.MethodPut)
 
 	//roles urls (ESTE LO IGNORO)
-	r.HandleFunc("/createRole", middleware.RoleProxy([]string{"admin"}, s)(handlers.CreateRoleHandler(s))).Methods(http.MethodPost)
-	r.HandleFunc("/listRoles", middleware.RoleProxy([]string{"admin"}, s)(handlers.ListRolesHandler(s))).Methods(http.MethodGet)
-	r.HandleFunc("/getRole", handlers.GetRoleHandler(s)).Methods(http.MethodGet)
-	r.HandleFunc("/setRole", handlers.SetRoleUserHandler(s)).Methods(http.MethodPost)
-	r.HandleFunc("/getUserRoles", handlers.GetUserRolesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/createRole", roleManage(handlers.CreateRoleHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/listRoles", roleManage(handlers.ListRolesHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/getRole", authenticated(handlers.GetRoleHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/getUserRoles", authenticated(handlers.GetUserRolesHandler(s))).Methods(http.MethodGet)
+
+	// asignacion de roles y permisos, cada cambio queda en grant_audit
+	r.HandleFunc("/users/{id}/roles", roleManage(handlers.ListUserRolesHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/users/{id}/roles", roleManage(handlers.GrantUserRoleHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/users/{id}/roles/{role}", roleManage(handlers.RevokeUserRoleHandler(s))).Methods(http.MethodDelete)
+	r.HandleFunc("/permissions", roleManage(handlers.ListPermissionsHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/roles/{name}/permissions", roleManage(handlers.ListRolePermissionsHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/roles/{name}/permissions", roleManage(handlers.GrantRolePermissionHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/roles/{name}/permissions/{permission}", roleManage(handlers.RevokeRolePermissionHandler(s))).Methods(http.MethodDelete)
+	r.HandleFunc("/audit/grants", roleManage(handlers.ListGrantAuditHandler(s))).Methods(http.MethodGet)
+
+	// chat entre clientes y vendedores, los mensajes tambien llegan en vivo por /ws y /events
+	r.HandleFunc("/conversations", authenticated(handlers.StartConversationHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/conversations", authenticated(handlers.ListConversationsHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/conversations/{id}/messages", authenticated(handlers.ListChatMessagesHandler(s))).Methods(http.MethodGet)
+	r.HandleFunc("/conversations/{id}/messages", authenticated(handlers.SendChatMessageHandler(s))).Methods(http.MethodPost)
+	r.HandleFunc("/conversations/{id}/read", authenticated(handlers.ReadConversationHandler(s))).Methods(http.MethodPost)
+	// registro de videollamadas, la señalizacion va por el websocket
+	r.HandleFunc("/calls", authenticated(handlers.ListCallsHandler(s))).Methods(http.MethodGet)
+	// si el usuario esta conectado, los cambios llegan por el topic presence:{id}
+	r.HandleFunc("/users/{id}/presence", authenticated(handlers.GetPresenceHandler(s))).Methods(http.MethodGet)
 
 	// el handler de websocket se encarga de manejar las conexiones de websocket
-	r.HandleFunc("/ws", s.Hub().HandleWebSocket)
+	r.HandleFunc("/ws", authenticated(handlers.WebSocketHandler(s)))
+	// los mismos eventos como Server-Sent Events, para quien no puede usar websocket
+	r.HandleFunc("/events", authenticated(handlers.EventsHandler(s))).Methods(http.MethodGet)
+
+	// mensajes que los clientes envian por el websocket
+	calls := handlers.NewCallRinger(s)
+	s.Hub().HandleMessage(models.MessagePing, handlers.PingMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageSubscribe, handlers.SubscribeMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageUnsubscribe, handlers.UnsubscribeMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageChatSend, handlers.ChatSendMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageChatTyping, handlers.ChatTypingMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageChatRead, handlers.ChatReadMessageHandler(s))
+	s.Hub().HandleMessage(models.MessageCallStart, handlers.CallStartMessageHandler(s, calls))
+	s.Hub().HandleMessage(models.MessageCallAccept, handlers.CallAcceptMessageHandler(s, calls))
+	s.Hub().HandleMessage(models.MessageCallReject, handlers.CallRejectMessageHandler(s, calls))
+	s.Hub().HandleMessage(models.MessageCallHangup, handlers.CallHangupMessageHandler(s, calls))
+	s.Hub().HandleMessage(models.MessageCallSignal, handlers.CallSignalMessageHandler(s))
+	s.Hub().HandleMessage(models.MessagePresence, handlers.PresenceMessageHandler(s))
+	s.Hub().HandleDisconnect(handlers.HangupOnDisconnect(s, calls))
 
 }
 
-// "/wishcar/{id}", handlers.RemoveItemHandler(s) el id es el del producto
-// "/wishcar/{id}", handlers.ListItemHandler(s) el id es el del carrito
-//"/addItem/{id}", handlers.AddItemHandler(s) el id es el del producto
+// "/wishcar/{id}", authenticated(handlers.RemoveItemHandler(s)) el id es el del producto
+// "/wishcar/{id}", authenticated(handlers.ListItemHandler(s)) el id es el del carrito
+//"/addItem/{id}", authenticated(handlers.AddItemHandler(s)) el id es el del producto
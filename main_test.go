@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevintovar01/Store/repository"
+	"github.com/kevintovar01/Store/server"
+)
+
+// newTestServer levanta las rutas reales de BindRoutes sobre el repositorio en memoria.
+// options permite cambiar la configuracion antes de crear el servidor.
+func newTestServer(t *testing.T, options ...func(config *server.Config)) *httptest.Server {
+	t.Helper()
+
+	config := &server.Config{
+		Port:           ":0",
+		JWTSecret:      "test-secret",
+		DatabaseDriver: "memory",
+		MailOutboxDir:  t.TempDir(),
+		UploadsDir:     t.TempDir(),
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	s, err := server.NewServer(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := s.Setup(BindRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// doJSON envia body como json y decodifica la respuesta en out (si no es nil).
+func doJSON(t *testing.T, ts *httptest.Server, method, path, token string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, &reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func login(t *testing.T, ts *httptest.Server, email, password string) string {
+	t.Helper()
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	status := doJSON(t, ts, http.MethodPost, "/login", "", map[string]string{"email": email, "password": password}, &response)
+	if status != http.StatusOK || response.Token == "" {
+		t.Fatalf("login %s: status %d", email, status)
+	}
+	return response.Token
+}
+
+func signUp(t *testing.T, ts *httptest.Server, email, password string) string {
+	t.Helper()
+
+	status := doJSON(t, ts, http.MethodPost, "/signup", "", map[string]string{"email": email, "password": password}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("signup %s: status %d", email, status)
+	}
+	return login(t, ts, email, password)
+}
+
+func signUpMerchant(t *testing.T, ts *httptest.Server, email, password string) string {
+	t.Helper()
+
+	status := doJSON(t, ts, http.MethodPost, "/signupBusiness", "", map[string]string{
+		"email":        email,
+		"password":     password,
+		"company_name": "Store",
+		"company_id":   "900123",
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("signupBusiness %s: status %d", email, status)
+	}
+	return login(t, ts, email, password)
+}
+
+// signUpAdmin registra un usuario y le da el rol admin directo en el repositorio,
+// igual que "go run . grant-admin" en produccion.
+func signUpAdmin(t *testing.T, ts *httptest.Server, email, password string) string {
+	t.Helper()
+
+	signUp(t, ts, email, password)
+
+	ctx := context.Background()
+	user, err := repository.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, err := repository.GetRole(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.SetRoleUser(ctx, user.Id, role.Id); err != nil {
+		t.Fatal(err)
+	}
+	return login(t, ts, email, password)
+}
+
+func createProduct(t *testing.T, ts *httptest.Server, token string, name string, price float64, stock int) string {
+	t.Helper()
+
+	var product struct {
+		Id string `json:"id"`
+	}
+	status := doJSON(t, ts, http.MethodPost, "/products", token, map[string]interface{}{
+		"name":        name,
+		"description": name + " description",
+		"price":       price,
+		"stock":       stock,
+	}, &product)
+	if status != http.StatusOK || product.Id == "" {
+		t.Fatalf("create product: status %d", status)
+	}
+	return product.Id
+}
@@ -3,67 +3,65 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/websocket"
 	"github.com/kevintovar01/Store/models"
 	"github.com/kevintovar01/Store/repository"
 	"github.com/kevintovar01/Store/server"
 )
 
-var (
-	//rutas para indicar la middleware que no necesita autenticacion
-	NOT_AUTH_NEEDED = []string{
-		"signup",
-		"signupBusiness",
-		"login",
-		"/",
-	}
-)
+type contextKey string
 
-// se itera sobre las rutas que no necesitan autenticacion
-func shouldCheckToken(route string) bool {
-	for _, p := range NOT_AUTH_NEEDED {
-		if strings.Contains(route, p) {
-			return false
-		}
+const claimsContextKey contextKey = "claims"
+
+// Policy decide quien puede entrar a una ruta. Cada ruta de BindRoutes declara la suya:
+// Public, Authenticated, Roles o Permission.
+type Policy func(next http.HandlerFunc) http.HandlerFunc
+
+// ClaimsFromContext devuelve los claims que dejo Authenticated (o Roles) en el request.
+func ClaimsFromContext(ctx context.Context) (*models.AppClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*models.AppClaims)
+	return claims, ok
+}
+
+// Public deja pasar el request sin token.
+func Public() Policy {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return next
 	}
-	return true
 }
 
-// CheckAuthMiddleware es un middleware que protege rutas específicas en la aplicación
-// verificando la presencia y validez de un token de autenticación en las solicitudes HTTP.
-// Si la ruta no requiere autenticación, la solicitud se procesa normalmente.
-// Si la ruta requiere autenticación y el token es válido, la solicitud se procesa;
-// de lo contrario, se responde con un error de autorización.
-func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !shouldCheckToken(r.URL.Path) {
-				// Entra cuando shouldCheckToken es falso
-				// La ruta no está protegida, puede seguir (next) sin el token de autenticación
-				next.ServeHTTP(w, r)
+// Authenticated exige un token valido y guarda sus claims en el contexto del request.
+func Authenticated(s server.Server) Policy {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token, err := TokenAuth(s, w, *r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
 
-			_, err := TokenAuth(s, w, *r)
-			// Si hay un error al parsear o validar el token, responde con un error de autorización
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+			claims, ok := token.Claims.(*models.AppClaims)
+			if !ok || !token.Valid {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			// Si el token es válido, continúa con la siguiente función en la cadena
-			next.ServeHTTP(w, r)
-		})
+			next(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+		}
 	}
 }
 
 // TokenAuth es una función auxiliar que se utiliza para extraer y validar un token de autenticación
 func TokenAuth(s server.Server, w http.ResponseWriter, r http.Request) (*jwt.Token, error) {
 	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
+	// el navegador no deja poner headers al abrir un websocket ni un EventSource, ahi el token viaja en la url
+	if tokenString == "" && (websocket.IsWebSocketUpgrade(&r) || r.Header.Get("Accept") == "text/event-stream") {
+		tokenString = r.URL.Query().Get("token")
+	}
 	if tokenString == "" {
 		return nil, fmt.Errorf("authorization header missing")
 	}
@@ -79,34 +77,37 @@ func TokenAuth(s server.Server, w http.ResponseWriter, r http.Request) (*jwt.Tok
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
+	// los tokens sin jti no se pueden revocar, se rechazan
+	claims, ok := token.Claims.(*models.AppClaims)
+	if !ok || claims.Id == "" {
+		return nil, fmt.Errorf("invalid token: missing token id")
+	}
+
+	revoked, err := repository.IsAccessTokenRevoked(r.Context(), claims.Id)
+	if err != nil {
+		return nil, fmt.Errorf("checking token: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("invalid token: token revoked")
+	}
+
 	return token, nil
 
 }
 
-// RoleProxy verifica si el usuario tiene el rol necesario antes de ejecutar el handler original.
-func RoleProxy(allowedRoles []string, s server.Server) func(next http.HandlerFunc) http.HandlerFunc {
+// Roles exige un token valido y que el usuario tenga alguno de los roles indicados.
+func Roles(s server.Server, allowedRoles ...string) Policy {
 	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			token, err := TokenAuth(s, w, *r)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
-				return
-			}
+		return Authenticated(s)(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
 
-			claims, ok := token.Claims.(*models.AppClaims)
-			if !ok || !token.Valid {
-				http.Error(w, "invalid token", http.StatusUnauthorized)
-				return
-			}
 			// Obtiene los roles del usuario desde la BD
-			roles, err := repository.GetUserRoles(context.Background(), claims.UserId)
+			roles, err := repository.GetUserRoles(r.Context(), claims.UserId)
 			if err != nil {
 				http.Error(w, "Error retrieving user roles", http.StatusInternalServerError)
 				return
 			}
 
-			log.Println(roles)
-
 			roleMap := make(map[string]bool)
 			for _, role := range roles {
 				roleMap[strings.ToLower(role)] = true
@@ -120,7 +121,41 @@ func RoleProxy(allowedRoles []string, s server.Server) func(next http.HandlerFun
 			}
 
 			http.Error(w, "Forbidden: insufficient privileges", http.StatusForbidden)
+		})
+	}
+}
 
+// Permission exige un token valido y que alguno de los roles del usuario tenga el permiso.
+func Permission(s server.Server, permission string) Policy {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return Authenticated(s)(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+
+			allowed, err := HasPermission(r.Context(), claims.UserId, permission)
+			if err != nil {
+				http.Error(w, "Error retrieving user permissions", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		})
+	}
+}
+
+// HasPermission sirve para los handlers que deciden el permiso segun el contenido del request.
+func HasPermission(ctx context.Context, userId string, permission string) (bool, error) {
+	permissions, err := repository.GetUserPermissions(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range permissions {
+		if p == permission {
+			return true, nil
 		}
 	}
+	return false, nil
 }
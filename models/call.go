@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// estados de una llamada; rejected, ended y missed son finales
+const (
+	CallRinging  = "ringing"
+	CallActive   = "active"
+	CallRejected = "rejected"
+	CallEnded    = "ended"
+	CallMissed   = "missed" // nadie contesto antes del timeout
+)
+
+// Call es una videollamada entre los dos participantes de una conversacion.
+// Cada lado queda atado a la conexion de websocket desde la que llamo o contesto,
+// la señalizacion solo se reenvia entre esas dos conexiones.
+type Call struct {
+	Id             string     `json:"id"`
+	ConversationId string     `json:"conversation_id"`
+	CallerId       string     `json:"caller_id"`
+	CalleeId       string     `json:"callee_id"`
+	CallerClient   string     `json:"-"`
+	CalleeClient   string     `json:"-"` // vacio hasta que se contesta
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AnsweredAt     *time.Time `json:"answered_at,omitempty"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	RingDeadline   *time.Time `json:"ring_deadline,omitempty"` // hasta cuando suena antes de darla por perdida
+}
+
+// RingExpired indica si la llamada sigue sonando despues de su hora limite.
+func (c *Call) RingExpired(now time.Time) bool {
+	return c.Status == CallRinging && c.RingDeadline != nil && !now.Before(*c.RingDeadline)
+}
+
+// HasParticipant indica si el usuario llamo o recibio la llamada.
+func (c *Call) HasParticipant(userId string) bool {
+	return userId != "" && (c.CallerId == userId || c.CalleeId == userId)
+}
+
+// PeerClient devuelve la conexion del otro lado de la llamada, vacio si clientId no esta en ella.
+func (c *Call) PeerClient(clientId string) string {
+	switch clientId {
+	case "":
+		return ""
+	case c.CallerClient:
+		return c.CalleeClient
+	case c.CalleeClient:
+		return c.CallerClient
+	}
+	return ""
+}
+
+// CallRequest es el payload de call_start (conversation_id) y de call_accept, call_reject y call_hangup (call_id).
+type CallRequest struct {
+	CallId         string `json:"call_id,omitempty"`
+	ConversationId string `json:"conversation_id,omitempty"`
+}
+
+// tipos de señalizacion de WebRTC que se reenvian
+const (
+	SignalOffer     = "offer"
+	SignalAnswer    = "answer"
+	SignalCandidate = "candidate"
+)
+
+// CallSignal lleva una oferta, respuesta o candidato ICE al otro lado; Data va tal cual la manda el navegador.
+type CallSignal struct {
+	CallId string          `json:"call_id"`
+	Kind   string          `json:"kind"`
+	Data   json.RawMessage `json:"data"`
+	From   string          `json:"from,omitempty"` // lo pone el servidor
+}
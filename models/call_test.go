@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCallRingExpired(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Second)
+	for _, test := range []struct {
+		call    Call
+		expired bool
+	}{
+		{Call{Status: CallRinging, RingDeadline: &past}, true},
+		{Call{Status: CallRinging, RingDeadline: &future}, false},
+		{Call{Status: CallRinging}, false},
+		{Call{Status: CallActive, RingDeadline: &past}, false},
+	} {
+		if expired := test.call.RingExpired(now); expired != test.expired {
+			t.Fatalf("%+v: expected expired=%t, got %t", test.call, test.expired, expired)
+		}
+	}
+}
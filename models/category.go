@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Category es un nodo de la taxonomia de productos; las categorias raiz no tienen ParentId.
+type Category struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	ParentId  string    `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
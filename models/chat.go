@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Conversation es el chat entre un cliente y el dueño de un producto, hay una por producto y cliente.
+type Conversation struct {
+	Id          string       `json:"id"`
+	ProductId   string       `json:"product_id"`
+	ProductName string       `json:"product_name"`
+	CustomerId  string       `json:"customer_id"`
+	MerchantId  string       `json:"merchant_id"` // products.user_id
+	CreatedAt   time.Time    `json:"created_at"`
+	LastMessage *ChatMessage `json:"last_message,omitempty"` // solo en el listado
+	Unread      int          `json:"unread"`                 // mensajes del otro sin leer, solo en el listado
+}
+
+// HasParticipant indica si el usuario es el cliente o el vendedor de la conversacion.
+func (c *Conversation) HasParticipant(userId string) bool {
+	return userId != "" && (c.CustomerId == userId || c.MerchantId == userId)
+}
+
+// OtherParticipant devuelve el otro usuario de la conversacion.
+func (c *Conversation) OtherParticipant(userId string) string {
+	if c.CustomerId == userId {
+		return c.MerchantId
+	}
+	return c.CustomerId
+}
+
+type ChatMessage struct {
+	Id             string     `json:"id"`
+	ConversationId string     `json:"conversation_id"`
+	SenderId       string     `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// ChatRequest es el payload de los mensajes de chat que envian los clientes por websocket.
+type ChatRequest struct {
+	ConversationId string `json:"conversation_id"`
+	Body           string `json:"body,omitempty"` // solo en chat_send
+}
+
+// ChatTyping avisa que un usuario esta escribiendo, no se guarda.
+type ChatTyping struct {
+	ConversationId string `json:"conversation_id"`
+	UserId         string `json:"user_id"`
+}
+
+// ChatReceipt avisa que el lector leyo los mensajes de la conversacion hasta ReadAt.
+type ChatReceipt struct {
+	ConversationId string    `json:"conversation_id"`
+	ReaderId       string    `json:"reader_id"`
+	ReadAt         time.Time `json:"read_at"`
+}
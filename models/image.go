@@ -14,5 +14,20 @@ type Image struct {
 type ImageLink struct {
 	ProductId string    `json:"product_id"`
 	ImageId   string    `json:"image_id"`
+	Position  int       `json:"position"`
+	Primary   bool      `json:"primary"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// ProductImage es una imagen del producto en su orden; la primaria es la url que se muestra en las listas.
+type ProductImage struct {
+	Id       string `json:"id"`
+	Url      string `json:"url"`
+	Position int    `json:"position"`
+	Primary  bool   `json:"primary"`
+}
+
+// ReorderImagesRequest trae todas las imagenes del producto en el orden nuevo.
+type ReorderImagesRequest struct {
+	ImageIds []string `json:"image_ids"`
+}
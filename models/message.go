@@ -1,6 +1,103 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// tipos de mensajes que se envian por websocket
+const (
+	MessageProductCreated     = "Product created"
+	MessageProductUpdated     = "Product updated"
+	MessageOrderStatusChanged = "Order status changed"
+
+	// chat: chat_typing y chat_read los envian los clientes y el servidor los reenvia al otro participante
+	MessageChatSend    = "chat_send"
+	MessageChatMessage = "chat_message"
+	MessageChatTyping  = "chat_typing"
+	MessageChatRead    = "chat_read"
+
+	// llamadas: los clientes envian call_start, call_accept, call_reject, call_hangup y call_signal
+	MessageCallStart    = "call_start"
+	MessageCallAccept   = "call_accept"
+	MessageCallReject   = "call_reject"
+	MessageCallHangup   = "call_hangup"
+	MessageCallSignal   = "call_signal"
+	MessageCallRinging  = "call_ringing" // al que llama, con la llamada creada
+	MessageCallRing     = "call_ring"    // a las conexiones del que recibe
+	MessageCallAccepted = "call_accepted"
+	MessageCallRejected = "call_rejected"
+	MessageCallEnded    = "call_ended"
+	MessageCallTimeout  = "call_timeout"
+
+	// el cliente avisa si esta activo o inactivo; los cambios de presencia se publican con el mismo tipo
+	MessagePresence = "presence"
+
+	// mensajes que envian los clientes
+	MessagePing        = "ping"
+	MessagePong        = "pong"
+	MessageSubscribe   = "subscribe"
+	MessageUnsubscribe = "unsubscribe"
+
+	// confirmaciones de subscribe / unsubscribe
+	MessageSubscribed   = "subscribed"
+	MessageUnsubscribed = "unsubscribed"
+
+	// respuesta a un mensaje que no se pudo procesar
+	MessageError = "error"
+
+	// los eventos perdidos ya no estan en el log, el cliente debe volver a cargar su estado
+	MessageResyncRequired = "resync_required"
+)
+
+// WebsocketMessage es cada frame que se envia por el websocket.
+// Seq solo viene en los eventos del hub (Publish y Broadcast), no en las respuestas a un cliente.
 type WebsocketMessage struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
+	Seq     int64       `json:"seq,omitempty"`
+}
+
+// HubEvent es un evento publicado por el hub. Se guardan los mas recientes para
+// repetirselos a un cliente que se reconecta con el ultimo seq que recibio.
+type HubEvent struct {
+	Seq       int64           `json:"seq"`
+	Topics    []string        `json:"topics"` // vacio es un Broadcast
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// topics a los que se puede suscribir un cliente del websocket
+const (
+	TopicProducts = "products"
+)
+
+// TopicRequest es el payload de subscribe, unsubscribe y sus confirmaciones.
+type TopicRequest struct {
+	Topic string `json:"topic"`
+}
+
+func ProductTopic(productId string) string {
+	return "product:" + productId
+}
+
+// UserTopic recibe todo lo que le concierne al usuario, cada conexion queda suscrita al suyo.
+func UserTopic(userId string) string {
+	return "user:" + userId
+}
+
+func OrderTopic(orderId string) string {
+	return "order:" + orderId
+}
+
+// PresenceTopic recibe los cambios de presencia del usuario, cualquiera se puede suscribir.
+func PresenceTopic(userId string) string {
+	return "presence:" + userId
+}
+
+// ClientTopic es el de una sola conexion, cada conexion queda suscrita al suyo.
+// Lo usa el servidor para hablarle a una conexion en cualquier instancia, nadie se puede suscribir.
+func ClientTopic(clientId string) string {
+	return "client:" + clientId
 }
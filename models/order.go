@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// estados posibles de una orden
+const (
+	OrderPending    = "pending"
+	OrderPaid       = "paid"
+	OrderProcessing = "processing"
+	OrderShipped    = "shipped"
+	OrderDelivered  = "delivered"
+	OrderCancelled  = "cancelled"
+	OrderRefunded   = "refunded"
+)
+
+// orderTransitions define a que estados puede pasar una orden desde su estado actual.
+// cancelled y refunded son estados finales.
+var orderTransitions = map[string][]string{
+	OrderPending:    {OrderPaid, OrderCancelled},
+	OrderPaid:       {OrderProcessing, OrderCancelled, OrderRefunded},
+	OrderProcessing: {OrderShipped, OrderCancelled, OrderRefunded},
+	OrderShipped:    {OrderDelivered, OrderRefunded},
+	OrderDelivered:  {OrderRefunded},
+	OrderCancelled:  {},
+	OrderRefunded:   {},
+}
+
+// IsOrderStatus indica si el estado existe.
+func IsOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransition indica si una orden puede pasar del estado from al estado to.
+func CanTransition(from string, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type Order struct {
+	Id        string       `json:"id"`
+	UserId    string       `json:"user_id"`
+	Total     float64      `json:"total"`
+	Status    string       `json:"status"`
+	Items     []*OrderItem `json:"items"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// OrderItem es una copia del producto al momento de la compra,
+// asi la orden no cambia si el producto se edita o elimina despues.
+type OrderItem struct {
+	Id        string  `json:"id"`
+	OrderId   string  `json:"order_id"`
+	ProductId string  `json:"product_id"`
+	VariantId string  `json:"variant_id,omitempty"`
+	Sku       string  `json:"sku,omitempty"`
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unit_price"`
+	Quantity  int     `json:"quantity"`
+}
+
+// StockShortage describe un producto (o una variante) del carrito que no tiene stock suficiente.
+type StockShortage struct {
+	ProductId string `json:"product_id"`
+	VariantId string `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// OrderStatusChange es un registro del historial de estados de una orden.
+type OrderStatusChange struct {
+	Id         string    `json:"id"`
+	OrderId    string    `json:"order_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorId    string    `json:"actor_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// limites del parametro limit de las listas paginadas
+const (
+	DefaultPageLimit = 34
+	MaxPageLimit     = 100
+)
+
+// Cursor es la posicion de una fila en el orden de la lista: el valor de la columna de orden (Key) y el id.
+// Con Before la pagina son las filas anteriores a la posicion; si no, las siguientes.
+type Cursor struct {
+	Sort   string `json:"s,omitempty"`
+	Key    string `json:"k"`
+	Id     string `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// Encode devuelve el cursor opaco que reciben los clientes.
+func (cursor Cursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor lee un cursor de Encode.
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// CheckKey verifica que Key tenga el formato de la columna por la que ordena Sort, asi un cursor
+// alterado no llega a la consulta: un numero con los precios, cualquier texto con el nombre
+// y una fecha RFC3339 con el resto (las listas sin sort ordenan por created_at).
+func (cursor *Cursor) CheckKey() error {
+	var err error
+	switch cursor.Sort {
+	case ProductSortPriceAsc, ProductSortPriceDesc:
+		_, err = strconv.ParseFloat(cursor.Key, 64)
+	case ProductSortName:
+	default:
+		_, err = time.Parse(time.RFC3339Nano, cursor.Key)
+	}
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	return nil
+}
+
+// PageRequest pide Limit filas desde Cursor (nil es la primera pagina); Limit 0 trae todas.
+type PageRequest struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// Page es una pagina de una lista; Total cuenta todas las filas de la lista, no solo las de la pagina.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Total int    `json:"total"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// estados de presencia de un usuario
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away" // todas sus conexiones avisaron que estan inactivas
+	PresenceOffline = "offline"
+)
+
+// Presence dice si el usuario esta conectado. LastSeen es desde cuando esta away u offline.
+type Presence struct {
+	UserId   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// PresenceRequest es el payload del mensaje presence que envia un cliente: online o away.
+type PresenceRequest struct {
+	Status string `json:"status"`
+}
@@ -9,18 +9,91 @@ type Product struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Price       float64   `json:"price"`
-	Stock       string    `json:"stock"`
+	Stock       int       `json:"stock"`
 	User_id     string    `json:"user_id"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
 type ProductList struct {
-	Id          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       string    `json:"stock"`
-	User_id     string    `json:"user_id"`
-	Url         string    `json:"url"`
-	CreatedAt   time.Time `json:"created_at"`
+	Id          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       float64         `json:"price"`
+	Stock       int             `json:"stock"`
+	User_id     string          `json:"user_id"`
+	Url         string          `json:"url"` // la imagen primaria o la imagen por defecto
+	Images      []*ProductImage `json:"images"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// orden de ListProduct; sin sort se listan del mas viejo al mas nuevo
+const (
+	ProductSortNewest    = "newest"
+	ProductSortPriceAsc  = "price_asc"
+	ProductSortPriceDesc = "price_desc"
+	ProductSortName      = "name"
+)
+
+// PriceBuckets son los limites de los rangos de precio de las facetas: [0, 25), [25, 50), ..., [200, ...).
+var PriceBuckets = []float64{25, 50, 100, 200}
+
+// ProductFilter son los filtros de ListProduct; los campos vacios no filtran.
+type ProductFilter struct {
+	MinPrice     *float64
+	MaxPrice     *float64
+	CategoryId   string // incluye las subcategorias
+	UserId       string
+	InStock      bool
+	CreatedAfter *time.Time
+	Sort         string
+}
+
+// ProductPage es la respuesta de GET /products.
+type ProductPage struct {
+	Page[*ProductList]
+	Facets ProductFacets `json:"facets"`
+}
+
+// ProductFacets cuenta los productos por categoria y por rango de precio.
+// Cada conteo usa todos los filtros menos el suyo, para que la barra lateral muestre las otras opciones.
+type ProductFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Prices     []PriceFacet    `json:"prices"`
+}
+
+// CategoryFacet cuenta los productos de la categoria y sus subcategorias.
+type CategoryFacet struct {
+	Id    string `json:"id"`
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PriceFacet cuenta los productos con min <= price < max; el ultimo rango no tiene max.
+type PriceFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// NewPriceFacets arma los rangos de PriceBuckets con los conteos en cero.
+func NewPriceFacets() []PriceFacet {
+	facets := make([]PriceFacet, 0, len(PriceBuckets)+1)
+	min := 0.0
+	for _, bucket := range PriceBuckets {
+		max := bucket
+		facets = append(facets, PriceFacet{Min: min, Max: &max})
+		min = bucket
+	}
+	return append(facets, PriceFacet{Min: min})
+}
+
+// PriceBucket devuelve el indice del rango de NewPriceFacets donde cae price.
+func PriceBucket(price float64) int {
+	for i, bucket := range PriceBuckets {
+		if price < bucket {
+			return i
+		}
+	}
+	return len(PriceBuckets)
 }
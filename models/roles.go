@@ -1,11 +1,51 @@
 package models
 
+import "time"
+
+// permisos que revisa el middleware, se crean en la migracion 0006_permissions
+const (
+	PermissionProductWrite = "product:write"
+	PermissionOrderRead    = "order:read"
+	PermissionOrderUpdate  = "order:update"
+	PermissionOrderRefund  = "order:refund"
+	PermissionRoleManage   = "role:manage"
+	// se crea en la migracion 0011_categories
+	PermissionCategoryManage = "category:manage"
+)
+
+// acciones que se guardan en grant_audit
+const (
+	GrantRoleAdded         = "role_granted"
+	GrantRoleRemoved       = "role_revoked"
+	GrantPermissionAdded   = "permission_granted"
+	GrantPermissionRemoved = "permission_revoked"
+)
+
 type Role struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type UserRole struct {
 	UserId string `json:"user_id"`
 	RoleId int    `json:"role_id"`
 }
+
+type Permission struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GrantAudit registra quien dio o quito un rol a un usuario, o un permiso a un rol.
+// UserId va vacio cuando el cambio es de permisos de un rol.
+type GrantAudit struct {
+	Id         string    `json:"id"`
+	ActorId    string    `json:"actor_id"`
+	Action     string    `json:"action"`
+	UserId     string    `json:"user_id,omitempty"`
+	Role       string    `json:"role"`
+	Permission string    `json:"permission,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
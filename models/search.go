@@ -0,0 +1,15 @@
+package models
+
+// ProductSearchResult es un producto encontrado por la busqueda con su relevancia.
+type ProductSearchResult struct {
+	ProductList
+	Rank      float64          `json:"rank"`
+	Highlight ProductHighlight `json:"highlight"`
+}
+
+// ProductHighlight trae el nombre y un fragmento de la descripcion con las palabras encontradas
+// entre <mark> y </mark>; el resto del texto va escapado como HTML.
+type ProductHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// RefreshToken es el registro de un refresh token emitido; el token en claro nunca se guarda.
+type RefreshToken struct {
+	Id        string     `json:"id"`
+	UserId    string     `json:"user_id"`
+	FamilyId  string     `json:"family_id"` // todos los tokens rotados desde el mismo login
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// propositos de los tokens que se envian por correo
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// UserToken es un token de un solo uso enviado por correo; igual que el refresh token solo se guarda el hash.
+type UserToken struct {
+	Id        string     `json:"id"`
+	UserId    string     `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -1,9 +1,12 @@
 package models
 
+import "time"
+
 type User struct {
-	Id       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Id              string     `json:"id"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 type Bussinessman struct {
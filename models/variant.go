@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ProductOption es un eje de variantes del producto, por ejemplo talla con sus valores S, M y L.
+type ProductOption struct {
+	Id        string   `json:"id"`
+	ProductId string   `json:"product_id"`
+	Name      string   `json:"name"`
+	Values    []string `json:"values"`
+	Position  int      `json:"position"`
+}
+
+// Variant es una combinacion de valores de las opciones del producto, con su propio SKU y stock.
+// Price nil usa el precio del producto.
+type Variant struct {
+	Id        string            `json:"id"`
+	ProductId string            `json:"product_id"`
+	Sku       string            `json:"sku"`
+	Price     *float64          `json:"price,omitempty"`
+	Stock     int               `json:"stock"`
+	Options   map[string]string `json:"options"` // nombre de la opcion -> valor
+	Images    []string          `json:"images"`  // urls
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// UnitPrice devuelve el precio de la variante, o el del producto si no lo cambia.
+func (v *Variant) UnitPrice(productPrice float64) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return productPrice
+}
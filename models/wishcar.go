@@ -10,10 +10,12 @@ type Car struct {
 }
 
 type CarItem struct {
-	Id        string `json:"id"`
-	CarId     string `json:"car_id"`
-	ProductId string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+	Id        string    `json:"id"`
+	CarId     string    `json:"car_id"`
+	ProductId string    `json:"product_id"`
+	VariantId string    `json:"variant_id,omitempty"` // vacio si el producto no tiene variantes
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func NewCar(id string, userId string, total float64) *Car {
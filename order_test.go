@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testCarItem struct {
+	ProductId string `json:"product_id"`
+	VariantId string `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// testWishcar es la pagina de GET /wishcar.
+type testWishcar struct {
+	Items []testCarItem `json:"items"`
+	Total int           `json:"total"`
+	Next  string        `json:"next"`
+}
+
+// placeOrder agrega los productos (id -> cantidad) al carrito y hace checkout; devuelve el id de la orden.
+func placeOrder(t *testing.T, ts *httptest.Server, token string, items map[string]int) string {
+	t.Helper()
+	for productId, quantity := range items {
+		if status := doJSON(t, ts, http.MethodPost, "/addItem/"+productId, token, map[string]int{"quantity": quantity}, nil); status != http.StatusOK {
+			t.Fatalf("add %s: status %d", productId, status)
+		}
+	}
+	var order struct {
+		Id string `json:"id"`
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", token, nil, &order); status != http.StatusCreated {
+		t.Fatalf("checkout: status %d", status)
+	}
+	return order.Id
+}
+
+func TestWishcarFlow(t *testing.T) {
+	ts := newTestServer(t)
+
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+	shirt := createProduct(t, ts, merchant, "T-shirt", 20, 5)
+	hat := createProduct(t, ts, merchant, "Hat", 10, 5)
+
+	for _, add := range []struct {
+		product  string
+		quantity int
+	}{{shirt, 2}, {hat, 1}, {shirt, 1}} {
+		status := doJSON(t, ts, http.MethodPost, "/addItem/"+add.product, customer, map[string]int{"quantity": add.quantity}, nil)
+		if status != http.StatusOK {
+			t.Fatalf("add item: status %d", status)
+		}
+	}
+
+	var items testWishcar
+	if status := doJSON(t, ts, http.MethodGet, "/wishcar", customer, nil, &items); status != http.StatusOK {
+		t.Fatalf("list wishcar: status %d", status)
+	}
+	quantities := map[string]int{}
+	for _, item := range items.Items {
+		quantities[item.ProductId] = item.Quantity
+	}
+	if len(items.Items) != 2 || items.Total != 2 || quantities[shirt] != 3 || quantities[hat] != 1 {
+		t.Fatalf("wishcar: unexpected items %+v", items)
+	}
+
+	// agregar un producto inexistente no debe dejar el carrito a medias
+	status := doJSON(t, ts, http.MethodPost, "/addItem/missing", customer, map[string]int{"quantity": 1}, nil)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("add missing product: expected 500, got %d", status)
+	}
+
+	if status := doJSON(t, ts, http.MethodDelete, "/wishcar/"+hat, customer, nil, nil); status != http.StatusOK {
+		t.Fatalf("remove item: status %d", status)
+	}
+
+	items = testWishcar{}
+	doJSON(t, ts, http.MethodGet, "/wishcar", customer, nil, &items)
+	if len(items.Items) != 1 || items.Items[0].ProductId != shirt {
+		t.Fatalf("wishcar after remove: unexpected items %+v", items)
+	}
+}
+
+func TestCheckoutReservesStock(t *testing.T) {
+	ts := newTestServer(t)
+
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+	shirt := createProduct(t, ts, merchant, "T-shirt", 20, 2)
+
+	doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]int{"quantity": 3}, nil)
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", customer, nil, nil); status != http.StatusConflict {
+		t.Fatalf("checkout without stock: expected 409, got %d", status)
+	}
+
+	doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]int{"quantity": -1}, nil)
+
+	var order struct {
+		Id     string  `json:"id"`
+		Total  float64 `json:"total"`
+		Status string  `json:"status"`
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", customer, nil, &order); status != http.StatusCreated {
+		t.Fatalf("checkout: expected 201, got %d", status)
+	}
+	if order.Total != 40 || order.Status != "pending" {
+		t.Fatalf("checkout: unexpected order %+v", order)
+	}
+
+	var product struct {
+		Stock int `json:"stock"`
+	}
+	doJSON(t, ts, http.MethodGet, "/products/"+shirt, merchant, nil, &product)
+	if product.Stock != 0 {
+		t.Fatalf("stock after checkout: expected 0, got %d", product.Stock)
+	}
+
+	var items testWishcar
+	doJSON(t, ts, http.MethodGet, "/wishcar", customer, nil, &items)
+	if len(items.Items) != 0 {
+		t.Fatalf("wishcar after checkout: expected empty, got %+v", items)
+	}
+
+	var orders []map[string]interface{}
+	doJSON(t, ts, http.MethodGet, "/orders", customer, nil, &orders)
+	if len(orders) != 1 || orders[0]["id"] != order.Id {
+		t.Fatalf("orders: unexpected %+v", orders)
+	}
+}
+
+func TestMerchantCannotTouchOrders(t *testing.T) {
+	ts := newTestServer(t)
+	owner := signUpMerchant(t, ts, "shop@store.com", "secret")
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+
+	orderId := placeOrder(t, ts, customer, map[string]int{createProduct(t, ts, owner, "Mouse", 20, 5): 1})
+
+	// ni siquiera el merchant del producto puede leer o mover la orden de otro usuario
+	for _, token := range []string{other, owner} {
+		if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", token, map[string]string{"status": "cancelled"}, nil); status != http.StatusForbidden {
+			t.Fatalf("merchant cancels order: expected 403, got %d", status)
+		}
+		// la historia de una orden ajena se responde como si no existiera
+		if status := doJSON(t, ts, http.MethodGet, "/orders/"+orderId+"/history", token, nil, nil); status != http.StatusNotFound {
+			t.Fatalf("merchant reads history: expected 404, got %d", status)
+		}
+
+		conn, _ := dialWebSocket(t, ts, token)
+		if err := conn.WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": "order:" + orderId}}); err != nil {
+			t.Fatal(err)
+		}
+		if message := readWebSocket(t, conn); message.Type != "error" {
+			t.Fatalf("merchant subscribes to order: expected error, got %+v", message)
+		}
+	}
+}
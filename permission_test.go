@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRoutePolicies(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "admin@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+	createProduct(t, ts, merchant, "Mouse", 20, 5)
+
+	// rutas publicas no piden token
+	if status := doJSON(t, ts, http.MethodGet, "/products", "", nil, nil); status != http.StatusOK {
+		t.Fatalf("public route: status %d", status)
+	}
+
+	// rutas autenticadas rechazan requests sin token o con un token invalido
+	for _, path := range []string{"/me", "/wishcar", "/orders", "/getUserRoles"} {
+		if status := doJSON(t, ts, http.MethodGet, path, "", nil, nil); status != http.StatusUnauthorized {
+			t.Fatalf("%s without token: expected 401, got %d", path, status)
+		}
+		if status := doJSON(t, ts, http.MethodGet, path, "not-a-token", nil, nil); status != http.StatusUnauthorized {
+			t.Fatalf("%s with invalid token: expected 401, got %d", path, status)
+		}
+	}
+	if status := doJSON(t, ts, http.MethodDelete, "/wishcar/some-product", "", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("remove item without token: expected 401, got %d", status)
+	}
+
+	// rutas con permisos piden el permiso ademas del token
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	if status := doJSON(t, ts, http.MethodGet, "/listRoles", "", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("role:manage route without token: expected 401, got %d", status)
+	}
+	for _, token := range []string{customer, merchant} {
+		if status := doJSON(t, ts, http.MethodGet, "/listRoles", token, nil, nil); status != http.StatusForbidden {
+			t.Fatalf("role:manage route without permission: expected 403, got %d", status)
+		}
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/listRoles", admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("role:manage route as admin: status %d", status)
+	}
+}
+
+func TestRolesAndPermissions(t *testing.T) {
+	ts := newTestServer(t)
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+
+	var me struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", customer, nil, &me)
+
+	// nadie se puede dar roles a si mismo
+	if status := doJSON(t, ts, http.MethodPost, "/users/"+me.Id+"/roles", customer, map[string]string{"name": "admin"}, nil); status != http.StatusForbidden {
+		t.Fatalf("self grant: expected 403, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/setRole", customer, map[string]string{"name": "admin"}, nil); status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		t.Fatalf("setRole should be gone, got %d", status)
+	}
+
+	// un merchant maneja productos pero no mueve ordenes
+	orderId := placeOrder(t, ts, customer, map[string]int{createProduct(t, ts, merchant, "Mouse", 20, 5): 1})
+	if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", merchant, map[string]string{"status": "paid"}, nil); status != http.StatusForbidden {
+		t.Fatalf("merchant pays order: expected 403, got %d", status)
+	}
+
+	// con order:update el merchant mueve la orden, pero sigue sin reembolsar
+	if status := doJSON(t, ts, http.MethodPost, "/roles/merchant/permissions", admin, map[string]string{"name": "order:update"}, nil); status != http.StatusOK {
+		t.Fatalf("grant order:update: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", merchant, map[string]string{"status": "paid"}, nil); status != http.StatusOK {
+		t.Fatalf("merchant pays order: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", merchant, map[string]string{"status": "refunded"}, nil); status != http.StatusForbidden {
+		t.Fatalf("merchant refund: expected 403, got %d", status)
+	}
+
+	// el admin le da order:refund al rol merchant
+	if status := doJSON(t, ts, http.MethodPost, "/roles/merchant/permissions", admin, map[string]string{"name": "order:refund"}, nil); status != http.StatusOK {
+		t.Fatalf("grant permission: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", merchant, map[string]string{"status": "refunded"}, nil); status != http.StatusOK {
+		t.Fatalf("merchant refund after grant: status %d", status)
+	}
+
+	// el admin le asigna y le quita un rol a otro usuario
+	if status := doJSON(t, ts, http.MethodPost, "/users/"+me.Id+"/roles", admin, map[string]string{"name": "merchant"}, nil); status != http.StatusCreated {
+		t.Fatalf("grant role: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/users/"+me.Id+"/roles", admin, map[string]string{"name": "merchant"}, nil); status != http.StatusConflict {
+		t.Fatalf("grant role twice: expected 409, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/users/"+me.Id+"/roles", admin, map[string]string{"name": "owner"}, nil); status != http.StatusNotFound {
+		t.Fatalf("grant unknown role: expected 404, got %d", status)
+	}
+	var roles []string
+	doJSON(t, ts, http.MethodGet, "/users/"+me.Id+"/roles", admin, nil, &roles)
+	if len(roles) != 1 || roles[0] != "merchant" {
+		t.Fatalf("user roles: %v", roles)
+	}
+	if status := doJSON(t, ts, http.MethodDelete, "/users/"+me.Id+"/roles/merchant", admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("revoke role: status %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/products", customer, map[string]interface{}{"name": "x", "price": 1, "stock": 1}, nil); status != http.StatusForbidden {
+		t.Fatalf("create product after revoke: expected 403, got %d", status)
+	}
+
+	// cada cambio queda auditado, el mas reciente primero
+	var audit []struct {
+		ActorId    string `json:"actor_id"`
+		Action     string `json:"action"`
+		UserId     string `json:"user_id"`
+		Role       string `json:"role"`
+		Permission string `json:"permission"`
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/audit/grants", admin, nil, &audit); status != http.StatusOK {
+		t.Fatalf("audit: status %d", status)
+	}
+	if len(audit) != 5 {
+		t.Fatalf("audit: expected 5 entries, got %+v", audit)
+	}
+	if audit[0].Action != "role_revoked" || audit[0].UserId != me.Id || audit[0].Role != "merchant" {
+		t.Fatalf("audit: unexpected latest entry %+v", audit[0])
+	}
+	if audit[2].Action != "permission_granted" || audit[2].Permission != "order:refund" || audit[2].UserId != "" {
+		t.Fatalf("audit: unexpected permission entry %+v", audit[2])
+	}
+}
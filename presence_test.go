@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+
+	var me struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", merchant, nil, &me)
+
+	type presence struct {
+		UserId   string     `json:"user_id"`
+		Status   string     `json:"status"`
+		LastSeen *time.Time `json:"last_seen"`
+	}
+	var current presence
+	if status := doJSON(t, ts, http.MethodGet, "/users/"+me.Id+"/presence", ana, nil, &current); status != http.StatusOK || current.Status != "offline" || current.LastSeen != nil {
+		t.Fatalf("presence before connecting: %d %+v", status, current)
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/users/missing/presence", ana, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("presence of an unknown user: expected 404, got %d", status)
+	}
+
+	// cualquiera puede seguir la presencia de otro usuario
+	watcher, status := dialWebSocket(t, ts, ana, "&topics=presence:"+me.Id)
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("subscribe to presence: %d", status)
+	}
+	expectPresence := func(status string) presence {
+		t.Helper()
+		var change presence
+		json.Unmarshal(expectWebSocket(t, "presence", watcher).Payload, &change)
+		if change.UserId != me.Id || change.Status != status {
+			t.Fatalf("expected %s, got %+v", status, change)
+		}
+		return change
+	}
+
+	// ana no es contacto del merchant: sigue su presencia pero no su topic privado
+	sendWebSocket(t, watcher, "subscribe", map[string]string{"topic": "user:" + me.Id})
+	if message := readWebSocket(t, watcher); message.Type != "error" {
+		t.Fatalf("subscribe to someone else's user topic: expected error, got %+v", message)
+	}
+
+	// con dos pestañas abiertas solo la primera cambia el estado
+	first, _ := dialWebSocket(t, ts, merchant)
+	expectPresence("online")
+	second, _ := dialWebSocket(t, ts, merchant)
+
+	// away solo cuando todas las conexiones lo estan
+	sendWebSocket(t, first, "presence", map[string]string{"status": "away"})
+	sendWebSocket(t, second, "presence", map[string]string{"status": "away"})
+	if away := expectPresence("away"); away.LastSeen == nil {
+		t.Fatal("away without last_seen")
+	}
+	sendWebSocket(t, second, "presence", map[string]string{"status": "online"})
+	expectPresence("online")
+
+	// first vuelve a estar activo, el error confirma que ya se proceso su mensaje anterior
+	sendWebSocket(t, first, "presence", map[string]string{"status": "online"})
+	sendWebSocket(t, first, "presence", map[string]string{"status": "busy"})
+	if message := readWebSocket(t, first); message.Type != "error" {
+		t.Fatalf("invalid presence status: expected error, got %+v", message)
+	}
+
+	first.Close()
+	second.Close()
+	offline := expectPresence("offline")
+	if offline.LastSeen == nil {
+		t.Fatal("offline without last_seen")
+	}
+
+	if status := doJSON(t, ts, http.MethodGet, "/users/"+me.Id+"/presence", ana, nil, &current); status != http.StatusOK || current.Status != "offline" || current.LastSeen == nil || !current.LastSeen.Equal(*offline.LastSeen) {
+		t.Fatalf("presence after disconnecting: %d %+v", status, current)
+	}
+}
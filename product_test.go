@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/kevintovar01/Store/server"
+)
+
+func TestProductCRUD(t *testing.T) {
+	ts := newTestServer(t)
+
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+
+	status := doJSON(t, ts, http.MethodPost, "/products", customer, map[string]interface{}{"name": "Hat", "price": 10, "stock": 1}, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("customer creating product: expected 403, got %d", status)
+	}
+
+	id := createProduct(t, ts, merchant, "T-shirt", 25.5, 10)
+
+	var product struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+		Stock int     `json:"stock"`
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/products/"+id, merchant, nil, &product); status != http.StatusOK {
+		t.Fatalf("get product: status %d", status)
+	}
+	if product.Name != "T-shirt" || product.Price != 25.5 || product.Stock != 10 {
+		t.Fatalf("get product: unexpected %+v", product)
+	}
+
+	status = doJSON(t, ts, http.MethodPut, "/products/"+id, merchant, map[string]interface{}{
+		"name":  "T-shirt v2",
+		"price": 30,
+		"stock": 8,
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("update product: status %d", status)
+	}
+
+	doJSON(t, ts, http.MethodGet, "/products/"+id, merchant, nil, &product)
+	if product.Name != "T-shirt v2" || product.Price != 30 || product.Stock != 8 {
+		t.Fatalf("updated product: unexpected %+v", product)
+	}
+
+	status = doJSON(t, ts, http.MethodPut, "/products/"+id, merchant, map[string]interface{}{"name": "x", "stock": -1}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("negative stock: expected 400, got %d", status)
+	}
+
+	var list struct {
+		Products []map[string]interface{} `json:"items"`
+	}
+	if status := doJSON(t, ts, http.MethodGet, "/products", "", nil, &list); status != http.StatusOK {
+		t.Fatalf("list products: status %d", status)
+	}
+	if len(list.Products) != 1 {
+		t.Fatalf("list products: expected 1 product, got %d", len(list.Products))
+	}
+
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+id, merchant, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete product: status %d", status)
+	}
+
+	list.Products = nil
+	doJSON(t, ts, http.MethodGet, "/products", "", nil, &list)
+	if len(list.Products) != 0 {
+		t.Fatalf("list after delete: expected 0 products, got %d", len(list.Products))
+	}
+}
+
+func TestProductSearch(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+
+	insert := func(name string, description string) string {
+		var product struct {
+			Id string `json:"id"`
+		}
+		status := doJSON(t, ts, http.MethodPost, "/products", merchant, map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"price":       10,
+			"stock":       1,
+		}, &product)
+		if status != http.StatusOK {
+			t.Fatalf("insert %s: status %d", name, status)
+		}
+		return product.Id
+	}
+	shirt := insert("Camiseta roja", "Algodon <b>suave</b>")
+	pants := insert("Pantalon", "Combina con una camiseta")
+	insert("Zapatos", "Cuero")
+
+	type result struct {
+		Id        string  `json:"id"`
+		Rank      float64 `json:"rank"`
+		Highlight struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"highlight"`
+	}
+	search := func(query string) []result {
+		var results []result
+		if status := doJSON(t, ts, http.MethodGet, "/products/search?q="+url.QueryEscape(query), "", nil, &results); status != http.StatusOK {
+			t.Fatalf("search %q: status %d", query, status)
+		}
+		return results
+	}
+
+	// el nombre pesa mas que la descripcion
+	results := search("camiseta")
+	if len(results) != 2 || results[0].Id != shirt || results[1].Id != pants || results[0].Rank <= results[1].Rank {
+		t.Fatalf("camiseta: %+v", results)
+	}
+	if results[0].Highlight.Name != "<mark>Camiseta</mark> roja" {
+		t.Fatalf("name highlight: %q", results[0].Highlight.Name)
+	}
+
+	// errores de tipeo
+	results = search("camiseat")
+	if len(results) == 0 || results[0].Id != shirt {
+		t.Fatalf("camiseat: %+v", results)
+	}
+
+	// el texto fuera de <mark> va escapado
+	results = search("suave")
+	if len(results) != 1 || results[0].Highlight.Description != "Algodon &lt;b&gt;<mark>suave</mark>&lt;/b&gt;" {
+		t.Fatalf("suave: %+v", results)
+	}
+
+	if results := search("televisor"); len(results) != 0 {
+		t.Fatalf("televisor: %+v", results)
+	}
+
+	// al actualizar el producto cambia lo que se encuentra
+	status := doJSON(t, ts, http.MethodPut, "/products/"+pants, merchant, map[string]interface{}{
+		"name": "Pantalon", "description": "Tela de jean", "price": 10, "stock": 1,
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("update: status %d", status)
+	}
+	if results := search("camiseta"); len(results) != 1 || results[0].Id != shirt {
+		t.Fatalf("camiseta after update: %+v", results)
+	}
+
+	if status := doJSON(t, ts, http.MethodGet, "/products/search?q=", "", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("empty query: status %d", status)
+	}
+}
+
+func TestProductFilters(t *testing.T) {
+	ts := newTestServer(t)
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+
+	var clothes struct {
+		Id string `json:"id"`
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": "Ropa"}, &clothes); status != http.StatusCreated {
+		t.Fatalf("create category: %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/categories", admin, map[string]string{"name": "Polos", "parent_id": clothes.Id}, nil); status != http.StatusCreated {
+		t.Fatalf("create subcategory: %d", status)
+	}
+
+	polo := createProduct(t, ts, merchant, "Polo", 15, 5)
+	shirt := createProduct(t, ts, merchant, "Camisa", 40, 0)
+	shoe := createProduct(t, ts, merchant, "Zapato", 120, 3)
+	hat := createProduct(t, ts, other, "Gorra", 30, 2)
+	for productId, slug := range map[string]string{polo: "polos", shirt: "ropa"} {
+		if status := doJSON(t, ts, http.MethodPut, "/products/"+productId+"/categories", merchant, map[string][]string{"categories": {slug}}, nil); status != http.StatusOK {
+			t.Fatalf("set categories: status %d", status)
+		}
+	}
+
+	type page struct {
+		Products []struct {
+			Id        string `json:"id"`
+			UserId    string `json:"user_id"`
+			CreatedAt string `json:"created_at"`
+		} `json:"items"`
+		Facets struct {
+			Categories []struct {
+				Slug  string `json:"slug"`
+				Count int    `json:"count"`
+			} `json:"categories"`
+			Prices []struct {
+				Min   float64  `json:"min"`
+				Max   *float64 `json:"max"`
+				Count int      `json:"count"`
+			} `json:"prices"`
+		} `json:"facets"`
+	}
+	list := func(query string) page {
+		t.Helper()
+		var result page
+		if status := doJSON(t, ts, http.MethodGet, "/products?"+query, "", nil, &result); status != http.StatusOK {
+			t.Fatalf("list %q: status %d", query, status)
+		}
+		return result
+	}
+	expectIds := func(query string, ids ...string) page {
+		t.Helper()
+		result := list(query)
+		var got []string
+		for _, product := range result.Products {
+			got = append(got, product.Id)
+		}
+		if strings.Join(got, ",") != strings.Join(ids, ",") {
+			t.Fatalf("list %q: expected %v, got %v", query, ids, got)
+		}
+		return result
+	}
+
+	all := expectIds("", polo, shirt, shoe, hat)
+	expectIds("sort=price_asc", polo, hat, shirt, shoe)
+	expectIds("sort=price_desc", shoe, shirt, hat, polo)
+	expectIds("sort=name", shirt, hat, polo, shoe)
+	expectIds("sort=newest", hat, shoe, shirt, polo)
+	expectIds("in_stock=true", polo, shoe, hat)
+	expectIds("user_id="+all.Products[3].UserId, hat)
+	// la categoria incluye sus subcategorias
+	expectIds("category=ropa", polo, shirt)
+	expectIds("category=polos", polo)
+	expectIds("created_after="+url.QueryEscape(all.Products[0].CreatedAt), shirt, shoe, hat)
+
+	// los precios se cuentan sin el filtro de precio y las categorias con el
+	filtered := expectIds("min_price=20&max_price=50", shirt, hat)
+	if len(filtered.Facets.Categories) != 1 || filtered.Facets.Categories[0].Slug != "ropa" || filtered.Facets.Categories[0].Count != 1 {
+		t.Fatalf("category facets: %+v", filtered.Facets.Categories)
+	}
+	var counts []int
+	for _, bucket := range filtered.Facets.Prices {
+		counts = append(counts, bucket.Count)
+	}
+	if fmt.Sprint(counts) != "[1 2 0 1 0]" || filtered.Facets.Prices[4].Max != nil || filtered.Facets.Prices[1].Min != 25 {
+		t.Fatalf("price facets: %+v", filtered.Facets.Prices)
+	}
+
+	// sin filtro de categoria Ropa cuenta tambien los Polos
+	stocked := list("in_stock=true&category=polos")
+	if fmt.Sprint(stocked.Facets.Categories) != "[{polos 1} {ropa 1}]" {
+		t.Fatalf("in stock category facets: %+v", stocked.Facets.Categories)
+	}
+	if fmt.Sprint(all.Facets.Categories) != "[{polos 1} {ropa 2}]" {
+		t.Fatalf("category facets: %+v", all.Facets.Categories)
+	}
+
+	for _, query := range []string{"sort=cheap", "min_price=-1", "min_price=50&max_price=20", "category=missing", "in_stock=maybe", "created_after=ayer"} {
+		if status := doJSON(t, ts, http.MethodGet, "/products?"+query, "", nil, nil); status != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, status)
+		}
+	}
+
+	// un producto sin stock propio cuenta como disponible si alguna de sus variantes tiene unidades
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", merchant, map[string]interface{}{"name": "size", "values": []string{"S", "M"}}, nil); status != http.StatusCreated {
+		t.Fatalf("create option: %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/variants", merchant, map[string]interface{}{"sku": "CA-S", "stock": 0, "options": map[string]string{"size": "S"}}, nil); status != http.StatusCreated {
+		t.Fatalf("create variant: %d", status)
+	}
+	expectIds("in_stock=true", polo, shoe, hat)
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/variants", merchant, map[string]interface{}{"sku": "CA-M", "stock": 4, "options": map[string]string{"size": "M"}}, nil); status != http.StatusCreated {
+		t.Fatalf("create variant: %d", status)
+	}
+	expectIds("in_stock=true", polo, shirt, shoe, hat)
+}
+
+func TestCursorPagination(t *testing.T) {
+	ts := newTestServer(t)
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+
+	var ids []string
+	for i, price := range []float64{30, 10, 50, 20, 40} {
+		ids = append(ids, createProduct(t, ts, merchant, fmt.Sprintf("Producto %d", i), price, 1))
+	}
+
+	type page struct {
+		Items []struct {
+			Id interface{} `json:"id"` // los roles tienen id numerico
+		} `json:"items"`
+		Total int    `json:"total"`
+		Next  string `json:"next"`
+		Prev  string `json:"prev"`
+	}
+	// get sigue una url relativa, como las de los headers Link
+	get := func(path string, token string) (page, map[string]string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, res.StatusCode)
+		}
+		var result page
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		links := map[string]string{}
+		for _, link := range res.Header.Values("Link") {
+			match := regexp.MustCompile(`^<([^>]+)>; rel="(\w+)"$`).FindStringSubmatch(link)
+			if match == nil {
+				t.Fatalf("malformed Link %q", link)
+			}
+			links[match[2]] = match[1]
+		}
+		return result, links
+	}
+	expectIds := func(result page, total int, expected ...string) {
+		t.Helper()
+		var got []string
+		for _, item := range result.Items {
+			got = append(got, fmt.Sprint(item.Id))
+		}
+		if strings.Join(got, ",") != strings.Join(expected, ",") || result.Total != total {
+			t.Fatalf("expected %v of %d, got %v of %d", expected, total, got, result.Total)
+		}
+	}
+
+	first, links := get("/products?limit=2", "")
+	expectIds(first, 5, ids[0], ids[1])
+	if first.Prev != "" || links["prev"] != "" || links["next"] != "/products?cursor="+first.Next+"&limit=2" {
+		t.Fatalf("first page links: %+v %+v", first, links)
+	}
+
+	// un producto nuevo no corre las paginas siguientes
+	ids = append(ids, createProduct(t, ts, merchant, "Producto 5", 60, 1))
+	second, links := get(links["next"], "")
+	expectIds(second, 6, ids[2], ids[3])
+	third, links := get(links["next"], "")
+	expectIds(third, 6, ids[4], ids[5])
+	if third.Next != "" || links["next"] != "" {
+		t.Fatalf("last page has next: %+v", links)
+	}
+
+	back, links := get(links["prev"], "")
+	expectIds(back, 6, ids[2], ids[3])
+	back, links = get(links["prev"], "")
+	expectIds(back, 6, ids[0], ids[1])
+	if back.Prev != "" || links["next"] == "" {
+		t.Fatalf("back to first page: %+v %+v", back, links)
+	}
+
+	// el cursor sigue el sort y los filtros quedan en los links
+	byPrice, links := get("/products?sort=price_desc&limit=4&max_price=50", "")
+	expectIds(byPrice, 5, ids[2], ids[4], ids[0], ids[3])
+	byPrice, _ = get(links["next"], "")
+	expectIds(byPrice, 5, ids[1])
+
+	for _, query := range []string{"limit=0", "limit=101", "cursor=garbage", "sort=name&cursor=" + first.Next} {
+		if status := doJSON(t, ts, http.MethodGet, "/products?"+query, "", nil, nil); status != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, status)
+		}
+	}
+
+	for _, id := range ids[:3] {
+		doJSON(t, ts, http.MethodPost, "/addItem/"+id, customer, map[string]int{"quantity": 1}, nil)
+	}
+	items, links := get("/wishcar?limit=2", customer)
+	if len(items.Items) != 2 || items.Total != 3 {
+		t.Fatalf("wishcar page: %+v", items)
+	}
+	items, _ = get(links["next"], customer)
+	if len(items.Items) != 1 || items.Next != "" || items.Prev == "" {
+		t.Fatalf("wishcar last page: %+v", items)
+	}
+
+	roles, links := get("/listRoles?limit=1", admin)
+	if len(roles.Items) != 1 || roles.Total != 2 || links["next"] == "" {
+		t.Fatalf("roles page: %+v %+v", roles, links)
+	}
+
+	// un cursor alterado no llega a la consulta
+	forged := models.Cursor{Key: time.Now().Format(time.RFC3339Nano), Id: "uno"}.Encode()
+	if status := doJSON(t, ts, http.MethodGet, "/listRoles?cursor="+forged, admin, nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("role cursor with a text id: expected 400, got %d", status)
+	}
+	forged = models.Cursor{Sort: models.ProductSortPriceAsc, Key: "barato", Id: "x"}.Encode()
+	if status := doJSON(t, ts, http.MethodGet, "/products?sort=price_asc&cursor="+forged, "", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("price cursor with a text key: expected 400, got %d", status)
+	}
+}
+
+// uploadProductImage sube un archivo como el campo "image" de un form a /image/{productId}.
+func uploadProductImage(t *testing.T, ts *httptest.Server, token string, productId string, filename string) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("image " + filename))
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/image/"+productId, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestProductImages(t *testing.T) {
+	uploads := t.TempDir()
+	ts := newTestServer(t, func(config *server.Config) { config.UploadsDir = uploads })
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+	shirt := createProduct(t, ts, merchant, "Camiseta", 20, 5)
+	hat := createProduct(t, ts, merchant, "Gorra", 10, 5)
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if status := uploadProductImage(t, ts, merchant, shirt, name); status != http.StatusOK {
+			t.Fatalf("upload %s: status %d", name, status)
+		}
+	}
+	if status := uploadProductImage(t, ts, other, shirt, "d.jpg"); status != http.StatusForbidden {
+		t.Fatalf("upload to another merchant's product: expected 403, got %d", status)
+	}
+
+	type image struct {
+		Id       string `json:"id"`
+		Url      string `json:"url"`
+		Position int    `json:"position"`
+		Primary  bool   `json:"primary"`
+	}
+	// expectImages revisa el orden por nombre de archivo y cual es la primaria
+	expectImages := func(images []image, primary string, names ...string) map[string]image {
+		t.Helper()
+		byName := map[string]image{}
+		var got []string
+		for i, image := range images {
+			name := image.Url[strings.LastIndex(image.Url, "/")+1:]
+			got = append(got, name)
+			byName[name] = image
+			if image.Position != i || image.Primary != (name == primary) {
+				t.Fatalf("image %s: %+v", name, image)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(names, ",") {
+			t.Fatalf("expected %v, got %v", names, got)
+		}
+		return byName
+	}
+
+	var images []image
+	if status := doJSON(t, ts, http.MethodGet, "/products/"+shirt+"/images", "", nil, &images); status != http.StatusOK {
+		t.Fatalf("list images: status %d", status)
+	}
+	byName := expectImages(images, "a.jpg", "a.jpg", "b.jpg", "c.jpg")
+
+	var detail struct {
+		Url    string  `json:"url"`
+		Images []image `json:"images"`
+	}
+	doJSON(t, ts, http.MethodGet, "/products/"+shirt, merchant, nil, &detail)
+	if detail.Url != byName["a.jpg"].Url || len(detail.Images) != 3 {
+		t.Fatalf("product detail: %+v", detail)
+	}
+	var list struct {
+		Items []struct {
+			Id     string  `json:"id"`
+			Url    string  `json:"url"`
+			Images []image `json:"images"`
+		} `json:"items"`
+	}
+	doJSON(t, ts, http.MethodGet, "/products", "", nil, &list)
+	if list.Items[0].Url != byName["a.jpg"].Url || len(list.Items[0].Images) != 3 || list.Items[1].Url != "/uploads/default/product.jpg" || len(list.Items[1].Images) != 0 {
+		t.Fatalf("product list: %+v", list.Items)
+	}
+
+	// reordenar pide todas las imagenes del producto
+	order := []string{byName["c.jpg"].Id, byName["a.jpg"].Id, byName["b.jpg"].Id}
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/images", merchant, map[string][]string{"image_ids": order}, &images); status != http.StatusOK {
+		t.Fatalf("reorder: status %d", status)
+	}
+	expectImages(images, "a.jpg", "c.jpg", "a.jpg", "b.jpg")
+	for _, ids := range [][]string{order[:2], {order[0], order[1], order[1]}, {order[0], order[1], "missing"}} {
+		if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/images", merchant, map[string][]string{"image_ids": ids}, nil); status != http.StatusBadRequest {
+			t.Fatalf("reorder %v: expected 400, got %d", ids, status)
+		}
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/images", other, map[string][]string{"image_ids": order}, nil); status != http.StatusForbidden {
+		t.Fatalf("reorder as other: expected 403, got %d", status)
+	}
+
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/images/"+byName["b.jpg"].Id+"/primary", merchant, nil, &images); status != http.StatusOK {
+		t.Fatalf("set primary: status %d", status)
+	}
+	expectImages(images, "b.jpg", "c.jpg", "a.jpg", "b.jpg")
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+hat+"/images/"+byName["b.jpg"].Id+"/primary", merchant, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("primary of another product's image: expected 404, got %d", status)
+	}
+
+	// la gorra sube otro a.jpg el mismo dia: las dos imagenes comparten el archivo
+	if status := uploadProductImage(t, ts, merchant, hat, "a.jpg"); status != http.StatusOK {
+		t.Fatalf("upload to hat: status %d", status)
+	}
+	file := func(name string) string {
+		return filepath.Join(uploads, filepath.FromSlash(strings.TrimPrefix(byName[name].Url, "/uploads/")))
+	}
+
+	// al quitar la primaria pasa a serlo la primera que queda y se borra su archivo
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+shirt+"/images/"+byName["b.jpg"].Id, merchant, nil, &images); status != http.StatusOK {
+		t.Fatalf("delete image: status %d", status)
+	}
+	expectImages(images, "c.jpg", "c.jpg", "a.jpg")
+	if _, err := os.Stat(file("b.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("b.jpg should be removed: %v", err)
+	}
+
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+shirt+"/images/"+byName["a.jpg"].Id, merchant, nil, &images); status != http.StatusOK {
+		t.Fatalf("delete shared image: status %d", status)
+	}
+	expectImages(images, "c.jpg", "c.jpg")
+	res, err := http.Get(ts.URL + byName["a.jpg"].Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("shared file should still be served: status %d", res.StatusCode)
+	}
+
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+shirt+"/images/"+byName["a.jpg"].Id, merchant, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("delete unlinked image: expected 404, got %d", status)
+	}
+}
@@ -2,24 +2,100 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/kevintovar01/Store/models"
 )
 
+var (
+	// ErrOrderStatusConflict indica que la orden ya no estaba en el estado esperado al cambiarlo.
+	ErrOrderStatusConflict = errors.New("order status changed concurrently")
+
+	// ErrCallStatusConflict indica que la llamada ya no estaba en el estado esperado al cambiarlo.
+	ErrCallStatusConflict = errors.New("call status changed concurrently")
+
+	// ErrRefreshTokenRevoked indica que el refresh token ya habia sido usado o revocado.
+	ErrRefreshTokenRevoked = errors.New("refresh token already revoked")
+)
+
+// OutOfStockError se devuelve cuando al reservar el stock de una orden
+// uno o mas productos no tienen unidades suficientes.
+type OutOfStockError struct {
+	Items []models.StockShortage
+}
+
+func (e *OutOfStockError) Error() string {
+	names := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		names = append(names, item.Name)
+	}
+	return "out of stock: " + strings.Join(names, ", ")
+}
+
 type Repository interface {
 	// Crud for User
 	InsertUser(ctx context.Context, user *models.User) error
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 
+	// tokens
+	InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id string) error
+	RevokeRefreshFamily(ctx context.Context, familyId string) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserRefreshTokens(ctx context.Context, userId string) error
+
+	// tokens enviados por correo
+	InsertUserToken(ctx context.Context, token *models.UserToken) error
+	UseUserToken(ctx context.Context, tokenHash string, purpose string) (*models.UserToken, error)
+	UpdatePassword(ctx context.Context, userId string, password string) error
+	SetEmailVerified(ctx context.Context, userId string) error
+
+	// presencia
+	SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error
+	GetLastSeen(ctx context.Context, userId string) (*time.Time, error)
+
 	// Crud for product
 	InsertProduct(ctx context.Context, product *models.Product) error
 	GetProductById(ctx context.Context, id string) (*models.ProductList, error)
 	UpdateProduct(ctx context.Context, product *models.Product) error
 	DeleteProduct(ctx context.Context, id string, userId string) error
-	ListProduct(ctx context.Context, page uint64) ([]*models.ProductList, error)
+	ListProduct(ctx context.Context, filter *models.ProductFilter, request models.PageRequest) (*models.Page[*models.ProductList], error)
+	ProductFacets(ctx context.Context, filter *models.ProductFilter) (*models.ProductFacets, error)
+	SearchProducts(ctx context.Context, query string, page uint64) ([]*models.ProductSearchResult, error)
 	InsertImage(ctx context.Context, image *models.Image) (string, error)
 	LinkProductToImage(ctx context.Context, productID string, imageID string) error
+	ListProductImages(ctx context.Context, productId string) ([]*models.ProductImage, error)
+	ReorderProductImages(ctx context.Context, productId string, imageIds []string) error
+	SetPrimaryProductImage(ctx context.Context, productId string, imageId string) error
+	UnlinkProductImage(ctx context.Context, productId string, imageId string) error
+	DeleteUnusedImage(ctx context.Context, imageId string) (bool, error)
+	CountImagesByUrl(ctx context.Context, url string) (int, error)
+
+	// opciones y variantes
+	InsertProductOption(ctx context.Context, option *models.ProductOption) error
+	ListProductOptions(ctx context.Context, productId string) ([]*models.ProductOption, error)
+	InsertVariant(ctx context.Context, variant *models.Variant) error
+	GetVariantById(ctx context.Context, id string) (*models.Variant, error)
+	GetVariantBySku(ctx context.Context, sku string) (*models.Variant, error)
+	ListVariants(ctx context.Context, productId string) ([]*models.Variant, error)
+	UpdateVariant(ctx context.Context, variant *models.Variant) error
+	DeleteVariant(ctx context.Context, id string) error
+	LinkVariantToImage(ctx context.Context, variantId string, imageId string) error
+
+	// categorias
+	InsertCategory(ctx context.Context, category *models.Category) error
+	GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error)
+	UpdateCategory(ctx context.Context, category *models.Category) error
+	DeleteCategory(ctx context.Context, id string) error
+	ListCategories(ctx context.Context) ([]*models.Category, error)
+	ListProductCategories(ctx context.Context, productId string) ([]*models.Category, error)
+	SetProductCategories(ctx context.Context, productId string, categoryIds []string) error
+	ListCategoryProducts(ctx context.Context, categoryId string, page uint64) ([]*models.ProductList, error)
 	GetImageById(ctx context.Context, id string) (*models.Image, error)
 
 	// Crud for wishcar
@@ -27,21 +103,65 @@ type Repository interface {
 	GetWishCarById(ctx context.Context, userId string) (*models.Car, error)
 	UpdateWishCar(ctx context.Context, wishCar *models.Car) error
 	AddItem(ctx context.Context, carItem *models.CarItem) error
-	GetItem(ctx context.Context, productId string, carId string) (*models.CarItem, error)
+	GetItem(ctx context.Context, productId string, variantId string, carId string) (*models.CarItem, error)
 	RemoveItem(ctx context.Context, productId string) error
-	UpdateQuantity(ctx context.Context, productId string, quiantity int) error
-	ListItems(ctx context.Context, carId string) ([]*models.CarItem, error)
+	UpdateQuantity(ctx context.Context, itemId string, quiantity int) error
+	ListItems(ctx context.Context, userId string, request models.PageRequest) (*models.Page[*models.CarItem], error)
+	ClearWishCar(ctx context.Context, carId string) error
+
+	// orders
+	CreateOrder(ctx context.Context, order *models.Order) error // reserva el stock de los items
+	GetOrderById(ctx context.Context, id string) (*models.Order, error)
+	ListOrders(ctx context.Context, userId string) ([]*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, change *models.OrderStatusChange) error
+	ListOrderStatusHistory(ctx context.Context, orderId string) ([]*models.OrderStatusChange, error)
 
 	// roles
 	CreateRole(ctx context.Context, role *models.Role) error
-	ListRoles(ctx context.Context) ([]*models.Role, error)
+	ListRoles(ctx context.Context, request models.PageRequest) (*models.Page[*models.Role], error)
 	GetRole(ctx context.Context, name string) (*models.Role, error)
 	SetRoleUser(ctx context.Context, userId string, roleId int) error
 	GetUserRoles(ctx context.Context, userId string) ([]string, error)
+	RemoveRoleUser(ctx context.Context, userId string, roleId int) error
+
+	// permisos
+	ListPermissions(ctx context.Context) ([]*models.Permission, error)
+	GetPermission(ctx context.Context, name string) (*models.Permission, error)
+	GetRolePermissions(ctx context.Context, roleId int) ([]string, error)
+	GrantPermission(ctx context.Context, roleId int, permissionId int) error
+	RevokePermission(ctx context.Context, roleId int, permissionId int) error
+	GetUserPermissions(ctx context.Context, userId string) ([]string, error)
+	InsertGrantAudit(ctx context.Context, audit *models.GrantAudit) error
+	ListGrantAudit(ctx context.Context) ([]*models.GrantAudit, error)
+
+	// chat
+	InsertConversation(ctx context.Context, conversation *models.Conversation) error
+	GetConversationById(ctx context.Context, id string) (*models.Conversation, error)
+	FindConversation(ctx context.Context, productId string, customerId string) (*models.Conversation, error)
+	ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error)
+	InsertChatMessage(ctx context.Context, message *models.ChatMessage) error
+	ListChatMessages(ctx context.Context, conversationId string, page uint64) ([]*models.ChatMessage, error)
+	MarkChatRead(ctx context.Context, conversationId string, readerId string, readAt time.Time) (int64, error)
+
+	// llamadas
+	InsertCall(ctx context.Context, call *models.Call) error
+	GetCallById(ctx context.Context, id string) (*models.Call, error)
+	UpdateCall(ctx context.Context, call *models.Call, fromStatus string) error
+	ListCalls(ctx context.Context, userId string) ([]*models.Call, error)
+	ListRingingCalls(ctx context.Context) ([]*models.Call, error)
+
+	// eventos del hub del websocket
+	InsertHubEvent(ctx context.Context, event *models.HubEvent) error
+	ListHubEvents(ctx context.Context, since int64, limit int) ([]*models.HubEvent, error)
+	TrimHubEvents(ctx context.Context, keep int) error
 
 	//bussiness
 	InsertUserBusiness(ctx context.Context, bussinessman *models.Bussinessman) error
 
+	// WithTx ejecuta fn dentro de una transaccion: el Repository que recibe fn
+	// hace todas sus operaciones en ella y si fn devuelve error se deshacen todas.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+
 	Close() error
 }
 
@@ -63,6 +183,62 @@ func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	return implementation.GetUserByEmail(ctx, email)
 }
 
+// tokens
+func InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return implementation.InsertRefreshToken(ctx, token)
+}
+
+func GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	return implementation.GetRefreshToken(ctx, tokenHash)
+}
+
+func RevokeRefreshToken(ctx context.Context, id string) error {
+	return implementation.RevokeRefreshToken(ctx, id)
+}
+
+func RevokeRefreshFamily(ctx context.Context, familyId string) error {
+	return implementation.RevokeRefreshFamily(ctx, familyId)
+}
+
+func RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return implementation.RevokeAccessToken(ctx, jti, expiresAt)
+}
+
+func IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return implementation.IsAccessTokenRevoked(ctx, jti)
+}
+
+func RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	return implementation.RevokeUserRefreshTokens(ctx, userId)
+}
+
+func InsertUserToken(ctx context.Context, token *models.UserToken) error {
+	return implementation.InsertUserToken(ctx, token)
+}
+
+// UseUserToken marca el token como usado y lo devuelve; si no existe, expiro o ya se uso devuelve un token vacio.
+func UseUserToken(ctx context.Context, tokenHash string, purpose string) (*models.UserToken, error) {
+	return implementation.UseUserToken(ctx, tokenHash, purpose)
+}
+
+func UpdatePassword(ctx context.Context, userId string, password string) error {
+	return implementation.UpdatePassword(ctx, userId, password)
+}
+
+func SetEmailVerified(ctx context.Context, userId string) error {
+	return implementation.SetEmailVerified(ctx, userId)
+}
+
+// SetLastSeen guarda cuando se desconecto el usuario por ultima vez.
+func SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error {
+	return implementation.SetLastSeen(ctx, userId, lastSeen)
+}
+
+// GetLastSeen devuelve cuando se desconecto el usuario por ultima vez, nil si nunca se conecto.
+func GetLastSeen(ctx context.Context, userId string) (*time.Time, error) {
+	return implementation.GetLastSeen(ctx, userId)
+}
+
 func InsertProduct(ctx context.Context, product *models.Product) error {
 	return implementation.InsertProduct(ctx, product)
 }
@@ -75,8 +251,19 @@ func UpdateProduct(ctx context.Context, product *models.Product) error {
 	return implementation.UpdateProduct(ctx, product)
 }
 
-func ListProduct(ctx context.Context, page uint64) ([]*models.ProductList, error) {
-	return implementation.ListProduct(ctx, page)
+// ListProduct devuelve una pagina de los productos que cumplen filter en el orden de filter.Sort.
+func ListProduct(ctx context.Context, filter *models.ProductFilter, request models.PageRequest) (*models.Page[*models.ProductList], error) {
+	return implementation.ListProduct(ctx, filter, request)
+}
+
+// ProductFacets cuenta los productos de filter por categoria y por rango de precio.
+func ProductFacets(ctx context.Context, filter *models.ProductFilter) (*models.ProductFacets, error) {
+	return implementation.ProductFacets(ctx, filter)
+}
+
+// SearchProducts busca query en el nombre y la descripcion, los mas relevantes primero.
+func SearchProducts(ctx context.Context, query string, page uint64) ([]*models.ProductSearchResult, error) {
+	return implementation.SearchProducts(ctx, query, page)
 }
 
 func DeleteProduct(ctx context.Context, id string, userId string) error {
@@ -87,10 +274,117 @@ func InsertImage(ctx context.Context, image *models.Image) (string, error) {
 	return implementation.InsertImage(ctx, image)
 }
 
+// LinkProductToImage agrega la imagen al final del producto; la primera imagen queda como primaria.
 func LinkProductToImage(ctx context.Context, productID string, imageID string) error {
 	return implementation.LinkProductToImage(ctx, productID, imageID)
 }
 
+// ListProductImages devuelve las imagenes del producto ordenadas por position.
+func ListProductImages(ctx context.Context, productId string) ([]*models.ProductImage, error) {
+	return implementation.ListProductImages(ctx, productId)
+}
+
+// ReorderProductImages recibe todas las imagenes del producto en el orden nuevo.
+func ReorderProductImages(ctx context.Context, productId string, imageIds []string) error {
+	return implementation.ReorderProductImages(ctx, productId, imageIds)
+}
+
+func SetPrimaryProductImage(ctx context.Context, productId string, imageId string) error {
+	return implementation.SetPrimaryProductImage(ctx, productId, imageId)
+}
+
+// UnlinkProductImage quita la imagen del producto; si era la primaria pasa a serlo la primera que queda.
+func UnlinkProductImage(ctx context.Context, productId string, imageId string) error {
+	return implementation.UnlinkProductImage(ctx, productId, imageId)
+}
+
+// DeleteUnusedImage borra la imagen si ningun producto ni variante la usa y devuelve si la borro.
+func DeleteUnusedImage(ctx context.Context, imageId string) (bool, error) {
+	return implementation.DeleteUnusedImage(ctx, imageId)
+}
+
+// CountImagesByUrl cuenta las imagenes que apuntan al mismo archivo.
+func CountImagesByUrl(ctx context.Context, url string) (int, error) {
+	return implementation.CountImagesByUrl(ctx, url)
+}
+
+func InsertProductOption(ctx context.Context, option *models.ProductOption) error {
+	return implementation.InsertProductOption(ctx, option)
+}
+
+// ListProductOptions devuelve las opciones del producto ordenadas por position.
+func ListProductOptions(ctx context.Context, productId string) ([]*models.ProductOption, error) {
+	return implementation.ListProductOptions(ctx, productId)
+}
+
+func InsertVariant(ctx context.Context, variant *models.Variant) error {
+	return implementation.InsertVariant(ctx, variant)
+}
+
+// GetVariantById devuelve una variante vacia si no existe.
+func GetVariantById(ctx context.Context, id string) (*models.Variant, error) {
+	return implementation.GetVariantById(ctx, id)
+}
+
+// GetVariantBySku devuelve una variante vacia si ningun producto usa el SKU.
+func GetVariantBySku(ctx context.Context, sku string) (*models.Variant, error) {
+	return implementation.GetVariantBySku(ctx, sku)
+}
+
+// ListVariants devuelve la matriz de variantes del producto con sus imagenes.
+func ListVariants(ctx context.Context, productId string) ([]*models.Variant, error) {
+	return implementation.ListVariants(ctx, productId)
+}
+
+// UpdateVariant cambia el SKU, el precio y el stock; las opciones de una variante no cambian.
+func UpdateVariant(ctx context.Context, variant *models.Variant) error {
+	return implementation.UpdateVariant(ctx, variant)
+}
+
+func DeleteVariant(ctx context.Context, id string) error {
+	return implementation.DeleteVariant(ctx, id)
+}
+
+func LinkVariantToImage(ctx context.Context, variantId string, imageId string) error {
+	return implementation.LinkVariantToImage(ctx, variantId, imageId)
+}
+
+func InsertCategory(ctx context.Context, category *models.Category) error {
+	return implementation.InsertCategory(ctx, category)
+}
+
+// GetCategoryBySlug devuelve una categoria vacia si no existe.
+func GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	return implementation.GetCategoryBySlug(ctx, slug)
+}
+
+func UpdateCategory(ctx context.Context, category *models.Category) error {
+	return implementation.UpdateCategory(ctx, category)
+}
+
+// DeleteCategory borra la categoria y sus enlaces con productos; falla si tiene subcategorias.
+func DeleteCategory(ctx context.Context, id string) error {
+	return implementation.DeleteCategory(ctx, id)
+}
+
+func ListCategories(ctx context.Context) ([]*models.Category, error) {
+	return implementation.ListCategories(ctx)
+}
+
+func ListProductCategories(ctx context.Context, productId string) ([]*models.Category, error) {
+	return implementation.ListProductCategories(ctx, productId)
+}
+
+// SetProductCategories reemplaza las categorias del producto por categoryIds.
+func SetProductCategories(ctx context.Context, productId string, categoryIds []string) error {
+	return implementation.SetProductCategories(ctx, productId, categoryIds)
+}
+
+// ListCategoryProducts devuelve los productos de la categoria y de sus subcategorias.
+func ListCategoryProducts(ctx context.Context, categoryId string, page uint64) ([]*models.ProductList, error) {
+	return implementation.ListCategoryProducts(ctx, categoryId, page)
+}
+
 func GetImageById(ctx context.Context, id string) (*models.Image, error) {
 	return implementation.GetImageById(ctx, id)
 }
@@ -112,20 +406,48 @@ func UpdateWishCar(ctx context.Context, wishCar *models.Car) error {
 	return implementation.UpdateWishCar(ctx, wishCar)
 }
 
-func GetItem(ctx context.Context, productId string, carId string) (*models.CarItem, error) {
-	return implementation.GetItem(ctx, productId, carId)
+// GetItem busca el item del producto (y de la variante, vacia si no tiene) en el carrito.
+func GetItem(ctx context.Context, productId string, variantId string, carId string) (*models.CarItem, error) {
+	return implementation.GetItem(ctx, productId, variantId, carId)
 }
 
 func RemoveItem(ctx context.Context, productId string) error {
 	return implementation.RemoveItem(ctx, productId)
 }
 
-func UpdateQuantity(ctx context.Context, productId string, quantity int) error {
-	return implementation.UpdateQuantity(ctx, productId, quantity)
+// UpdateQuantity suma quantity a las unidades del item del carrito.
+func UpdateQuantity(ctx context.Context, itemId string, quantity int) error {
+	return implementation.UpdateQuantity(ctx, itemId, quantity)
+}
+
+// ListItems devuelve una pagina del carrito del usuario; con request vacio trae todos los items.
+func ListItems(ctx context.Context, userId string, request models.PageRequest) (*models.Page[*models.CarItem], error) {
+	return implementation.ListItems(ctx, userId, request)
+}
+
+func ClearWishCar(ctx context.Context, carId string) error {
+	return implementation.ClearWishCar(ctx, carId)
+}
+
+// orders
+func CreateOrder(ctx context.Context, order *models.Order) error {
+	return implementation.CreateOrder(ctx, order)
+}
+
+func GetOrderById(ctx context.Context, id string) (*models.Order, error) {
+	return implementation.GetOrderById(ctx, id)
+}
+
+func ListOrders(ctx context.Context, userId string) ([]*models.Order, error) {
+	return implementation.ListOrders(ctx, userId)
+}
+
+func UpdateOrderStatus(ctx context.Context, change *models.OrderStatusChange) error {
+	return implementation.UpdateOrderStatus(ctx, change)
 }
 
-func ListItems(ctx context.Context, carId string) ([]*models.CarItem, error) {
-	return implementation.ListItems(ctx, carId)
+func ListOrderStatusHistory(ctx context.Context, orderId string) ([]*models.OrderStatusChange, error) {
+	return implementation.ListOrderStatusHistory(ctx, orderId)
 }
 
 // roles
@@ -133,8 +455,8 @@ func CreateRole(ctx context.Context, role *models.Role) error {
 	return implementation.CreateRole(ctx, role)
 }
 
-func ListRoles(ctx context.Context) ([]*models.Role, error) {
-	return implementation.ListRoles(ctx)
+func ListRoles(ctx context.Context, request models.PageRequest) (*models.Page[*models.Role], error) {
+	return implementation.ListRoles(ctx, request)
 }
 
 func GetRole(ctx context.Context, name string) (*models.Role, error) {
@@ -149,12 +471,130 @@ func GetUserRoles(ctx context.Context, userId string) ([]string, error) {
 	return implementation.GetUserRoles(ctx, userId)
 }
 
+func RemoveRoleUser(ctx context.Context, userId string, roleId int) error {
+	return implementation.RemoveRoleUser(ctx, userId, roleId)
+}
+
+// permisos
+
+func ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	return implementation.ListPermissions(ctx)
+}
+
+func GetPermission(ctx context.Context, name string) (*models.Permission, error) {
+	return implementation.GetPermission(ctx, name)
+}
+
+func GetRolePermissions(ctx context.Context, roleId int) ([]string, error) {
+	return implementation.GetRolePermissions(ctx, roleId)
+}
+
+func GrantPermission(ctx context.Context, roleId int, permissionId int) error {
+	return implementation.GrantPermission(ctx, roleId, permissionId)
+}
+
+func RevokePermission(ctx context.Context, roleId int, permissionId int) error {
+	return implementation.RevokePermission(ctx, roleId, permissionId)
+}
+
+func GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	return implementation.GetUserPermissions(ctx, userId)
+}
+
+func InsertGrantAudit(ctx context.Context, audit *models.GrantAudit) error {
+	return implementation.InsertGrantAudit(ctx, audit)
+}
+
+func ListGrantAudit(ctx context.Context) ([]*models.GrantAudit, error) {
+	return implementation.ListGrantAudit(ctx)
+}
+
+// chat
+
+func InsertConversation(ctx context.Context, conversation *models.Conversation) error {
+	return implementation.InsertConversation(ctx, conversation)
+}
+
+func GetConversationById(ctx context.Context, id string) (*models.Conversation, error) {
+	return implementation.GetConversationById(ctx, id)
+}
+
+// FindConversation busca la conversacion del cliente sobre el producto, vacia si no existe.
+func FindConversation(ctx context.Context, productId string, customerId string) (*models.Conversation, error) {
+	return implementation.FindConversation(ctx, productId, customerId)
+}
+
+func ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error) {
+	return implementation.ListConversations(ctx, userId)
+}
+
+func InsertChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	return implementation.InsertChatMessage(ctx, message)
+}
+
+func ListChatMessages(ctx context.Context, conversationId string, page uint64) ([]*models.ChatMessage, error) {
+	return implementation.ListChatMessages(ctx, conversationId, page)
+}
+
+// MarkChatRead marca como leidos los mensajes que recibio readerId y devuelve cuantos marco.
+func MarkChatRead(ctx context.Context, conversationId string, readerId string, readAt time.Time) (int64, error) {
+	return implementation.MarkChatRead(ctx, conversationId, readerId, readAt)
+}
+
+// llamadas
+
+func InsertCall(ctx context.Context, call *models.Call) error {
+	return implementation.InsertCall(ctx, call)
+}
+
+func GetCallById(ctx context.Context, id string) (*models.Call, error) {
+	return implementation.GetCallById(ctx, id)
+}
+
+// UpdateCall guarda el estado, la conexion del que contesta y las horas de la llamada;
+// devuelve ErrCallStatusConflict si la llamada ya no estaba en fromStatus.
+func UpdateCall(ctx context.Context, call *models.Call, fromStatus string) error {
+	return implementation.UpdateCall(ctx, call, fromStatus)
+}
+
+// ListCalls devuelve las llamadas que hizo o recibio el usuario, la mas reciente primero.
+func ListCalls(ctx context.Context, userId string) ([]*models.Call, error) {
+	return implementation.ListCalls(ctx, userId)
+}
+
+// ListRingingCalls devuelve las llamadas que siguen sonando en cualquier instancia.
+func ListRingingCalls(ctx context.Context) ([]*models.Call, error) {
+	return implementation.ListRingingCalls(ctx)
+}
+
+// eventos del hub
+
+// InsertHubEvent guarda el evento y le asigna el siguiente seq.
+func InsertHubEvent(ctx context.Context, event *models.HubEvent) error {
+	return implementation.InsertHubEvent(ctx, event)
+}
+
+// ListHubEvents devuelve hasta limit eventos desde el seq since (incluido), del mas viejo al mas nuevo.
+func ListHubEvents(ctx context.Context, since int64, limit int) ([]*models.HubEvent, error) {
+	return implementation.ListHubEvents(ctx, since, limit)
+}
+
+// TrimHubEvents borra los eventos viejos y deja los ultimos keep.
+func TrimHubEvents(ctx context.Context, keep int) error {
+	return implementation.TrimHubEvents(ctx, keep)
+}
+
 // bussiness
 
 func InsertUserBusiness(ctx context.Context, bussinessman *models.Bussinessman) error {
 	return implementation.InsertUserBusiness(ctx, bussinessman)
 }
 
+// WithTx ejecuta una secuencia de llamadas al repositorio como una sola unidad de trabajo.
+func WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return implementation.WithTx(ctx, fn)
+}
+
 func Close() error {
 	return implementation.Close()
 }
@@ -3,25 +3,45 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/kevintovar01/Store/database"
+	"github.com/kevintovar01/Store/mailer"
 	"github.com/kevintovar01/Store/repository"
 	"github.com/kevintovar01/Store/websocket"
 )
 
 type Config struct {
-	Port        string
-	JWTSecret   string //  secret key to generate tokens
-	DatabaseUrl string // DB connection
+	Port           string
+	JWTSecret      string //  secret key to generate tokens
+	DatabaseUrl    string // DB connection
+	DatabaseDriver string // "postgres" (por defecto) o "memory" para pruebas y demos locales
+
+	// correo: si no hay SMTPHost los correos se escriben en MailOutboxDir
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	MailFrom      string
+	MailOutboxDir string
+	AppUrl        string // url del frontend, se usa en los enlaces de los correos
+
+	RequireVerifiedEmail bool // si es true solo los usuarios con email verificado pueden hacer checkout
+
+	CallRingTimeout time.Duration // cuanto suena una llamada antes de darla por perdida, 0 usa el valor por defecto
+
+	UploadsDir string // carpeta de las imagenes subidas, se sirve en /uploads/; vacio usa ./uploads
 }
 
 type Server interface {
 	Config() *Config
 	Hub() *websocket.Hub
+	Mailer() mailer.Mailer
 }
 
 // broker encargado de manejar los servidores
@@ -29,6 +49,7 @@ type Broker struct {
 	config *Config
 	router *mux.Router // define las rutas de la API
 	hub    *websocket.Hub
+	mailer mailer.Mailer
 }
 
 func (b *Broker) Config() *Config {
@@ -39,6 +60,10 @@ func (b *Broker) Hub() *websocket.Hub {
 	return b.hub
 }
 
+func (b *Broker) Mailer() mailer.Mailer {
+	return b.mailer
+}
+
 // patron factory method
 
 func NewServer(ctx context.Context, config *Config) (*Broker, error) {
@@ -52,20 +77,49 @@ func NewServer(ctx context.Context, config *Config) (*Broker, error) {
 		return nil, errors.New("key secret is required")
 	}
 
-	if config.DatabaseUrl == "" {
+	// el repositorio en memoria no necesita conexion
+	if config.DatabaseUrl == "" && config.DatabaseDriver != "memory" {
 		return nil, errors.New("db url is required")
 	}
 
+	if config.UploadsDir == "" {
+		config.UploadsDir = "./uploads"
+	}
+
 	broker := &Broker{
 		config: config,
 		router: mux.NewRouter(),
 		hub:    websocket.NewHub(),
+		mailer: newMailer(config),
 	}
 
 	return broker, nil
 }
 
-func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
+// Setup crea el repositorio, arranca el hub y configura las rutas.
+// Devuelve el handler listo para servir, Start lo usa y las pruebas lo montan en un httptest.Server.
+func (b *Broker) Setup(binder func(s Server, r *mux.Router)) (http.Handler, error) {
+	// Crea el repositorio segun el driver de la configuración
+	repo, err := newRepository(b.config)
+	if err != nil {
+		return nil, err
+	}
+	// el backplane reparte los mensajes del hub entre todas las instancias de la aplicacion
+	backplane, err := newBackplane(b.config)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.hub.UseBackplane(backplane); err != nil {
+		return nil, err
+	}
+	// los eventos del hub se guardan en el repositorio para repetirlos a quien se reconecta
+	b.hub.UseEventLog(repo)
+	// la ultima conexion de cada usuario queda en el repositorio cuando se desconecta
+	b.hub.UseLastSeenStore(repo)
+	go b.hub.Run()
+	// Establece el repositorio globalmente
+	repository.SetRepository(repo)
+
 	// Crea un nuevo enrutador de mux
 	b.router = mux.NewRouter()
 
@@ -80,16 +134,15 @@ func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 	)
 
 	// Envuelve el enrutador con el middleware CORS
-	handler := corsOptions(b.router)
-	// Crea un nuevo repositorio de PostgreSQL utilizando la URL de la base de datos de la configuración
-	repo, err := database.NewPostgresRepository(b.config.DatabaseUrl)
+	return corsOptions(b.router), nil
+}
+
+func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
+	handler, err := b.Setup(binder)
 	if err != nil {
 		// Si hay un error al crear el repositorio, se registra y se termina el programa
 		log.Fatal(err)
 	}
-	go b.hub.Run()
-	// Establece el repositorio globalmente
-	repository.SetRepository(repo)
 
 	// Imprime un mensaje indicando que el servidor está iniciando en el puerto configurado
 	log.Println("Start server on port", b.Config().Port)
@@ -100,3 +153,55 @@ func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 	}
 
 }
+
+// newMailer usa SMTP cuando esta configurado y si no deja los correos en un directorio local.
+func newMailer(config *Config) mailer.Mailer {
+	from := config.MailFrom
+	if from == "" {
+		from = "no-reply@store.local"
+	}
+
+	if config.SMTPHost != "" {
+		port := config.SMTPPort
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(config.SMTPHost, port, config.SMTPUsername, config.SMTPPassword, from)
+	}
+
+	dir := config.MailOutboxDir
+	if dir == "" {
+		dir = "./outbox"
+	}
+	return mailer.NewOutboxMailer(dir, from)
+}
+
+// newRepository elige la implementacion del repositorio segun Config.DatabaseDriver.
+func newRepository(config *Config) (repository.Repository, error) {
+	switch config.DatabaseDriver {
+	case "", "postgres":
+		repo, err := database.NewPostgresRepository(config.DatabaseUrl)
+		if err != nil {
+			return nil, err
+		}
+		// el esquema se actualiza al iniciar, las migraciones ya aplicadas se saltan
+		if err = repo.MigrateUp(context.Background()); err != nil {
+			return nil, err
+		}
+		return repo, nil
+	case "memory":
+		return database.NewMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver: %s", config.DatabaseDriver)
+	}
+}
+
+// newBackplane usa LISTEN/NOTIFY de la misma base de datos con postgres; en memoria solo hay una instancia.
+func newBackplane(config *Config) (websocket.Backplane, error) {
+	switch config.DatabaseDriver {
+	case "", "postgres":
+		return websocket.NewPostgresBackplane(config.DatabaseUrl)
+	default:
+		return websocket.NewMemoryBackplane(), nil
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/server"
+)
+
+func TestVariants(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+	shirt := createProduct(t, ts, merchant, "Camiseta", 20, 0)
+	mouse := createProduct(t, ts, merchant, "Mouse", 10, 5)
+
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", other, map[string]interface{}{"name": "size", "values": []string{"S"}}, nil); status != http.StatusForbidden {
+		t.Fatalf("option on someone else's product: expected 403, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", merchant, map[string]interface{}{"name": "size", "values": []string{"S", "S"}}, nil); status != http.StatusBadRequest {
+		t.Fatalf("repeated option values: expected 400, got %d", status)
+	}
+	for name, values := range map[string][]string{"size": {"S", "M", "L"}, "color": {"rojo", "azul"}} {
+		if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", merchant, map[string]interface{}{"name": name, "values": values}, nil); status != http.StatusCreated {
+			t.Fatalf("create option %s: %d", name, status)
+		}
+	}
+
+	type variant struct {
+		Id      string            `json:"id"`
+		Sku     string            `json:"sku"`
+		Price   *float64          `json:"price"`
+		Stock   int               `json:"stock"`
+		Options map[string]string `json:"options"`
+	}
+	createVariant := func(body map[string]interface{}) (variant, int) {
+		t.Helper()
+		var created variant
+		status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/variants", merchant, body, &created)
+		return created, status
+	}
+
+	redM, status := createVariant(map[string]interface{}{"sku": "TS-M-R", "price": 25, "stock": 2, "options": map[string]string{"size": "M", "color": "rojo"}})
+	if status != http.StatusCreated || redM.Price == nil || *redM.Price != 25 {
+		t.Fatalf("create variant: %d %+v", status, redM)
+	}
+	blueS, status := createVariant(map[string]interface{}{"sku": "TS-S-A", "stock": 5, "options": map[string]string{"size": "S", "color": "azul"}})
+	if status != http.StatusCreated || blueS.Price != nil {
+		t.Fatalf("create variant without price: %d %+v", status, blueS)
+	}
+	for _, invalid := range []struct {
+		body   map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"sku": "TS-M-R2", "options": map[string]string{"size": "M", "color": "rojo"}}, http.StatusConflict},
+		{map[string]interface{}{"sku": "TS-S-A", "options": map[string]string{"size": "L", "color": "rojo"}}, http.StatusConflict},
+		{map[string]interface{}{"sku": "TS-XL", "options": map[string]string{"size": "XL", "color": "rojo"}}, http.StatusBadRequest},
+		{map[string]interface{}{"sku": "TS-L", "options": map[string]string{"size": "L"}}, http.StatusBadRequest},
+		{map[string]interface{}{"sku": "", "options": map[string]string{"size": "L", "color": "rojo"}}, http.StatusBadRequest},
+		{map[string]interface{}{"sku": "TS-L-R", "stock": -1, "options": map[string]string{"size": "L", "color": "rojo"}}, http.StatusBadRequest},
+	} {
+		if _, status := createVariant(invalid.body); status != invalid.status {
+			t.Fatalf("invalid variant %v: expected %d, got %d", invalid.body, invalid.status, status)
+		}
+	}
+	// con variantes ya creadas no se agregan opciones
+	if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", merchant, map[string]interface{}{"name": "fit", "values": []string{"slim"}}, nil); status != http.StatusConflict {
+		t.Fatalf("option after variants: expected 409, got %d", status)
+	}
+
+	var detail struct {
+		Options []struct {
+			Name   string   `json:"name"`
+			Values []string `json:"values"`
+		} `json:"options"`
+		Variants []variant `json:"variants"`
+	}
+	// el detalle es publico: el cliente necesita los ids de las variantes para agregarlas al carro
+	if status := doJSON(t, ts, http.MethodGet, "/products/"+shirt, customer, nil, &detail); status != http.StatusOK {
+		t.Fatalf("product detail as customer: status %d", status)
+	}
+	if len(detail.Options) != 2 || len(detail.Variants) != 2 || detail.Variants[0].Id == "" {
+		t.Fatalf("unexpected variant matrix %+v", detail)
+	}
+
+	// un producto con variantes se agrega por variante
+	if status := doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]interface{}{"quantity": 1}, nil); status != http.StatusBadRequest {
+		t.Fatalf("add a product with variants without variant_id: expected 400, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/addItem/"+mouse, customer, map[string]interface{}{"quantity": 1, "variant_id": redM.Id}, nil); status != http.StatusNotFound {
+		t.Fatalf("add a variant of another product: expected 404, got %d", status)
+	}
+	doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]interface{}{"quantity": 3, "variant_id": redM.Id}, nil)
+	doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]interface{}{"quantity": 1, "variant_id": blueS.Id}, nil)
+	doJSON(t, ts, http.MethodPost, "/addItem/"+mouse, customer, map[string]interface{}{"quantity": 1}, nil)
+
+	var items testWishcar
+	doJSON(t, ts, http.MethodGet, "/wishcar", customer, nil, &items)
+	if len(items.Items) != 3 {
+		t.Fatalf("expected one item per variant, got %+v", items)
+	}
+
+	// el stock que falta es el de la variante, no el del producto
+	var shortage struct {
+		Items []struct {
+			VariantId string `json:"variant_id"`
+			Requested int    `json:"requested"`
+			Available int    `json:"available"`
+		} `json:"items"`
+	}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/checkout", nil)
+	req.Header.Set("Authorization", "Bearer "+customer)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&shortage)
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("checkout without variant stock: expected 409, got %d", res.StatusCode)
+	}
+	if len(shortage.Items) != 1 || shortage.Items[0].VariantId != redM.Id || shortage.Items[0].Requested != 3 || shortage.Items[0].Available != 2 {
+		t.Fatalf("unexpected shortage %+v", shortage)
+	}
+
+	doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]interface{}{"quantity": -1, "variant_id": redM.Id}, nil)
+
+	var order struct {
+		Total float64 `json:"total"`
+		Items []struct {
+			VariantId string  `json:"variant_id"`
+			Sku       string  `json:"sku"`
+			UnitPrice float64 `json:"unit_price"`
+			Quantity  int     `json:"quantity"`
+		} `json:"items"`
+	}
+	if status := doJSON(t, ts, http.MethodPost, "/checkout", customer, nil, &order); status != http.StatusCreated {
+		t.Fatalf("checkout: expected 201, got %d", status)
+	}
+	// 2 x 25 (precio de la variante) + 1 x 20 (precio del producto) + 1 x 10
+	if order.Total != 80 || len(order.Items) != 3 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	skus := map[string]float64{}
+	for _, item := range order.Items {
+		skus[item.Sku] = item.UnitPrice
+	}
+	if skus["TS-M-R"] != 25 || skus["TS-S-A"] != 20 || skus[""] != 10 {
+		t.Fatalf("unexpected order items %+v", order.Items)
+	}
+
+	doJSON(t, ts, http.MethodGet, "/products/"+shirt, merchant, nil, &detail)
+	stock := map[string]int{}
+	for _, v := range detail.Variants {
+		stock[v.Sku] = v.Stock
+	}
+	if stock["TS-M-R"] != 0 || stock["TS-S-A"] != 4 {
+		t.Fatalf("variant stock after checkout: %+v", stock)
+	}
+
+	var updated variant
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/variants/"+redM.Id, merchant, map[string]interface{}{"sku": "TS-M-R", "stock": 10}, &updated); status != http.StatusOK || updated.Stock != 10 || updated.Price != nil || updated.Options["size"] != "M" {
+		t.Fatalf("update variant: %d %+v", status, updated)
+	}
+	if status := doJSON(t, ts, http.MethodPut, "/products/"+shirt+"/variants/"+redM.Id, merchant, map[string]interface{}{"sku": "TS-S-A"}, nil); status != http.StatusConflict {
+		t.Fatalf("update to a used sku: expected 409, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+mouse+"/variants/"+redM.Id, merchant, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("delete through another product: expected 404, got %d", status)
+	}
+	if status := doJSON(t, ts, http.MethodDelete, "/products/"+shirt+"/variants/"+redM.Id, merchant, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete variant: %d", status)
+	}
+	doJSON(t, ts, http.MethodGet, "/products/"+shirt, merchant, nil, &detail)
+	if len(detail.Variants) != 1 || detail.Variants[0].Id != blueS.Id {
+		t.Fatalf("variants after delete: %+v", detail.Variants)
+	}
+}
+
+// TestCancelRestocksVariants corre sobre memoria y, si TEST_DATABASE_URL esta definida, sobre postgres.
+func TestCancelRestocksVariants(t *testing.T) {
+	for _, driver := range []string{"memory", "postgres"} {
+		t.Run(driver, func(t *testing.T) {
+			databaseUrl := os.Getenv("TEST_DATABASE_URL")
+			if driver == "postgres" && databaseUrl == "" {
+				t.Skip("TEST_DATABASE_URL is not set")
+			}
+			ts := newTestServer(t, func(config *server.Config) {
+				config.DatabaseDriver = driver
+				config.DatabaseUrl = databaseUrl
+			})
+
+			// la base de postgres se comparte entre corridas, los emails y skus no se pueden repetir
+			suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+			admin := signUpAdmin(t, ts, "root-"+suffix+"@store.com", "secret")
+			merchant := signUpMerchant(t, ts, "shop-"+suffix+"@store.com", "secret")
+			customer := signUp(t, ts, "ana-"+suffix+"@store.com", "secret")
+			shirt := createProduct(t, ts, merchant, "Camiseta", 20, 0)
+			mouse := createProduct(t, ts, merchant, "Mouse", 10, 5)
+
+			if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/options", merchant, map[string]interface{}{"name": "size", "values": []string{"S", "M"}}, nil); status != http.StatusCreated {
+				t.Fatalf("create option: %d", status)
+			}
+			var small struct {
+				Id string `json:"id"`
+			}
+			if status := doJSON(t, ts, http.MethodPost, "/products/"+shirt+"/variants", merchant, map[string]interface{}{"sku": "TS-S-" + suffix, "stock": 3, "options": map[string]string{"size": "S"}}, &small); status != http.StatusCreated {
+				t.Fatalf("create variant: %d", status)
+			}
+
+			doJSON(t, ts, http.MethodPost, "/addItem/"+shirt, customer, map[string]interface{}{"quantity": 2, "variant_id": small.Id}, nil)
+			doJSON(t, ts, http.MethodPost, "/addItem/"+mouse, customer, map[string]interface{}{"quantity": 1}, nil)
+			var order struct {
+				Id string `json:"id"`
+			}
+			if status := doJSON(t, ts, http.MethodPost, "/checkout", customer, nil, &order); status != http.StatusCreated {
+				t.Fatalf("checkout: status %d", status)
+			}
+
+			stock := func() (int, int, int) {
+				t.Helper()
+				var detail, plain struct {
+					Stock    int `json:"stock"`
+					Variants []struct {
+						Stock int `json:"stock"`
+					} `json:"variants"`
+				}
+				doJSON(t, ts, http.MethodGet, "/products/"+shirt, merchant, nil, &detail)
+				doJSON(t, ts, http.MethodGet, "/products/"+mouse, merchant, nil, &plain)
+				if len(detail.Variants) != 1 {
+					t.Fatalf("unexpected variants %+v", detail.Variants)
+				}
+				return detail.Stock, detail.Variants[0].Stock, plain.Stock
+			}
+			if shirtStock, variantStock, mouseStock := stock(); shirtStock != 0 || variantStock != 1 || mouseStock != 4 {
+				t.Fatalf("stock after checkout: shirt %d, variant %d, mouse %d", shirtStock, variantStock, mouseStock)
+			}
+
+			// al cancelar la variante recupera sus unidades y el producto padre queda igual
+			if status := doJSON(t, ts, http.MethodPut, "/orders/"+order.Id+"/status", admin, map[string]string{"status": "cancelled"}, nil); status != http.StatusOK {
+				t.Fatalf("cancel order: status %d", status)
+			}
+			if shirtStock, variantStock, mouseStock := stock(); shirtStock != 0 || variantStock != 3 || mouseStock != 5 {
+				t.Fatalf("stock after cancel: shirt %d, variant %d, mouse %d", shirtStock, variantStock, mouseStock)
+			}
+		})
+	}
+}
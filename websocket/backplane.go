@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// canal de postgres por el que las instancias comparten los mensajes del hub
+	NOTIFY_CHANNEL = "store_hub"
+	// postgres rechaza payloads de NOTIFY de 8000 bytes o mas
+	maxNotifyPayload = 7999
+	// los envelopes guardados en hub_envelopes solo se leen justo despues del NOTIFY
+	envelopeRetention = 5 * time.Minute
+)
+
+// Envelope es un mensaje publicado en una instancia que se reparte en las demas.
+// Topics vacio es un Broadcast. Data vacio con Seq es una referencia: el hub que lo recibe
+// lee el evento de su EventLog.
+type Envelope struct {
+	Origin string          `json:"origin"` // id del hub que lo publico, ese hub ya lo entrego
+	Seq    int64           `json:"seq,omitempty"`
+	Topics []string        `json:"topics,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// notice es lo que viaja en el NOTIFY: el envelope o, si no cabe, el id de la fila de hub_envelopes.
+type notice struct {
+	Envelope
+	Ref int64 `json:"ref,omitempty"`
+}
+
+// Backplane conecta los hubs de todas las instancias de la aplicacion.
+// Publish envia el envelope a todos los hubs (incluido el que publica) y
+// Listen registra la funcion que recibe lo que publican los demas.
+type Backplane interface {
+	Publish(ctx context.Context, envelope *Envelope) error
+	Listen(receive func(envelope *Envelope)) error
+	Close() error
+}
+
+// MemoryBackplane reparte los mensajes entre hubs del mismo proceso.
+// Con una sola instancia es el que se usa, y en las pruebas simula varios nodos.
+type MemoryBackplane struct {
+	mutex     sync.Mutex
+	receivers []func(envelope *Envelope)
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+func (b *MemoryBackplane) Publish(ctx context.Context, envelope *Envelope) error {
+	b.mutex.Lock()
+	receivers := append([]func(*Envelope){}, b.receivers...)
+	b.mutex.Unlock()
+
+	for _, receive := range receivers {
+		receive(envelope)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Listen(receive func(envelope *Envelope)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.receivers = append(b.receivers, receive)
+	return nil
+}
+
+func (b *MemoryBackplane) Close() error {
+	return nil
+}
+
+// PostgresBackplane usa LISTEN/NOTIFY: cada instancia escucha NOTIFY_CHANNEL con una conexion
+// dedicada (pq.Listener, que se reconecta sola) y publica con pg_notify.
+// El NOTIFY lleva solo referencias cuando puede: los eventos con seq ya estan en hub_events,
+// y lo que sin seq no cabe en el payload se guarda en hub_envelopes.
+type PostgresBackplane struct {
+	db       *sql.DB
+	listener *pq.Listener
+	done     chan struct{}
+}
+
+func NewPostgresBackplane(url string) (*PostgresBackplane, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(2)
+
+	listener := pq.NewListener(url, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("hub backplane listener:", err)
+		}
+	})
+	if err := listener.Listen(NOTIFY_CHANNEL); err != nil {
+		listener.Close()
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresBackplane{
+		db:       db,
+		listener: listener,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (b *PostgresBackplane) Publish(ctx context.Context, envelope *Envelope) error {
+	message := notice{Envelope: *envelope}
+	if message.Seq > 0 {
+		// los demas hubs leen el evento de hub_events
+		message.Data = nil
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxNotifyPayload {
+		var ref int64
+		err = b.db.QueryRowContext(ctx, "INSERT INTO hub_envelopes (envelope) VALUES ($1) RETURNING id", string(payload)).Scan(&ref)
+		if err != nil {
+			return err
+		}
+		payload, err = json.Marshal(notice{Envelope: Envelope{Origin: envelope.Origin}, Ref: ref})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", NOTIFY_CHANNEL, string(payload))
+	return err
+}
+
+func (b *PostgresBackplane) Listen(receive func(envelope *Envelope)) error {
+	go func() {
+		// si la conexion muere sin que nos enteremos, el ping la detecta y pq reconecta
+		ticker := time.NewTicker(90 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.done:
+				return
+			case notification := <-b.listener.Notify:
+				// nil llega despues de una reconexion, los NOTIFY de ese intervalo se pierden
+				if notification == nil {
+					continue
+				}
+				envelope, err := b.decode(notification.Extra)
+				if err != nil {
+					log.Println("hub backplane: invalid message:", err)
+					continue
+				}
+				receive(envelope)
+			case <-ticker.C:
+				go b.listener.Ping()
+				go b.trimEnvelopes()
+			}
+		}
+	}()
+	return nil
+}
+
+// decode lee el envelope del NOTIFY, o de hub_envelopes si el NOTIFY solo trae la referencia.
+func (b *PostgresBackplane) decode(payload string) (*Envelope, error) {
+	var message notice
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		return nil, err
+	}
+	if message.Ref == 0 {
+		return &message.Envelope, nil
+	}
+
+	err := b.db.QueryRowContext(context.Background(), "SELECT envelope FROM hub_envelopes WHERE id = $1", message.Ref).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("hub envelope %d not found", message.Ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored notice
+	if err = json.Unmarshal([]byte(payload), &stored); err != nil {
+		return nil, err
+	}
+	return &stored.Envelope, nil
+}
+
+// trimEnvelopes borra los envelopes que ya leyeron todas las instancias.
+func (b *PostgresBackplane) trimEnvelopes() {
+	_, err := b.db.Exec("DELETE FROM hub_envelopes WHERE created_at < NOW() - make_interval(secs => $1)", envelopeRetention.Seconds())
+	if err != nil {
+		log.Println("hub backplane: trimming envelopes:", err)
+	}
+}
+
+func (b *PostgresBackplane) Close() error {
+	close(b.done)
+	b.listener.Close()
+	return b.db.Close()
+}
@@ -1,9 +1,13 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kevintovar01/Store/models"
+	"github.com/segmentio/ksuid"
 )
 
 // hub se encarga de mantener un registro de los clientes y de enviar mensajes a todos los clientes conectados.
@@ -11,26 +15,135 @@ import (
 type Client struct {
 	hub      *Hub
 	id       string
-	socket   *websocket.Conn
-	outbound chan []byte // messages to send to the client
+	userId   string          // usuario autenticado dueño de la conexion
+	socket   *websocket.Conn // nil en los clientes de Stream (SSE)
+	addr     string          // direccion remota, para los logs
+	outbound chan []byte     // messages to send to the client, lo cierra el hub al sacar al cliente
+	topics   map[string]bool // topics suscritos, protegidos por el mutex del hub
+	away     bool            // el cliente aviso que esta inactivo, tambien bajo el mutex del hub
+
+	// mientras se envian los eventos perdidos los nuevos esperan en pending, tambien bajo el mutex del hub
+	replaying bool
+	pending   []pendingEvent
 }
 
-func NewClient(hub *Hub, socket *websocket.Conn) *Client {
+func NewClient(hub *Hub, socket *websocket.Conn, userId string) *Client {
+	id := ksuid.New().String()
 	return &Client{
 		hub:      hub,
+		id:       id,
+		userId:   userId,
 		socket:   socket,
-		outbound: make(chan []byte),
+		addr:     socket.RemoteAddr().String(),
+		outbound: make(chan []byte, hub.sendBuffer),
+		topics:   map[string]bool{models.UserTopic(userId): true, models.ClientTopic(id): true},
+	}
+}
+
+func (c *Client) Id() string {
+	return c.id
+}
+
+func (c *Client) UserId() string {
+	return c.userId
+}
+
+// Send serializa el mensaje y lo encola para este cliente, igual que Publish nunca bloquea.
+func (c *Client) Send(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
 	}
+
+	c.hub.mutex.Lock()
+	defer c.hub.mutex.Unlock()
+	c.hub.enqueueLocked(c, data)
+	return nil
 }
 
+// Write envia los mensajes encolados y un ping cada pingPeriod para saber si el cliente sigue vivo.
+// Termina cuando el hub cierra outbound o cuando una escritura falla.
 func (c *Client) Write() {
-	// Usamos un for range para iterar sobre los mensajes en el canal outbound
-	for message := range c.outbound {
-		err := c.socket.WriteMessage(websocket.TextMessage, message)
+	ticker := time.NewTicker(c.hub.pingPeriod)
+	defer func() {
+		ticker.Stop()
+		// cerrar el socket hace fallar a Read, que es quien desregistra al cliente
+		c.socket.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.outbound:
+			c.socket.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if !ok {
+				// el hub saco al cliente
+				c.socket.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.socket.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Println("Error writing message:", err)
+				return
+			}
+		case <-ticker.C:
+			c.socket.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.socket.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// incomingMessage es un models.WebsocketMessage con el payload sin decodificar,
+// cada handler lo decodifica en su propio tipo.
+type incomingMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Read lee los mensajes del cliente y los pasa al handler registrado para su tipo.
+// Cada pong (o mensaje) extiende el plazo de lectura; si el cliente deja de responder
+// la lectura vence, la conexion se cierra y el cliente se desregistra del hub.
+func (c *Client) Read() {
+	defer func() {
+		c.hub.unregister <- c
+		c.socket.Close()
+	}()
+
+	c.socket.SetReadLimit(maxMessageSize)
+	c.socket.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	c.socket.SetPongHandler(func(string) error {
+		return c.socket.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	})
+
+	for {
+		_, data, err := c.socket.ReadMessage()
 		if err != nil {
-			log.Println("Error writing message:", err)
-			break
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Error reading message:", err)
+			}
+			return
 		}
+		c.socket.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+
+		var message incomingMessage
+		if err := json.Unmarshal(data, &message); err != nil || message.Type == "" {
+			c.SendError("invalid message")
+			continue
+		}
+
+		handler, ok := c.hub.messageHandler(message.Type)
+		if !ok {
+			c.SendError("unknown message type: " + message.Type)
+			continue
+		}
+		handler(c, message.Payload)
 	}
-	c.socket.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+// SendError le avisa al cliente que su mensaje no se pudo procesar.
+func (c *Client) SendError(text string) {
+	c.Send(models.WebsocketMessage{
+		Type:    models.MessageError,
+		Payload: text,
+	})
 }
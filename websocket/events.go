@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+const (
+	// eventos del log que se guardan, un cliente que perdio mas que esto debe resincronizar
+	defaultEventLogSize = 1000
+	// el log se recorta aparte para que publicar sea un solo INSERT
+	defaultTrimPeriod = time.Minute
+)
+
+// EventLog guarda los eventos que publica el hub con un seq creciente para que un cliente
+// que se reconecta recupere los que perdio. repository.Repository lo implementa.
+type EventLog interface {
+	InsertHubEvent(ctx context.Context, event *models.HubEvent) error
+	ListHubEvents(ctx context.Context, since int64, limit int) ([]*models.HubEvent, error)
+	TrimHubEvents(ctx context.Context, keep int) error
+}
+
+// ConnectOptions son los topics a los que queda suscrita la conexion desde el inicio y,
+// si se esta reconectando, el ultimo seq que recibio el cliente (0 sin replay).
+type ConnectOptions struct {
+	Topics []string
+	Since  int64
+}
+
+// replay son los eventos perdidos por un cliente que se reconecta, Run los entrega.
+type replay struct {
+	client *Client
+	since  int64
+	events []*models.HubEvent
+	resync bool // los eventos despues de since ya no estan en el log
+}
+
+// pendingEvent es un evento en vivo que llego mientras el cliente esperaba su replay.
+type pendingEvent struct {
+	seq  int64
+	data []byte
+}
+
+// UseEventLog guarda los eventos publicados desde ahora, se llama antes de Run.
+func (hub *Hub) UseEventLog(events EventLog) {
+	hub.events = events
+}
+
+// record guarda el evento en el log y devuelve el frame serializado con su seq.
+// Si no hay log o falla, el evento se entrega igual pero sin seq.
+func (hub *Hub) record(topics []string, message models.WebsocketMessage) (int64, []byte) {
+	if hub.events != nil {
+		if err := hub.insertEvent(topics, &message); err != nil {
+			log.Println("Error saving hub event:", err)
+		}
+	}
+	data, _ := json.Marshal(message)
+	return message.Seq, data
+}
+
+func (hub *Hub) insertEvent(topics []string, message *models.WebsocketMessage) error {
+	payload, err := json.Marshal(message.Payload)
+	if err != nil {
+		return err
+	}
+
+	event := &models.HubEvent{
+		Topics:  topics,
+		Type:    message.Type,
+		Payload: payload,
+	}
+	if err = hub.events.InsertHubEvent(context.Background(), event); err != nil {
+		return err
+	}
+	message.Seq = event.Seq
+	return nil
+}
+
+// trimLoop borra del log los eventos que sobran cada trimPeriod. Run lo arranca si hay log.
+func (hub *Hub) trimLoop() {
+	ticker := time.NewTicker(hub.trimPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := hub.events.TrimHubEvents(context.Background(), hub.eventLogSize); err != nil {
+			log.Println("Error trimming hub events:", err)
+		}
+	}
+}
+
+// loadEvent arma el frame del evento seq guardado en el log, para los envelopes que llegan sin data.
+func (hub *Hub) loadEvent(seq int64) ([]byte, error) {
+	if hub.events == nil || seq == 0 {
+		return nil, fmt.Errorf("hub event %d has no data and there is no event log", seq)
+	}
+	events, err := hub.events.ListHubEvents(context.Background(), seq, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Seq != seq {
+		return nil, fmt.Errorf("hub event %d not found", seq)
+	}
+	return json.Marshal(models.WebsocketMessage{
+		Type:    events[0].Type,
+		Payload: events[0].Payload,
+		Seq:     seq,
+	})
+}
+
+// loadReplay busca en el log los eventos despues de since.
+func (hub *Hub) loadReplay(client *Client, since int64) *replay {
+	result := &replay{client: client, since: since, resync: true}
+	if hub.events == nil {
+		return result
+	}
+
+	// se pide tambien el evento since: si ya no esta, se borraron los que venian despues de el
+	events, err := hub.events.ListHubEvents(context.Background(), since, hub.eventLogSize+1)
+	if err != nil {
+		log.Println("Error loading hub events:", err)
+		return result
+	}
+	// entre recortes el log puede tener mas de eventLogSize: si llego al limite perdio demasiado
+	if len(events) == 0 || events[0].Seq != since || len(events) > hub.eventLogSize {
+		return result
+	}
+
+	result.events = events[1:]
+	result.resync = false
+	return result
+}
+
+/*
+onReplay entrega al cliente los eventos perdidos de sus topics y despues los que llegaron
+en vivo mientras se buscaban, sin repetir los que ya iban en el replay.
+Si perdio mas de lo que cabe en la mitad de su buffer se le pide resincronizar.
+*/
+func (hub *Hub) onReplay(result *replay) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	client := result.client
+	pending := client.pending
+	client.replaying = false
+	client.pending = nil
+
+	var missed []*models.HubEvent
+	for _, event := range result.events {
+		if hub.subscribedLocked(client, event.Topics) {
+			missed = append(missed, event)
+		}
+	}
+	if result.resync || len(missed) > hub.sendBuffer/2 {
+		data, _ := json.Marshal(models.WebsocketMessage{Type: models.MessageResyncRequired})
+		hub.enqueueLocked(client, data)
+		missed = nil
+	}
+
+	last := result.since
+	for _, event := range missed {
+		data, _ := json.Marshal(models.WebsocketMessage{
+			Type:    event.Type,
+			Payload: event.Payload,
+			Seq:     event.Seq,
+		})
+		hub.enqueueLocked(client, data)
+		last = event.Seq
+	}
+	for _, event := range pending {
+		if event.seq == 0 || event.seq > last {
+			hub.enqueueLocked(client, event.data)
+		}
+	}
+}
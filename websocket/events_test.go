@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/database"
+	"github.com/kevintovar01/Store/models"
+)
+
+// newTestEventHub arranca un hub que guarda sus eventos en un repositorio en memoria;
+// las conexiones aceptan ?user=, ?topics= y ?since= como WebSocketHandler.
+func newTestEventHub(t *testing.T, configure func(hub *Hub)) (*Hub, string) {
+	t.Helper()
+
+	hub := NewHub()
+	hub.UseEventLog(database.NewMemoryRepository())
+	if configure != nil {
+		configure(hub)
+	}
+	go hub.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var options = ConnectOptions{}
+		if topics := r.URL.Query().Get("topics"); topics != "" {
+			options.Topics = strings.Split(topics, ",")
+		}
+		options.Since, _ = strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		hub.Connect(w, r, r.URL.Query().Get("user"), options)
+	}))
+	t.Cleanup(ts.Close)
+	return hub, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func TestReplayMissedEvents(t *testing.T) {
+	hub, url := newTestEventHub(t, nil)
+
+	conn := dial(t, url, "ana&topics=products")
+	waitFor(t, 5*time.Second, "client to register", func() bool { return hub.ClientCount() == 1 })
+	hub.Publish(models.TopicProducts, models.WebsocketMessage{Type: models.MessageProductCreated, Payload: 0})
+	first := read(t, conn)
+	conn.Close()
+	waitFor(t, 5*time.Second, "client to unregister", func() bool { return hub.ClientCount() == 0 })
+
+	// lo que se pierde: dos eventos de products, uno de otro topic y uno directo al usuario
+	hub.Publish(models.TopicProducts, models.WebsocketMessage{Type: models.MessageProductCreated, Payload: 1})
+	hub.Publish(models.ProductTopic("x"), models.WebsocketMessage{Type: models.MessageProductUpdated, Payload: 2})
+	hub.SendToUser("ana", models.WebsocketMessage{Type: "direct", Payload: 3})
+	hub.Publish(models.TopicProducts, models.WebsocketMessage{Type: models.MessageProductCreated, Payload: 4})
+
+	conn = dial(t, url, fmt.Sprintf("ana&topics=products&since=%d", first.Seq))
+	last := first.Seq
+	for _, payload := range []float64{1, 3, 4} {
+		message := read(t, conn)
+		if message.Payload != payload || message.Seq <= last {
+			t.Fatalf("expected event %v after seq %d, got %+v", payload, last, message)
+		}
+		last = message.Seq
+	}
+
+	hub.Broadcast(models.WebsocketMessage{Type: "broadcast", Payload: 5}, nil)
+	if message := read(t, conn); message.Payload != float64(5) || message.Seq != last+1 {
+		t.Fatalf("live event: expected seq %d, got %+v", last+1, message)
+	}
+}
+
+func TestReplayTooOldRequiresResync(t *testing.T) {
+	hub, url := newTestEventHub(t, func(hub *Hub) {
+		hub.eventLogSize = 3
+	})
+
+	for n := 1; n <= 5; n++ {
+		hub.Broadcast(models.WebsocketMessage{Type: "broadcast", Payload: n}, nil)
+	}
+
+	// el log solo guarda 3..5: desde 3 se puede repetir, desde 1 ya no
+	conn := dial(t, url, "ana&since=3")
+	for _, payload := range []float64{4, 5} {
+		if message := read(t, conn); message.Payload != payload {
+			t.Fatalf("expected event %v, got %+v", payload, message)
+		}
+	}
+
+	conn = dial(t, url, "bob&since=1")
+	if message := read(t, conn); message.Type != models.MessageResyncRequired {
+		t.Fatalf("expected resync_required, got %+v", message)
+	}
+
+	// despues del aviso llegan los eventos nuevos
+	hub.Broadcast(models.WebsocketMessage{Type: "broadcast", Payload: 6}, nil)
+	if message := read(t, conn); message.Payload != float64(6) || message.Seq != 6 {
+		t.Fatalf("live event: unexpected message %+v", message)
+	}
+}
+
+func TestReplayLargerThanBufferRequiresResync(t *testing.T) {
+	hub, url := newTestEventHub(t, func(hub *Hub) {
+		hub.sendBuffer = 8
+	})
+
+	for n := 1; n <= 10; n++ {
+		hub.Broadcast(models.WebsocketMessage{Type: "broadcast", Payload: n}, nil)
+	}
+
+	// 9 eventos perdidos no caben en medio buffer
+	conn := dial(t, url, "ana&since=1")
+	if message := read(t, conn); message.Type != models.MessageResyncRequired {
+		t.Fatalf("expected resync_required, got %+v", message)
+	}
+}
+
+func TestEventLogIsTrimmedInTheBackground(t *testing.T) {
+	hub, _ := newTestEventHub(t, func(hub *Hub) {
+		hub.eventLogSize = 3
+		hub.trimPeriod = 20 * time.Millisecond
+	})
+
+	for n := 1; n <= 5; n++ {
+		hub.Broadcast(models.WebsocketMessage{Type: "broadcast", Payload: n}, nil)
+	}
+
+	// publicar solo inserta, el recorte lo hace el ticker
+	waitFor(t, 5*time.Second, "event log to be trimmed", func() bool {
+		events, err := hub.events.ListHubEvents(context.Background(), 0, 10)
+		return err == nil && len(events) == 3 && events[0].Seq == 3
+	})
+}
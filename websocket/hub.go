@@ -1,84 +1,274 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kevintovar01/Store/models"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// tiempo maximo para escribir un mensaje al cliente
+	defaultWriteWait = 10 * time.Second
+	// tiempo maximo sin recibir nada (ni un pong) antes de dar la conexion por muerta
+	defaultPongWait = 60 * time.Second
+	// mensajes que se encolan por cliente; si se llena el cliente va muy atrasado y se expulsa
+	defaultSendBuffer = 256
+	// tamaño maximo de un mensaje entrante
+	maxMessageSize = 64 * 1024
 )
 
 var upgrader = websocket.Upgrader{
 	//checkorigin es una función opcional que se llama para verificar la solicitud de origen.
+	// se aceptan todos los origenes igual que en CORS: la conexion se autentica con el token, no con cookies
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// MessageHandler procesa un mensaje recibido de un cliente; payload es el json sin decodificar.
+type MessageHandler func(client *Client, payload json.RawMessage)
+
 /*
 Hub actúa como un Mediator centralizando la comunicación entre los clientes conectados.
 También implementa elementos de Observer, ya que notifica a los clientes de eventos,
 como cuando se recibe un mensaje de difusión.
+
+Nadie escribe directo en un socket: los mensajes se encolan sin bloquear en el buffer de cada
+cliente y su goroutine Write los envia. Un cliente lento solo se atrasa a si mismo; si llena
+su buffer se expulsa en lugar de frenar a los demas.
+
+Con un Backplane, lo que se publica en esta instancia tambien llega a los clientes de las demas.
+Con un EventLog cada evento lleva un seq y quien se reconecta recibe los que perdio.
+La presencia de cada usuario sale de sus conexiones en esta instancia.
 */
 type Hub struct {
-	clients    []*Client    // lista de clientes conectados (observadores)
-	register   chan *Client // canal de clientes para registrar nuevos clientes
-	unregister chan *Client // canal para desconectar clientes
-	mutex      *sync.Mutex  // Mutex garantiza concurrencia segura
+	id         string                    // identifica a esta instancia en el backplane
+	backplane  Backplane                 // nil cuando solo hay una instancia y nadie mas escucha
+	events     EventLog                  // nil si los eventos no se guardan
+	clients    map[*Client]bool          // clientes conectados (observadores)
+	register   chan *Client              // canal de clientes para registrar nuevos clientes
+	unregister chan *Client              // canal para desconectar clientes
+	replays    chan *replay              // eventos perdidos de los clientes que se reconectan
+	handlers   map[string]MessageHandler // handlers de los mensajes entrantes por tipo
+	onClose    func(client *Client)      // se llama cuando un cliente se desconecta
+	mutex      *sync.Mutex               // Mutex garantiza concurrencia segura
+
+	// presencia: conexiones por usuario y desde cuando esta away u offline, bajo el mutex
+	users           map[string]map[*Client]bool
+	lastSeen        map[string]time.Time
+	lastSeenStore   LastSeenStore     // nil si la ultima conexion no se guarda
+	presenceChanges []models.Presence // cambios que todavia no publica presenceLoop
+	presenceNotify  chan struct{}
+
+	writeWait    time.Duration
+	pongWait     time.Duration
+	pingPeriod   time.Duration // debe ser menor que pongWait
+	sendBuffer   int
+	eventLogSize int
+	trimPeriod   time.Duration // cada cuanto se recorta el log a eventLogSize
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make([]*Client, 0),
+		id:         ksuid.New().String(),
+		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		replays:    make(chan *replay),
+		handlers:   make(map[string]MessageHandler),
 		mutex:      &sync.Mutex{},
+
+		users:          make(map[string]map[*Client]bool),
+		lastSeen:       make(map[string]time.Time),
+		presenceNotify: make(chan struct{}, 1),
+
+		writeWait:  defaultWriteWait,
+		pongWait:   defaultPongWait,
+		pingPeriod: defaultPongWait * 9 / 10,
+		sendBuffer: defaultSendBuffer,
+
+		eventLogSize: defaultEventLogSize,
+		trimPeriod:   defaultTrimPeriod,
+	}
+}
+
+// UseBackplane conecta el hub con las demas instancias, se llama antes de Run.
+func (hub *Hub) UseBackplane(backplane Backplane) error {
+	hub.backplane = backplane
+	return backplane.Listen(hub.receive)
+}
+
+// forward reparte en las demas instancias lo que ya se entrego aqui.
+func (hub *Hub) forward(seq int64, topics []string, data []byte) {
+	if hub.backplane == nil {
+		return
+	}
+	err := hub.backplane.Publish(context.Background(), &Envelope{
+		Origin: hub.id,
+		Seq:    seq,
+		Topics: topics,
+		Data:   data,
+	})
+	if err != nil {
+		log.Println("Error publishing to the backplane:", err)
+	}
+}
+
+// receive entrega a los clientes locales lo que se publico en otra instancia.
+func (hub *Hub) receive(envelope *Envelope) {
+	if envelope.Origin == hub.id {
+		return
+	}
+
+	data := []byte(envelope.Data)
+	if len(data) == 0 {
+		// el backplane solo mando el seq, el evento se lee del log
+		var err error
+		if data, err = hub.loadEvent(envelope.Seq); err != nil {
+			log.Println("Error loading hub event from the backplane:", err)
+			return
+		}
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.deliverLocked(envelope.Seq, envelope.Topics, data, nil)
+}
+
+// deliverLocked encola data una sola vez en cada cliente suscrito a alguno de los topics
+// (a todos si no hay topics). Se llama con el mutex tomado.
+func (hub *Hub) deliverLocked(seq int64, topics []string, data []byte, ignore *Client) {
+	// borrar de un map mientras se recorre es seguro, por eso se puede expulsar en el mismo ciclo
+	for client := range hub.clients {
+		if client == ignore || !hub.subscribedLocked(client, topics) {
+			continue
+		}
+		if client.replaying {
+			// sale despues de los eventos perdidos, onReplay lo encola
+			client.pending = append(client.pending, pendingEvent{seq: seq, data: data})
+			continue
+		}
+		hub.enqueueLocked(client, data)
 	}
 }
 
+// subscribedLocked dice si el cliente sigue alguno de los topics, sin topics es un Broadcast.
+func (hub *Hub) subscribedLocked(client *Client, topics []string) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	for _, topic := range topics {
+		if client.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleMessage registra el handler para un tipo de mensaje entrante.
+func (hub *Hub) HandleMessage(messageType string, handler MessageHandler) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.handlers[messageType] = handler
+}
+
+// HandleDisconnect registra una funcion que se llama (en su propia goroutine) cada vez que un cliente se desconecta.
+func (hub *Hub) HandleDisconnect(handler func(client *Client)) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.onClose = handler
+}
+
+func (hub *Hub) messageHandler(messageType string) (MessageHandler, bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	handler, ok := hub.handlers[messageType]
+	return handler, ok
+}
+
 // Metodo que usa el patron MEDIATOR al registrar cada cliente en el hud central.
-// ruta de manejo para los diferentes eventos de websocket
-func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+// Connect abre el websocket de un usuario ya autenticado (handlers.WebSocketHandler valida el token
+// y que pueda seguir los topics de options).
+func (hub *Hub) Connect(w http.ResponseWriter, r *http.Request, userId string, options ConnectOptions) {
 	socket, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		// Upgrade ya respondio al cliente con el error
 		log.Println(err)
-		http.Error(w, "could not open websocket connection", http.StatusBadRequest)
 		return
 	}
-	client := NewClient(hub, socket)
+	client := NewClient(hub, socket, userId)
+	hub.join(client, options)
+	go client.Write()
+	go client.Read()
+	hub.resume(client, options)
+}
+
+// join suscribe al cliente a los topics de options y lo registra en el hub.
+func (hub *Hub) join(client *Client, options ConnectOptions) {
+	for _, topic := range options.Topics {
+		client.topics[topic] = true
+	}
+	// mientras se buscan los eventos perdidos los nuevos se guardan en pending
+	client.replaying = options.Since > 0
+
 	//register es un canal que se utiliza para registrar un nuevo cliente en el hub.
 	hub.register <- client
-	go client.Write()
+}
 
+// resume le repite al cliente que se reconecta los eventos que perdio.
+func (hub *Hub) resume(client *Client, options ConnectOptions) {
+	if client.replaying {
+		// Run procesa el replay despues del registro del cliente
+		hub.replays <- hub.loadReplay(client, options.Since)
+	}
 }
 
 // Run ejecuta el ciclo principal del Hud, utilizando el patron MEDIATOR.
 func (hub *Hub) Run() {
+	go hub.presenceLoop()
+	if hub.events != nil {
+		go hub.trimLoop()
+	}
+
 	for {
 		select {
 		case client := <-hub.register: // registro del cliente
 			hub.onConnect(client)
 		case client := <-hub.unregister: // desconexion de cliente
 			hub.onDisconnect(client)
+		case result := <-hub.replays: // eventos perdidos de un cliente que se reconecta
+			hub.onReplay(result)
 		}
 	}
 }
 
+// ClientCount devuelve cuantos clientes estan conectados.
+func (hub *Hub) ClientCount() int {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return len(hub.clients)
+}
+
 /*
 onConnect se ejecuta cuando un cliente se conecta al Hub.
 Usa Mutex para garantizar que las operaciones sobre la lista de clientes sean seguras
 en un entorno concurrente.
 */
 func (hub *Hub) onConnect(client *Client) {
-	// client.socket.RemoteAddr() devuelve la dirección remota de la conexión del cliente.
-	log.Println("Client Connected", client.socket.RemoteAddr())
+	// client.addr es la dirección remota de la conexión del cliente.
+	log.Println("Client Connected", client.addr, client.userId)
 
 	// Bloquea el acceso concurrente mientras se actualiza la lista de clientes
 	hub.mutex.Lock()
 	defer hub.mutex.Unlock()
 
-	// Asigna un identificador único al cliente basado en su dirección remota
-	client.id = client.socket.RemoteAddr().String()
-	hub.clients = append(hub.clients, client)
+	hub.clients[client] = true
+	hub.addPresenceLocked(client)
 }
 
 /*
@@ -86,31 +276,43 @@ onDisconnect se ejecuta cuando un cliente se desconecta del Hub.
 También usa Mutex para garantizar seguridad concurrente al modificar la lista de clientes.
 */
 func (hub *Hub) onDisconnect(client *Client) {
-	log.Println("Client Disconnected", client.socket.RemoteAddr())
-
-	// Cierra la conexión del cliente
-	client.socket.Close()
-
 	hub.mutex.Lock()
 	defer hub.mutex.Unlock()
-	// Encuentra el índice del cliente en la lista
-	i := -1
-	for index, c := range hub.clients {
-		if c.id == client.id {
-			i = index
-		}
+
+	// puede que ya se haya expulsado por ir atrasado
+	if hub.removeLocked(client) {
+		log.Println("Client Disconnected", client.addr)
+	}
+	// en otra goroutine porque puede publicar y aqui el mutex esta tomado
+	if hub.onClose != nil {
+		go hub.onClose(client)
 	}
-	// i = 3 , [i:] == [3,4,5], [i+1:] == [4,5]
-	// copy -> [1,2,4,5,5]
-	copy(hub.clients[i:], hub.clients[i+1:]) // se sobreescribe el valor en la posición i con el valor en la posición i+1
-	// [1,2,4,5,5]
-	hub.clients[len(hub.clients)-1] = nil
-	// [1,2,4,5,nil]
-	hub.clients = hub.clients[:len(hub.clients)-1]
-	// [1,2,4,5]
+}
 
-	// Cierra el canal de salida del cliente para liberar recursos
+// removeLocked saca al cliente del hub y cierra su outbound, Write al verlo cerrado cierra el socket.
+// Se llama con el mutex tomado; devuelve false si el cliente ya no estaba.
+func (hub *Hub) removeLocked(client *Client) bool {
+	if !hub.clients[client] {
+		return false
+	}
+	delete(hub.clients, client)
+	hub.removePresenceLocked(client)
 	close(client.outbound)
+	return true
+}
+
+// enqueueLocked deja el mensaje en el buffer del cliente sin bloquear.
+// Si el buffer esta lleno el cliente se expulsa. Se llama con el mutex tomado.
+func (hub *Hub) enqueueLocked(client *Client, data []byte) {
+	if !hub.clients[client] {
+		return
+	}
+	select {
+	case client.outbound <- data:
+	default:
+		log.Println("Client evicted, send buffer full", client.addr, client.userId)
+		hub.removeLocked(client)
+	}
 }
 
 /*
@@ -120,12 +322,63 @@ que reciben notificaciones (mensajes) a través del Hub.
 */
 
 // ignore es utiliza evitar que el cliente que envió el mensaje lo reciba.
-func (hub *Hub) Broadcast(message interface{}, ignore *Client) {
-	// serializamos el mensaje a json
-	data, _ := json.Marshal(message)
-	for _, client := range hub.clients {
-		if client != ignore {
-			client.outbound <- data
-		}
+func (hub *Hub) Broadcast(message models.WebsocketMessage, ignore *Client) {
+	// se guarda en el log y se serializa a json con su seq
+	seq, data := hub.record(nil, message)
+
+	hub.mutex.Lock()
+	hub.deliverLocked(seq, nil, data, ignore)
+	hub.mutex.Unlock()
+
+	// el cliente ignorado solo existe en esta instancia
+	hub.forward(seq, nil, data)
+}
+
+// Subscribe agrega el topic al cliente; quien llama ya verifico que el usuario puede verlo.
+func (hub *Hub) Subscribe(client *Client, topic string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	client.topics[topic] = true
+}
+
+// Unsubscribe quita el topic del cliente, los topics de su propio usuario y de su conexion no se pueden quitar.
+func (hub *Hub) Unsubscribe(client *Client, topic string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if topic != models.UserTopic(client.userId) && topic != models.ClientTopic(client.id) {
+		delete(client.topics, topic)
 	}
 }
+
+// Publish envia el mensaje solo a los clientes suscritos al topic.
+func (hub *Hub) Publish(topic string, message models.WebsocketMessage) {
+	hub.PublishAll([]string{topic}, message)
+}
+
+// PublishAll envia el mensaje una sola vez a cada cliente suscrito a alguno de los topics.
+func (hub *Hub) PublishAll(topics []string, message models.WebsocketMessage) {
+	seq, data := hub.record(topics, message)
+
+	hub.mutex.Lock()
+	hub.deliverLocked(seq, topics, data, nil)
+	hub.mutex.Unlock()
+
+	hub.forward(seq, topics, data)
+}
+
+// Signal envia el mensaje a los suscritos a los topics sin guardarlo en el log ni darle seq,
+// para avisos que no tiene sentido repetir al reconectarse (por ejemplo "escribiendo").
+func (hub *Hub) Signal(topics []string, message models.WebsocketMessage) {
+	data, _ := json.Marshal(message)
+
+	hub.mutex.Lock()
+	hub.deliverLocked(0, topics, data, nil)
+	hub.mutex.Unlock()
+
+	hub.forward(0, topics, data)
+}
+
+// SendToUser envia el mensaje a todas las conexiones abiertas del usuario.
+func (hub *Hub) SendToUser(userId string, message models.WebsocketMessage) {
+	hub.Publish(models.UserTopic(userId), message)
+}
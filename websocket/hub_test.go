@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kevintovar01/Store/models"
+)
+
+// newTestHub arranca un hub y un servidor que conecta a cualquiera con ?user=<id>.
+// configure permite cambiar los tiempos y el buffer antes de arrancar.
+func newTestHub(t *testing.T, configure func(hub *Hub)) (*Hub, string) {
+	t.Helper()
+
+	hub := NewHub()
+	if configure != nil {
+		configure(hub)
+	}
+	hub.HandleMessage(models.MessageSubscribe, func(client *Client, payload json.RawMessage) {
+		var request models.TopicRequest
+		json.Unmarshal(payload, &request)
+		hub.Subscribe(client, request.Topic)
+		client.Send(models.WebsocketMessage{Type: models.MessageSubscribed, Payload: &request})
+	})
+	go hub.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.Connect(w, r, r.URL.Query().Get("user"), ConnectOptions{})
+	}))
+	t.Cleanup(ts.Close)
+	return hub, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dial(t *testing.T, url string, userId string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?user="+userId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn) models.WebsocketMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message models.WebsocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	return message
+}
+
+// waitFor reintenta cond hasta que se cumpla o pase el timeout.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublishReachesOnlySubscribers(t *testing.T) {
+	const clients = 300
+	const messages = 20
+
+	hub, url := newTestHub(t, nil)
+
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i] = dial(t, url, fmt.Sprintf("user-%d", i))
+	}
+	waitFor(t, 5*time.Second, "clients to register", func() bool { return hub.ClientCount() == clients })
+
+	// los pares siguen "products"
+	for i := 0; i < clients; i += 2 {
+		conns[i].WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": models.TopicProducts}})
+		if message := read(t, conns[i]); message.Type != models.MessageSubscribed {
+			t.Fatalf("client %d: unexpected reply %+v", i, message)
+		}
+	}
+
+	for n := 0; n < messages; n++ {
+		hub.Publish(models.TopicProducts, models.WebsocketMessage{Type: models.MessageProductCreated, Payload: n})
+	}
+	for i := 0; i < clients; i++ {
+		hub.SendToUser(fmt.Sprintf("user-%d", i), models.WebsocketMessage{Type: "direct", Payload: i})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer wg.Done()
+			expected := 0
+			if i%2 == 0 {
+				expected = messages
+			}
+			for n := 0; n < expected; n++ {
+				var message models.WebsocketMessage
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if err := conn.ReadJSON(&message); err != nil || message.Type != models.MessageProductCreated || message.Payload != float64(n) {
+					errs <- fmt.Errorf("client %d message %d: %+v %v", i, n, message, err)
+					return
+				}
+			}
+			// el mensaje directo llega despues y es lo unico que recibe quien no esta suscrito
+			var message models.WebsocketMessage
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.ReadJSON(&message); err != nil || message.Type != "direct" || message.Payload != float64(i) {
+				errs <- fmt.Errorf("client %d direct message: %+v %v", i, message, err)
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestSlowConsumerIsEvicted(t *testing.T) {
+	const buffer = 8
+
+	hub := NewHub()
+	hub.sendBuffer = buffer
+	go hub.Run()
+
+	// el cliente lento se registra sin su goroutine Write: nadie vacia su buffer
+	slow := make(chan *Client, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("user") != "slow" {
+			hub.Connect(w, r, r.URL.Query().Get("user"), ConnectOptions{})
+			return
+		}
+		socket, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewClient(hub, socket, "slow")
+		hub.register <- client
+		slow <- client
+	}))
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	dial(t, url, "slow")
+	slowClient := <-slow
+	healthy := dial(t, url, "healthy")
+	waitFor(t, 5*time.Second, "clients to register", func() bool { return hub.ClientCount() == 2 })
+
+	// se llena el buffer del lento; el sano va leyendo y nunca pasa de buffer pendientes
+	for n := 0; n < buffer; n++ {
+		hub.Broadcast(models.WebsocketMessage{Type: models.MessageProductCreated, Payload: n}, nil)
+	}
+	for n := 0; n < buffer; n++ {
+		if message := read(t, healthy); message.Payload != float64(n) {
+			t.Fatalf("healthy client: expected message %d, got %+v", n, message)
+		}
+	}
+	if count := hub.ClientCount(); count != 2 {
+		t.Fatalf("a full buffer is not an eviction yet, %d clients left", count)
+	}
+
+	// el siguiente mensaje no cabe: Broadcast no bloquea y expulsa al lento
+	done := make(chan struct{})
+	go func() {
+		hub.Broadcast(models.WebsocketMessage{Type: models.MessageProductCreated, Payload: buffer}, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked on a slow consumer")
+	}
+
+	if count := hub.ClientCount(); count != 1 {
+		t.Fatalf("expected the slow client to be evicted, %d clients left", count)
+	}
+	if message := read(t, healthy); message.Payload != float64(buffer) {
+		t.Fatalf("healthy client: expected message %d, got %+v", buffer, message)
+	}
+
+	// su outbound quedo cerrado despues de los mensajes que alcanzaron a entrar
+	received := 0
+	for range slowClient.outbound {
+		received++
+	}
+	if received != buffer {
+		t.Fatalf("slow client: expected %d queued messages, got %d", buffer, received)
+	}
+}
+
+func TestHeartbeatDropsDeadClients(t *testing.T) {
+	hub, url := newTestHub(t, func(hub *Hub) {
+		hub.pongWait = 300 * time.Millisecond
+		hub.pingPeriod = 100 * time.Millisecond
+	})
+
+	// el cliente vivo lee, y al leer gorilla contesta los pings
+	alive := dial(t, url, "alive")
+	go func() {
+		for {
+			if _, _, err := alive.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// el cliente muerto nunca lee, entonces nunca contesta los pings
+	dial(t, url, "dead")
+	waitFor(t, 5*time.Second, "clients to register", func() bool { return hub.ClientCount() == 2 })
+
+	waitFor(t, 5*time.Second, "the dead client to be dropped", func() bool { return hub.ClientCount() == 1 })
+
+	// varias veces pongWait despues el vivo sigue conectado
+	time.Sleep(time.Second)
+	if count := hub.ClientCount(); count != 1 {
+		t.Fatalf("expected the live client to stay connected, %d clients", count)
+	}
+}
+
+func TestConcurrentPublishAndDisconnect(t *testing.T) {
+	const clients = 200
+
+	hub, url := newTestHub(t, func(hub *Hub) {
+		hub.sendBuffer = 4
+	})
+
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i] = dial(t, url, fmt.Sprintf("user-%d", i))
+	}
+	waitFor(t, 5*time.Second, "clients to register", func() bool { return hub.ClientCount() == clients })
+
+	// se publica desde varias goroutines mientras los clientes se van desconectando
+	stop := make(chan struct{})
+	var publishers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		publishers.Add(1)
+		go func(p int) {
+			defer publishers.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				hub.Broadcast(models.WebsocketMessage{Type: models.MessageProductCreated, Payload: n}, nil)
+				hub.SendToUser(fmt.Sprintf("user-%d", n%clients), models.WebsocketMessage{Type: "direct", Payload: p})
+			}
+		}(p)
+	}
+
+	var closers sync.WaitGroup
+	for _, conn := range conns {
+		closers.Add(1)
+		go func(conn *websocket.Conn) {
+			defer closers.Done()
+			conn.Close()
+		}(conn)
+	}
+	closers.Wait()
+
+	waitFor(t, 10*time.Second, "every client to unregister", func() bool { return hub.ClientCount() == 0 })
+	close(stop)
+	publishers.Wait()
+}
@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+// LastSeenStore guarda cuando se desconecto cada usuario, para responder su presencia
+// despues de que el hub lo olvida (por ejemplo al reiniciar la instancia).
+type LastSeenStore interface {
+	SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error
+}
+
+// UseLastSeenStore guarda la ultima conexion de los usuarios que quedan offline, se llama antes de Run.
+func (hub *Hub) UseLastSeenStore(store LastSeenStore) {
+	hub.lastSeenStore = store
+}
+
+// Presence devuelve el estado del usuario segun las conexiones abiertas en esta instancia.
+// Offline sin LastSeen quiere decir que esta instancia no lo ha visto.
+func (hub *Hub) Presence(userId string) models.Presence {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return hub.presenceLocked(userId)
+}
+
+// SetAway marca la conexion como inactiva (o activa otra vez). El usuario esta away cuando
+// todas sus conexiones lo estan.
+func (hub *Hub) SetAway(client *Client, away bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if !hub.clients[client] || client.away == away {
+		return
+	}
+	previous := hub.statusLocked(client.userId)
+	client.away = away
+	hub.presenceChangedLocked(client.userId, previous)
+}
+
+// statusLocked calcula el estado del usuario: online si alguna conexion esta activa,
+// away si todas estan inactivas y offline si no tiene ninguna.
+func (hub *Hub) statusLocked(userId string) string {
+	connections := hub.users[userId]
+	if len(connections) == 0 {
+		return models.PresenceOffline
+	}
+	for client := range connections {
+		if !client.away {
+			return models.PresenceOnline
+		}
+	}
+	return models.PresenceAway
+}
+
+func (hub *Hub) presenceLocked(userId string) models.Presence {
+	presence := models.Presence{
+		UserId: userId,
+		Status: hub.statusLocked(userId),
+	}
+	if lastSeen, ok := hub.lastSeen[userId]; ok && presence.Status != models.PresenceOnline {
+		presence.LastSeen = &lastSeen
+	}
+	return presence
+}
+
+// addPresenceLocked y removePresenceLocked mantienen el indice de conexiones por usuario.
+// Se llaman con el mutex tomado al registrar y al sacar al cliente.
+func (hub *Hub) addPresenceLocked(client *Client) {
+	previous := hub.statusLocked(client.userId)
+	if hub.users[client.userId] == nil {
+		hub.users[client.userId] = make(map[*Client]bool)
+	}
+	hub.users[client.userId][client] = true
+	hub.presenceChangedLocked(client.userId, previous)
+}
+
+func (hub *Hub) removePresenceLocked(client *Client) {
+	previous := hub.statusLocked(client.userId)
+	delete(hub.users[client.userId], client)
+	if len(hub.users[client.userId]) == 0 {
+		delete(hub.users, client.userId)
+	}
+	hub.presenceChangedLocked(client.userId, previous)
+}
+
+// presenceChangedLocked encola el nuevo estado si cambio. Se publica desde presenceLoop
+// porque aqui el mutex esta tomado, y en el mismo orden en que cambio.
+func (hub *Hub) presenceChangedLocked(userId string, previous string) {
+	status := hub.statusLocked(userId)
+	if status == previous {
+		return
+	}
+	if status == models.PresenceOnline {
+		delete(hub.lastSeen, userId)
+	} else if previous == models.PresenceOnline || status == models.PresenceOffline {
+		// away desde que dejo de estar activo, offline desde que cerro su ultima conexion
+		hub.lastSeen[userId] = time.Now().UTC()
+	}
+
+	hub.presenceChanges = append(hub.presenceChanges, hub.presenceLocked(userId))
+	select {
+	case hub.presenceNotify <- struct{}{}:
+	default:
+		// presenceLoop ya tiene un aviso pendiente y va a leer este cambio tambien
+	}
+}
+
+// presenceLoop publica los cambios de presencia en el topic de cada usuario y guarda
+// la ultima conexion de quien queda offline. Run lo arranca.
+func (hub *Hub) presenceLoop() {
+	for range hub.presenceNotify {
+		hub.mutex.Lock()
+		changes := hub.presenceChanges
+		hub.presenceChanges = nil
+		hub.mutex.Unlock()
+
+		for _, presence := range changes {
+			hub.Signal([]string{models.PresenceTopic(presence.UserId)}, models.WebsocketMessage{
+				Type:    models.MessagePresence,
+				Payload: presence,
+			})
+
+			if presence.Status == models.PresenceOffline && hub.lastSeenStore != nil {
+				if err := hub.lastSeenStore.SetLastSeen(context.Background(), presence.UserId, *presence.LastSeen); err != nil {
+					log.Println("Error saving last seen:", err)
+				}
+			}
+		}
+	}
+}
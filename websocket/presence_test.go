@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+// testLastSeenStore guarda en memoria lo que el hub manda a persistir.
+type testLastSeenStore struct {
+	mutex    sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+func (store *testLastSeenStore) SetLastSeen(ctx context.Context, userId string, lastSeen time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.lastSeen[userId] = lastSeen
+	return nil
+}
+
+func (store *testLastSeenStore) get(userId string) (time.Time, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	lastSeen, ok := store.lastSeen[userId]
+	return lastSeen, ok
+}
+
+func TestPresenceAcrossConnections(t *testing.T) {
+	store := &testLastSeenStore{lastSeen: make(map[string]time.Time)}
+	hub, url := newTestHub(t, func(hub *Hub) {
+		hub.UseLastSeenStore(store)
+	})
+
+	if presence := hub.Presence("seller"); presence.Status != models.PresenceOffline || presence.LastSeen != nil {
+		t.Fatalf("unexpected presence before connecting: %+v", presence)
+	}
+
+	first := dial(t, url, "seller")
+	second := dial(t, url, "seller")
+	waitFor(t, 5*time.Second, "clients to register", func() bool { return hub.ClientCount() == 2 })
+	if presence := hub.Presence("seller"); presence.Status != models.PresenceOnline || presence.LastSeen != nil {
+		t.Fatalf("expected online, got %+v", presence)
+	}
+
+	var clients []*Client
+	hub.mutex.Lock()
+	for client := range hub.users["seller"] {
+		clients = append(clients, client)
+	}
+	hub.mutex.Unlock()
+
+	hub.SetAway(clients[0], true)
+	if presence := hub.Presence("seller"); presence.Status != models.PresenceOnline {
+		t.Fatalf("one active connection keeps the user online, got %+v", presence)
+	}
+	hub.SetAway(clients[1], true)
+	if presence := hub.Presence("seller"); presence.Status != models.PresenceAway || presence.LastSeen == nil {
+		t.Fatalf("expected away with last seen, got %+v", presence)
+	}
+
+	// cerrar una conexion no cambia nada mientras quede otra
+	first.Close()
+	waitFor(t, 5*time.Second, "the first client to unregister", func() bool { return hub.ClientCount() == 1 })
+	if presence := hub.Presence("seller"); presence.Status != models.PresenceAway {
+		t.Fatalf("expected away, got %+v", presence)
+	}
+	if _, ok := store.get("seller"); ok {
+		t.Fatal("last seen saved while the user is still connected")
+	}
+
+	second.Close()
+	waitFor(t, 5*time.Second, "the last seen to be saved", func() bool {
+		_, ok := store.get("seller")
+		return ok
+	})
+	presence := hub.Presence("seller")
+	lastSeen, _ := store.get("seller")
+	if presence.Status != models.PresenceOffline || presence.LastSeen == nil || !presence.LastSeen.Equal(lastSeen) {
+		t.Fatalf("expected offline since %v, got %+v", lastSeen, presence)
+	}
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+	"github.com/segmentio/ksuid"
+)
+
+/*
+Stream envia los eventos del hub como Server-Sent Events, para los clientes que no pueden abrir
+un websocket. El cliente se registra igual que uno de Connect: recibe los mismos frames de los
+mismos topics y se reconecta con since (el header Last-Event-ID). Solo recibe, no manda mensajes.
+
+Bloquea hasta que el cliente se desconecta o el hub lo expulsa.
+*/
+func (hub *Hub) Stream(w http.ResponseWriter, r *http.Request, userId string, options ConnectOptions) {
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx no debe guardar la respuesta en buffer
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		log.Println("Error starting event stream:", err)
+		return
+	}
+
+	client := newStreamClient(hub, userId, r.RemoteAddr)
+	hub.join(client, options)
+	defer func() {
+		hub.unregister <- client
+	}()
+	hub.resume(client, options)
+
+	// los comentarios mantienen viva la conexion en los proxies y detectan al cliente que ya no esta
+	ticker := time.NewTicker(hub.pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-client.outbound:
+			if !ok {
+				// el hub saco al cliente
+				return
+			}
+			if err := writeEvent(w, controller, hub.writeWait, data); err != nil {
+				log.Println("Error writing event:", err)
+				return
+			}
+		case <-ticker.C:
+			controller.SetWriteDeadline(time.Now().Add(hub.writeWait))
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func newStreamClient(hub *Hub, userId string, addr string) *Client {
+	id := ksuid.New().String()
+	return &Client{
+		hub:      hub,
+		id:       id,
+		userId:   userId,
+		addr:     addr,
+		outbound: make(chan []byte, hub.sendBuffer),
+		topics:   map[string]bool{models.UserTopic(userId): true, models.ClientTopic(id): true},
+	}
+}
+
+// writeEvent escribe un frame como evento SSE; el id es el seq para que el navegador lo
+// devuelva en Last-Event-ID al reconectarse.
+func writeEvent(w http.ResponseWriter, controller *http.ResponseController, writeWait time.Duration, data []byte) error {
+	var frame struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(data, &frame)
+
+	controller.SetWriteDeadline(time.Now().Add(writeWait))
+	if frame.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", frame.Seq); err != nil {
+			return err
+		}
+	}
+	// los frames son json en una sola linea, caben en un solo campo data
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return controller.Flush()
+}
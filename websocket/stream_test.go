@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevintovar01/Store/models"
+)
+
+func TestStreamHeartbeatAndDisconnect(t *testing.T) {
+	hub := NewHub()
+	hub.pingPeriod = 50 * time.Millisecond
+	go hub.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.Stream(w, r, "ana", ConnectOptions{})
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+	waitFor(t, 5*time.Second, "client to register", func() bool { return hub.ClientCount() == 1 })
+
+	lines := make(chan string)
+	go func() {
+		reader := bufio.NewReader(res.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out reading the stream")
+			return ""
+		}
+	}
+
+	if line := next(); line != ": ping" {
+		t.Fatalf("expected a heartbeat, got %q", line)
+	}
+
+	// los mensajes del usuario llegan como eventos sin id, no hay log de eventos
+	hub.SendToUser("ana", models.WebsocketMessage{Type: "direct", Payload: 1})
+	for {
+		line := next()
+		if line == "" || line == ": ping" {
+			continue
+		}
+		if line != `data: {"type":"direct","payload":1}` {
+			t.Fatalf("unexpected line %q", line)
+		}
+		break
+	}
+
+	// al cerrar la peticion el cliente sale del hub
+	cancel()
+	waitFor(t, 5*time.Second, "client to unregister", func() bool { return hub.ClientCount() == 0 })
+}
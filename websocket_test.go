@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// dialWebSocket abre /ws con el token; query se agrega tal cual a la url (por ejemplo "&since=3").
+func dialWebSocket(t *testing.T, ts *httptest.Server, token string, query ...string) (*gorillaws.Conn, int) {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?token=" + token + strings.Join(query, "")
+	conn, res, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		if res == nil {
+			t.Fatal(err)
+		}
+		return nil, res.StatusCode
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, res.StatusCode
+}
+
+func readWebSocket(t *testing.T, conn *gorillaws.Conn) testWebsocketMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message testWebsocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("reading websocket: %v", err)
+	}
+	return message
+}
+
+type testWebsocketMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Seq     int64           `json:"seq"`
+}
+
+func TestWebSocket(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	customer := signUp(t, ts, "ana@store.com", "secret")
+
+	if _, status := dialWebSocket(t, ts, ""); status != http.StatusUnauthorized {
+		t.Fatalf("websocket without token: expected 401, got %d", status)
+	}
+	if _, status := dialWebSocket(t, ts, "not-a-token"); status != http.StatusUnauthorized {
+		t.Fatalf("websocket with invalid token: expected 401, got %d", status)
+	}
+
+	conn, status := dialWebSocket(t, ts, customer)
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("websocket: status %d", status)
+	}
+
+	// el hub lee lo que manda el cliente y responde segun el tipo
+	if err := conn.WriteJSON(map[string]interface{}{"type": "ping", "payload": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, conn); message.Type != "pong" || string(message.Payload) != "7" {
+		t.Fatalf("ping: unexpected reply %+v", message)
+	}
+
+	if err := conn.WriteJSON(map[string]string{"type": "dance"}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, conn); message.Type != "error" {
+		t.Fatalf("unknown type: unexpected reply %+v", message)
+	}
+
+	if err := conn.WriteMessage(gorillaws.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, conn); message.Type != "error" {
+		t.Fatalf("invalid frame: unexpected reply %+v", message)
+	}
+
+	// los eventos del servidor llegan a quien este suscrito al topic
+	subscribe(t, conn, "products")
+	createProduct(t, ts, merchant, "Mouse", 20, 5)
+	if message := readWebSocket(t, conn); message.Type != "Product created" {
+		t.Fatalf("publish: unexpected message %+v", message)
+	}
+}
+
+func subscribe(t *testing.T, conn *gorillaws.Conn, topic string) {
+	t.Helper()
+
+	if err := conn.WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": topic}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, conn); message.Type != "subscribed" {
+		t.Fatalf("subscribe %s: unexpected reply %+v", topic, message)
+	}
+}
+
+// expectPong manda un ping y exige que lo siguiente que llegue sea el pong,
+// asi se comprueba que antes no llego ningun otro mensaje.
+func expectPong(t *testing.T, conn *gorillaws.Conn) {
+	t.Helper()
+
+	if err := conn.WriteJSON(map[string]string{"type": "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, conn); message.Type != "pong" {
+		t.Fatalf("expected only pong, got %+v", message)
+	}
+}
+
+func TestWebSocketTopics(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	admin := signUpAdmin(t, ts, "root@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+	bob := signUp(t, ts, "bob@store.com", "secret")
+
+	productId := createProduct(t, ts, merchant, "Mouse", 20, 5)
+	orderId := placeOrder(t, ts, ana, map[string]int{productId: 1})
+
+	var bobUser struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", bob, nil, &bobUser)
+
+	anaConn, _ := dialWebSocket(t, ts, ana)
+	bobConn, _ := dialWebSocket(t, ts, bob)
+	staffConn, _ := dialWebSocket(t, ts, admin)
+
+	// solo se puede seguir lo que el usuario puede ver
+	for _, topic := range []string{"user:" + bobUser.Id, "cart", "product:"} {
+		if err := anaConn.WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": topic}}); err != nil {
+			t.Fatal(err)
+		}
+		if message := readWebSocket(t, anaConn); message.Type != "error" {
+			t.Fatalf("subscribe %s: expected error, got %+v", topic, message)
+		}
+	}
+	subscribe(t, anaConn, "order:"+orderId)
+	if err := bobConn.WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": "order:" + orderId}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, bobConn); message.Type != "error" {
+		t.Fatalf("subscribe to someone else's order: expected error, got %+v", message)
+	}
+	subscribe(t, staffConn, "order:"+orderId)
+	subscribe(t, bobConn, "product:"+productId)
+
+	// el cambio de estado llega una vez al dueño (aunque siga la orden) y al staff que la sigue, no a bob
+	if status := doJSON(t, ts, http.MethodPut, "/orders/"+orderId+"/status", admin, map[string]string{"status": "paid"}, nil); status != http.StatusOK {
+		t.Fatalf("update status: %d", status)
+	}
+	for _, conn := range []*gorillaws.Conn{anaConn, staffConn} {
+		if message := readWebSocket(t, conn); message.Type != "Order status changed" {
+			t.Fatalf("order event: unexpected message %+v", message)
+		}
+		expectPong(t, conn)
+	}
+	expectPong(t, bobConn)
+
+	// otro merchant no puede cambiar el producto y no se publica nada
+	other := signUpMerchant(t, ts, "other@store.com", "secret")
+	status := doJSON(t, ts, http.MethodPut, "/products/"+productId, other, map[string]interface{}{"name": "Falso", "price": 1, "stock": 5}, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("update someone else's product: expected 403, got %d", status)
+	}
+	expectPong(t, bobConn)
+
+	// la actualizacion de un producto llega a quien sigue ese producto, con lo que quedo guardado
+	status = doJSON(t, ts, http.MethodPut, "/products/"+productId, merchant, map[string]interface{}{"name": "Mouse", "price": 25, "stock": 5}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("update product: %d", status)
+	}
+	message := readWebSocket(t, bobConn)
+	var updated struct {
+		Id    string  `json:"id"`
+		Price float64 `json:"price"`
+	}
+	json.Unmarshal(message.Payload, &updated)
+	if message.Type != "Product updated" || updated.Id != productId || updated.Price != 25 {
+		t.Fatalf("product event: unexpected message %+v", message)
+	}
+	expectPong(t, anaConn)
+
+	// despues de unsubscribe ya no llega
+	if err := bobConn.WriteJSON(map[string]interface{}{"type": "unsubscribe", "payload": map[string]string{"topic": "product:" + productId}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readWebSocket(t, bobConn); message.Type != "unsubscribed" {
+		t.Fatalf("unsubscribe: unexpected reply %+v", message)
+	}
+	doJSON(t, ts, http.MethodPut, "/products/"+productId, merchant, map[string]interface{}{"name": "Mouse", "price": 30, "stock": 5}, nil)
+	expectPong(t, bobConn)
+}
+
+func TestWebSocketReplay(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+
+	conn, _ := dialWebSocket(t, ts, ana, "&topics=products")
+	createProduct(t, ts, merchant, "Mouse", 20, 5)
+	first := readWebSocket(t, conn)
+	if first.Type != "Product created" || first.Seq == 0 {
+		t.Fatalf("expected a product event with seq, got %+v", first)
+	}
+	conn.Close()
+
+	// mientras ana esta desconectada se crean dos productos mas
+	createProduct(t, ts, merchant, "Keyboard", 30, 5)
+	createProduct(t, ts, merchant, "Monitor", 200, 5)
+
+	since := "&since=" + strconv.FormatInt(first.Seq, 10)
+	conn, _ = dialWebSocket(t, ts, ana, "&topics=products", since)
+	last := first.Seq
+	for _, name := range []string{"Keyboard", "Monitor"} {
+		message := readWebSocket(t, conn)
+		if message.Type != "Product created" || message.Seq <= last || !strings.Contains(string(message.Payload), name) {
+			t.Fatalf("replay %s: unexpected message %+v", name, message)
+		}
+		last = message.Seq
+	}
+	expectPong(t, conn)
+
+	// lo que se publica despues sigue llegando en vivo con un seq mayor
+	createProduct(t, ts, merchant, "Webcam", 50, 5)
+	if message := readWebSocket(t, conn); message.Type != "Product created" || message.Seq <= last {
+		t.Fatalf("live event: unexpected message %+v", message)
+	}
+
+	// solo se repiten los eventos de los topics de la conexion
+	conn, _ = dialWebSocket(t, ts, ana, since)
+	expectPong(t, conn)
+
+	// un seq que ya no esta en el log pide resincronizar
+	conn, _ = dialWebSocket(t, ts, ana, "&since=999999")
+	if message := readWebSocket(t, conn); message.Type != "resync_required" {
+		t.Fatalf("expected resync_required, got %+v", message)
+	}
+
+	var user struct {
+		Id string `json:"id"`
+	}
+	doJSON(t, ts, http.MethodGet, "/me", merchant, nil, &user)
+	if _, status := dialWebSocket(t, ts, ana, "&topics=user:"+user.Id); status != http.StatusForbidden {
+		t.Fatalf("topic of another user: expected 403, got %d", status)
+	}
+	if _, status := dialWebSocket(t, ts, ana, "&since=abc"); status != http.StatusBadRequest {
+		t.Fatalf("invalid since: expected 400, got %d", status)
+	}
+}
+
+// sendWebSocket escribe un mensaje {type, payload} en la conexion.
+func sendWebSocket(t *testing.T, conn *gorillaws.Conn, messageType string, payload interface{}) {
+	t.Helper()
+
+	if err := conn.WriteJSON(map[string]interface{}{"type": messageType, "payload": payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectWebSocket lee de cada conexion y exige el tipo de mensaje.
+func expectWebSocket(t *testing.T, messageType string, conns ...*gorillaws.Conn) testWebsocketMessage {
+	t.Helper()
+
+	var message testWebsocketMessage
+	for i, conn := range conns {
+		if message = readWebSocket(t, conn); message.Type != messageType {
+			t.Fatalf("conn %d: expected %s, got %+v", i, messageType, message)
+		}
+	}
+	return message
+}
+
+// openEvents abre /events como lo hace EventSource, con el token en la url.
+func openEvents(t *testing.T, ts *httptest.Server, token string, lastEventId string, query string) (*bufio.Reader, int) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events?token="+token+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return bufio.NewReader(res.Body), res.StatusCode
+}
+
+type testEvent struct {
+	Id      string
+	Message testWebsocketMessage
+}
+
+// readEvent lee el siguiente evento saltando los comentarios de heartbeat.
+func readEvent(t *testing.T, events *bufio.Reader) testEvent {
+	t.Helper()
+
+	var event testEvent
+	done := make(chan error, 1)
+	go func() {
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				done <- err
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.Id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				done <- json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Message)
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return event
+}
+
+func TestServerSentEvents(t *testing.T) {
+	ts := newTestServer(t)
+	merchant := signUpMerchant(t, ts, "shop@store.com", "secret")
+	ana := signUp(t, ts, "ana@store.com", "secret")
+
+	if _, status := openEvents(t, ts, "invalid", "", ""); status != http.StatusUnauthorized {
+		t.Fatalf("invalid token: expected 401, got %d", status)
+	}
+
+	events, status := openEvents(t, ts, ana, "", "&topics=products")
+	if status != http.StatusOK {
+		t.Fatalf("open events: %d", status)
+	}
+
+	// el mismo frame que por websocket, con el seq como id del evento
+	createProduct(t, ts, merchant, "Mouse", 20, 5)
+	first := readEvent(t, events)
+	if first.Message.Type != "Product created" || first.Id != strconv.FormatInt(first.Message.Seq, 10) {
+		t.Fatalf("unexpected event %+v", first)
+	}
+
+	// al reconectarse con Last-Event-ID llega lo que se perdio
+	createProduct(t, ts, merchant, "Keyboard", 30, 5)
+	resumed, _ := openEvents(t, ts, ana, first.Id, "&topics=products")
+	if event := readEvent(t, resumed); event.Message.Type != "Product created" || !strings.Contains(string(event.Message.Payload), "Keyboard") {
+		t.Fatalf("replay: unexpected event %+v", event)
+	}
+	if event := readEvent(t, events); !strings.Contains(string(event.Message.Payload), "Keyboard") {
+		t.Fatalf("live: unexpected event %+v", event)
+	}
+}